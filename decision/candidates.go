@@ -0,0 +1,157 @@
+package decision
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// CandidateScoreWeights 候选币种评分权重
+type CandidateScoreWeights struct {
+	AI500   float64 // 出现在AI500中的加分
+	OITop   float64 // 出现在OI Top中的加分
+	OIDelta float64 // OI变化幅度每1%（绝对值）的加分
+	OIRank  float64 // OI增长榜排名加分：第N名加 OIRank/N（排名越靠前加分越多，0=不按排名加权）
+}
+
+// DefaultCandidateScoreWeights 默认权重：单一来源1分，双重信号2分；OI每变化1%加0.1分
+// （OI变化10%约等于多一个来源，保证双重信号优先，同来源内OI变化大的靠前）
+var DefaultCandidateScoreWeights = CandidateScoreWeights{
+	AI500:   1.0,
+	OITop:   1.0,
+	OIDelta: 0.1,
+}
+
+// ScoreCandidate 计算候选币种的综合评分（来源权重 + OI变化幅度 + 可选的OI排名加权）
+func ScoreCandidate(coin CandidateCoin, oi *OITopData, weights CandidateScoreWeights) float64 {
+	score := 0.0
+	for _, source := range coin.Sources {
+		switch source {
+		case "ai500":
+			score += weights.AI500
+		case "oi_top":
+			score += weights.OITop
+		}
+	}
+	if oi != nil {
+		score += math.Abs(oi.OIDeltaPercent) * weights.OIDelta
+		if oi.Rank > 0 {
+			score += weights.OIRank / float64(oi.Rank)
+		}
+	}
+	return score
+}
+
+// rankCandidates 为候选币种计算评分并按评分从高到低排序（同分保持原顺序）
+func rankCandidates(ctx *Context) {
+	weights := ctx.CandidateWeights
+	if weights == (CandidateScoreWeights{}) {
+		weights = DefaultCandidateScoreWeights
+	}
+
+	for i := range ctx.CandidateCoins {
+		coin := &ctx.CandidateCoins[i]
+		coin.Score = ScoreCandidate(*coin, ctx.OITopDataMap[coin.Symbol], weights)
+	}
+
+	sort.SliceStable(ctx.CandidateCoins, func(i, j int) bool {
+		return ctx.CandidateCoins[i].Score > ctx.CandidateCoins[j].Score
+	})
+}
+
+// renderedCandidates 返回在prompt中展示的候选币种：有市场数据的候选按评分从高到低排列，
+// 设置 MaxRenderedCandidates 时只取前N个（其余币种的数据仍参与评分和过滤，但不发送给AI）
+func renderedCandidates(ctx *Context) []CandidateCoin {
+	rendered := make([]CandidateCoin, 0, len(ctx.CandidateCoins))
+	for _, coin := range ctx.CandidateCoins {
+		if _, hasData := ctx.MarketDataMap[coin.Symbol]; hasData {
+			rendered = append(rendered, coin)
+		}
+	}
+	sort.SliceStable(rendered, func(i, j int) bool {
+		return rendered[i].Score > rendered[j].Score
+	})
+	if n := ctx.MaxRenderedCandidates; n > 0 && len(rendered) > n {
+		rendered = rendered[:n]
+	}
+	return rendered
+}
+
+// capCandidatesPerSource 按来源限制候选币种数量，避免单一来源占满候选池（需在评分排序后调用）
+// 双重信号币种同时计入两个来源的名额，且只有两个来源都还有名额时才入选；由于双重信号评分更高、排序靠前，通常会优先占用名额
+// 返回限制后的副本，不修改 ctx.CandidateCoins（复用 Context 的调用方仍能拿到完整候选池）
+func capCandidatesPerSource(ctx *Context) []CandidateCoin {
+	if len(ctx.SourceCaps) == 0 {
+		return append([]CandidateCoin(nil), ctx.CandidateCoins...)
+	}
+
+	counts := make(map[string]int)
+	kept := make([]CandidateCoin, 0, len(ctx.CandidateCoins))
+	for _, coin := range ctx.CandidateCoins {
+		full := false
+		for _, source := range coin.Sources {
+			if limit := ctx.SourceCaps[source]; limit > 0 && counts[source] >= limit {
+				full = true
+				break
+			}
+		}
+		if full {
+			continue
+		}
+		for _, source := range coin.Sources {
+			counts[source]++
+		}
+		kept = append(kept, coin)
+	}
+	return kept
+}
+
+// CollectCandidates 从通道接收候选币种追加到上下文，直到通道关闭或到达截止时间，返回新收到的数量
+// 截止时间之后到达的候选币种不会进入本周期；同一币种多次到达时合并来源
+func CollectCandidates(ctx *Context, ch <-chan CandidateCoin, deadline time.Time) int {
+	index := make(map[string]int, len(ctx.CandidateCoins))
+	for i, coin := range ctx.CandidateCoins {
+		index[coin.Symbol] = i
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	received := 0
+	for time.Now().Before(deadline) {
+		select {
+		case coin, ok := <-ch:
+			if !ok {
+				return received
+			}
+			received++
+			if i, exists := index[coin.Symbol]; exists {
+				ctx.CandidateCoins[i].Sources = mergeSources(ctx.CandidateCoins[i].Sources, coin.Sources)
+				continue
+			}
+			index[coin.Symbol] = len(ctx.CandidateCoins)
+			ctx.CandidateCoins = append(ctx.CandidateCoins, coin)
+		case <-timer.C:
+			return received
+		}
+	}
+	return received
+}
+
+// mergeSources 合并来源列表（去重，保持顺序）
+func mergeSources(a, b []string) []string {
+	merged := append([]string(nil), a...)
+	for _, source := range b {
+		found := false
+		for _, existing := range merged {
+			if existing == source {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, source)
+		}
+	}
+	return merged
+}
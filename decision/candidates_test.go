@@ -0,0 +1,268 @@
+package decision
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"nofx/market"
+)
+
+func TestRankCandidatesDualSourceFirst(t *testing.T) {
+	ctx := &Context{
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "AAAUSDT", Sources: []string{"ai500"}},
+			{Symbol: "BBBUSDT", Sources: []string{"oi_top"}},
+			{Symbol: "CCCUSDT", Sources: []string{"ai500", "oi_top"}},
+		},
+		OITopDataMap: map[string]*OITopData{
+			"BBBUSDT": {Rank: 1, OIDeltaPercent: 5},
+			"CCCUSDT": {Rank: 2, OIDeltaPercent: 2},
+		},
+	}
+	rankCandidates(ctx)
+	if got := ctx.CandidateCoins[0].Symbol; got != "CCCUSDT" {
+		t.Errorf("双重信号应排第一, got %s (%+v)", got, ctx.CandidateCoins)
+	}
+	if got := ctx.CandidateCoins[1].Symbol; got != "BBBUSDT" {
+		t.Errorf("OI变化的单一来源应排在无OI数据的之前, got %s", got)
+	}
+}
+
+func TestScoreCandidateOIDelta(t *testing.T) {
+	coin := CandidateCoin{Symbol: "AAAUSDT", Sources: []string{"oi_top"}}
+	low := ScoreCandidate(coin, &OITopData{OIDeltaPercent: 2}, DefaultCandidateScoreWeights)
+	high := ScoreCandidate(coin, &OITopData{OIDeltaPercent: -8}, DefaultCandidateScoreWeights)
+	if high <= low {
+		t.Errorf("OI变化幅度更大（含负向）应得分更高: %.2f <= %.2f", high, low)
+	}
+	if got := ScoreCandidate(coin, nil, DefaultCandidateScoreWeights); got != 1 {
+		t.Errorf("无OI数据时只计来源分, got %.2f", got)
+	}
+}
+
+func TestCapCandidatesPerSource(t *testing.T) {
+	ctx := &Context{
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "A1USDT", Sources: []string{"ai500"}},
+			{Symbol: "O1USDT", Sources: []string{"oi_top"}},
+			{Symbol: "A2USDT", Sources: []string{"ai500"}},
+			{Symbol: "O2USDT", Sources: []string{"oi_top"}},
+			{Symbol: "A3USDT", Sources: []string{"ai500"}},
+			{Symbol: "O3USDT", Sources: []string{"oi_top"}},
+		},
+		SourceCaps: map[string]int{"ai500": 2, "oi_top": 1},
+	}
+	capped := capCandidatesPerSource(ctx)
+
+	counts := make(map[string]int)
+	var symbols []string
+	for _, coin := range capped {
+		symbols = append(symbols, coin.Symbol)
+		for _, source := range coin.Sources {
+			counts[source]++
+		}
+	}
+	if counts["ai500"] != 2 || counts["oi_top"] != 1 {
+		t.Errorf("各来源应按上限保留: %v (%v)", counts, symbols)
+	}
+	if strings.Join(symbols, ",") != "A1USDT,O1USDT,A2USDT" {
+		t.Errorf("应按排序保留靠前的币种: %v", symbols)
+	}
+	if len(ctx.CandidateCoins) != 6 {
+		t.Errorf("不应修改上下文中的候选池，剩余 %d 个", len(ctx.CandidateCoins))
+	}
+
+	// 未配置上限时返回完整副本
+	ctx.SourceCaps = nil
+	all := capCandidatesPerSource(ctx)
+	all[0].Symbol = "CHANGED"
+	if len(all) != 6 || ctx.CandidateCoins[0].Symbol != "A1USDT" {
+		t.Errorf("未配置上限时应返回候选池的副本: %v", all)
+	}
+}
+
+func TestCollectCandidatesDeadline(t *testing.T) {
+	ctx := stubContext()
+	ctx.MarketData.(stubMarketData)["XRPUSDT"] = testMarketData("XRPUSDT", 2)
+	ctx.CandidateCoins = []CandidateCoin{{Symbol: "ETHUSDT", Sources: []string{"ai500"}}}
+
+	ch := make(chan CandidateCoin)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ch <- CandidateCoin{Symbol: "SOLUSDT", Sources: []string{"oi_top"}}
+		ch <- CandidateCoin{Symbol: "ETHUSDT", Sources: []string{"oi_top"}}
+		time.Sleep(200 * time.Millisecond)
+		select { // 截止时间后无人接收
+		case ch <- CandidateCoin{Symbol: "XRPUSDT", Sources: []string{"ai500"}}:
+		case <-time.After(100 * time.Millisecond):
+		}
+	}()
+
+	if got := CollectCandidates(ctx, ch, time.Now().Add(50*time.Millisecond)); got != 2 {
+		t.Errorf("截止前收到 %d 个, want 2", got)
+	}
+	<-done
+
+	if err := fetchMarketDataForContext(context.Background(), ctx); err != nil {
+		t.Fatalf("fetchMarketDataForContext: %v", err)
+	}
+	if _, ok := ctx.MarketDataMap["XRPUSDT"]; ok {
+		t.Error("截止时间后到达的候选币种不应被分析")
+	}
+	for _, symbol := range []string{"ETHUSDT", "SOLUSDT"} {
+		if _, ok := ctx.MarketDataMap[symbol]; !ok {
+			t.Errorf("截止前到达的 %s 应被分析", symbol)
+		}
+	}
+	for _, coin := range ctx.CandidateCoins {
+		if coin.Symbol == "ETHUSDT" && strings.Join(coin.Sources, ",") != "ai500,oi_top" {
+			t.Errorf("重复到达的币种应合并来源, got %v", coin.Sources)
+		}
+	}
+}
+
+func TestCollectCandidatesClosedChannel(t *testing.T) {
+	ctx := &Context{}
+	ch := make(chan CandidateCoin, 1)
+	ch <- CandidateCoin{Symbol: "SOLUSDT"}
+	close(ch)
+
+	start := time.Now()
+	if got := CollectCandidates(ctx, ch, start.Add(time.Minute)); got != 1 || len(ctx.CandidateCoins) != 1 {
+		t.Errorf("received = %d, candidates = %d, want 1", got, len(ctx.CandidateCoins))
+	}
+	if time.Since(start) > time.Second {
+		t.Error("通道关闭后应立即返回，不等待截止时间")
+	}
+}
+
+func TestAdmitMarketDataVolumeFallback(t *testing.T) {
+	lowOI := func(volume float64) *market.Data {
+		data := testMarketData("NEWUSDT", 1)
+		data.OpenInterest = &market.OIData{Latest: 1_000_000} // 持仓价值1M USD，低于15M
+		data.QuoteVolume24h = volume
+		return data
+	}
+
+	ctx := &Context{MinVolume24hUSD: 10_000_000}
+	if !admitMarketData("NEWUSDT", lowOI(20_000_000), ctx) {
+		t.Error("OI低但成交额达标的币种应保留")
+	}
+	if admitMarketData("NEWUSDT", lowOI(1_000_000), ctx) {
+		t.Error("OI低且成交额不足的币种应过滤")
+	}
+	if admitMarketData("NEWUSDT", lowOI(20_000_000), &Context{}) {
+		t.Error("未配置成交额下限时按OI过滤")
+	}
+	if !admitMarketData("ETHUSDT", testMarketData("ETHUSDT", 3000), ctx) {
+		t.Error("OI达标的币种应保留")
+	}
+}
+
+func TestMaxRenderedCandidates(t *testing.T) {
+	ctx := testContext()
+	ctx.CandidateCoins = []CandidateCoin{
+		{Symbol: "ETHUSDT", Sources: []string{"ai500"}, Score: 2},
+		{Symbol: "SOLUSDT", Sources: []string{"ai500"}, Score: 5},
+		{Symbol: "XRPUSDT", Sources: []string{"ai500"}, Score: 1},
+		{Symbol: "DOGEUSDT", Sources: []string{"ai500"}, Score: 3},
+	}
+	ctx.MarketDataMap["XRPUSDT"] = testMarketData("XRPUSDT", 2)
+	ctx.MarketDataMap["DOGEUSDT"] = testMarketData("DOGEUSDT", 0.3)
+	ctx.MaxRenderedCandidates = 2
+
+	prompt := buildUserPrompt(ctx)
+	_, candidates, _ := strings.Cut(prompt, "## 候选币种 (2个)")
+	if candidates == "" {
+		t.Fatalf("应只展示2个候选币种:\n%s", prompt)
+	}
+	first := strings.Index(candidates, "### 1. SOLUSDT")
+	second := strings.Index(candidates, "### 2. DOGEUSDT")
+	if first < 0 || second < first {
+		t.Errorf("应按评分展示SOL、DOGE:\n%s", candidates)
+	}
+	for _, symbol := range []string{"ETHUSDT", "XRPUSDT"} {
+		if strings.Contains(candidates, ". "+symbol) {
+			t.Errorf("评分较低的 %s 不应展示", symbol)
+		}
+	}
+	if len(ctx.MarketDataMap) != 5 {
+		t.Error("未展示的币种数据仍应保留")
+	}
+}
+
+func TestSkipCandidatesWhenFull(t *testing.T) {
+	tests := []struct {
+		name       string
+		configure  func(ctx *Context)
+		candidates int
+	}{
+		{"可以开仓", func(ctx *Context) {}, 2},
+		{"达到持仓上限", func(ctx *Context) { ctx.MaxPositions = 1 }, 0},
+		{"保证金使用率达到上限", func(ctx *Context) { ctx.Account.MarginUsedPct = 95 }, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			provider := &countingMarketData{stubMarketData: stubMarketData(ctx.MarketDataMap)}
+			ctx.MarketData = provider
+			ctx.SkipCandidatesWhenFull = true
+			tt.configure(ctx)
+
+			if err := fetchMarketDataForContext(context.Background(), ctx); err != nil {
+				t.Fatalf("fetchMarketDataForContext: %v", err)
+			}
+			if provider.fetched["BTCUSDT"] != 1 {
+				t.Error("持仓币种始终需要获取")
+			}
+			if got := provider.fetched["ETHUSDT"] + provider.fetched["SOLUSDT"]; got != tt.candidates {
+				t.Errorf("候选币种获取次数 = %d, want %d", got, tt.candidates)
+			}
+		})
+	}
+}
+
+func TestRankCandidatesByOIRank(t *testing.T) {
+	newCtx := func() *Context {
+		return &Context{
+			CandidateCoins: []CandidateCoin{
+				{Symbol: "AAAUSDT", Sources: []string{"oi_top"}},
+				{Symbol: "BBBUSDT", Sources: []string{"oi_top"}},
+			},
+			OITopDataMap: map[string]*OITopData{
+				"AAAUSDT": {Rank: 8, OIDeltaPercent: 5},
+				"BBBUSDT": {Rank: 1, OIDeltaPercent: 5},
+			},
+		}
+	}
+
+	ctx := newCtx()
+	rankCandidates(ctx)
+	if ctx.CandidateCoins[0].Symbol != "AAAUSDT" {
+		t.Error("未启用排名加权时评分相同，应保持原有顺序")
+	}
+
+	ctx = newCtx()
+	ctx.CandidateWeights = DefaultCandidateScoreWeights
+	ctx.CandidateWeights.OIRank = 1
+	rankCandidates(ctx)
+	if ctx.CandidateCoins[0].Symbol != "BBBUSDT" {
+		t.Errorf("排名第1的币种应排在前面: %+v", ctx.CandidateCoins)
+	}
+}
+
+func TestUserPromptOIRank(t *testing.T) {
+	ctx := testContext()
+	ctx.OITopDataMap = map[string]*OITopData{"SOLUSDT": {Rank: 3, OIDeltaPercent: 12.5}}
+
+	prompt := buildUserPrompt(ctx)
+	if block := symbolBlock(prompt, "### 2. SOLUSDT"); !strings.Contains(block, "🔥 OI增长榜第3名（1小时OI变化+12.50%）") {
+		t.Errorf("SOL应渲染OI排名:\n%s", block)
+	}
+	if block := symbolBlock(prompt, "### 1. ETHUSDT"); strings.Contains(block, "OI增长榜") {
+		t.Errorf("没有OI数据的币种不应渲染排名:\n%s", block)
+	}
+}
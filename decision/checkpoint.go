@@ -0,0 +1,93 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// contextCheckpoint Context 的检查点（包含通常不序列化的市场数据和配置）
+// Config 由 checkpointFields 从 Context 的字段定义推导，新增的配置字段无需在此登记；
+// LimitsProvider、Store、Enricher 等接口和函数无法序列化，恢复后由调用方重新设置
+type contextCheckpoint struct {
+	Context     json.RawMessage            `json:"context"` // Context 本身可序列化的字段
+	Config      map[string]json.RawMessage `json:"config"`  // json:"-" 的可序列化字段（按字段名）
+	Performance json.RawMessage            `json:"performance,omitempty"`
+}
+
+// checkpointFields 返回需要写入检查点的 Context 字段：所有导出的 json:"-" 字段，
+// 除接口（由调用方注入的依赖，Performance 单独处理）和函数类型外
+func checkpointFields() []reflect.StructField {
+	t := reflect.TypeOf(Context{})
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("json") != "-" {
+			continue
+		}
+		if k := f.Type.Kind(); k == reflect.Interface || k == reflect.Func {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// MarshalCheckpoint 序列化完整的上下文（含市场数据），用于崩溃恢复或确定性地重放一个周期
+func (ctx *Context) MarshalCheckpoint() ([]byte, error) {
+	base, err := json.Marshal(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("序列化上下文失败: %w", err)
+	}
+	var perf json.RawMessage
+	if ctx.Performance != nil {
+		if perf, err = json.Marshal(ctx.Performance); err != nil {
+			return nil, fmt.Errorf("序列化历史表现失败: %w", err)
+		}
+	}
+
+	v := reflect.ValueOf(ctx).Elem()
+	config := make(map[string]json.RawMessage)
+	for _, f := range checkpointFields() {
+		raw, err := json.Marshal(v.FieldByIndex(f.Index).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("序列化上下文字段 %s 失败: %w", f.Name, err)
+		}
+		config[f.Name] = raw
+	}
+
+	return json.Marshal(contextCheckpoint{
+		Context:     base,
+		Config:      config,
+		Performance: perf,
+	})
+}
+
+// LoadCheckpoint 从检查点恢复上下文；恢复的上下文在下一次 GetFullDecision 中直接使用检查点里的市场数据，不重新获取
+func LoadCheckpoint(data []byte) (*Context, error) {
+	var cp contextCheckpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("解析检查点失败: %w", err)
+	}
+
+	ctx := &Context{}
+	if err := json.Unmarshal(cp.Context, ctx); err != nil {
+		return nil, fmt.Errorf("解析检查点上下文失败: %w", err)
+	}
+	if len(cp.Performance) > 0 {
+		ctx.Performance = cp.Performance
+	}
+
+	v := reflect.ValueOf(ctx).Elem()
+	for _, f := range checkpointFields() {
+		raw, ok := cp.Config[f.Name]
+		if !ok {
+			continue // 旧版本检查点中没有的字段保持零值
+		}
+		if err := json.Unmarshal(raw, v.FieldByIndex(f.Index).Addr().Interface()); err != nil {
+			return nil, fmt.Errorf("解析检查点字段 %s 失败: %w", f.Name, err)
+		}
+	}
+	ctx.restored = ctx.MarketDataMap != nil
+	return ctx, nil
+}
@@ -0,0 +1,167 @@
+package decision
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"nofx/market"
+)
+
+// testMarketData 构造渲染prompt所需的最小市场数据
+func testMarketData(symbol string, price float64) *market.Data {
+	return &market.Data{
+		Symbol:        symbol,
+		CurrentPrice:  price,
+		PriceChange1h: 0.5,
+		PriceChange4h: -1.2,
+		CurrentEMA20:  price * 0.99,
+		CurrentMACD:   0.01,
+		CurrentRSI7:   55,
+		OpenInterest:  &market.OIData{Latest: 1000000, Average: 900000},
+		FundingRate:   0.0001,
+		IntradaySeries: &market.IntradayData{
+			MidPrices:   []float64{price, price},
+			EMA20Values: []float64{price, price},
+			MACDValues:  []float64{0.01, 0.02},
+			RSI7Values:  []float64{50, 55},
+			RSI14Values: []float64{50, 52},
+		},
+		LongerTermContext: &market.LongerTermData{
+			EMA20:         price,
+			EMA50:         price * 0.98,
+			ATR3:          price * 0.01,
+			ATR14:         price * 0.02,
+			CurrentVolume: 100,
+			AverageVolume: 90,
+			MACDValues:    []float64{0.1},
+			RSI14Values:   []float64{50},
+		},
+	}
+}
+
+// testContext 构造一个带持仓、候选币种和市场数据的上下文
+func testContext() *Context {
+	return &Context{
+		CurrentTime:    "2026-01-01 00:00:00",
+		RuntimeMinutes: 30,
+		CallCount:      5,
+		Account: AccountInfo{
+			TotalEquity:      1000,
+			AvailableBalance: 800,
+			MarginUsedPct:    20,
+			PositionCount:    1,
+		},
+		Positions: []PositionInfo{
+			{Symbol: "BTCUSDT", Side: "long", EntryPrice: 100000, MarkPrice: 101000, Quantity: 0.01, Leverage: 5, LiquidationPrice: 80000, MarginUsed: 200},
+		},
+		CandidateCoins: []CandidateCoin{
+			{Symbol: "ETHUSDT", Sources: []string{"ai500"}},
+			{Symbol: "SOLUSDT", Sources: []string{"ai500", "oi_top"}},
+		},
+		MarketDataMap: map[string]*market.Data{
+			"BTCUSDT": testMarketData("BTCUSDT", 101000),
+			"ETHUSDT": testMarketData("ETHUSDT", 3000),
+			"SOLUSDT": testMarketData("SOLUSDT", 150),
+		},
+		BTCETHLeverage:  5,
+		AltcoinLeverage: 5,
+	}
+}
+
+func TestCheckpointRoundTripPrompt(t *testing.T) {
+	enabled := false
+	ctx := testContext()
+	ctx.MaxPositions = 5
+	ctx.PreviousEquity = 1200
+	ctx.SharpeWindow = 12 * time.Hour
+	ctx.MinVolume24hUSD = 5e6
+	ctx.LowLiquidityWindows = []LiquidityWindow{{Weekdays: []time.Weekday{time.Saturday}, StartHour: 0, EndHour: 24}}
+	ctx.RetryOnRejection = true
+	ctx.ConfirmReasoningMaxChars = 120
+	ctx.ReconcileDropGhosts = true
+	ctx.MaxRenderedCandidates = 1
+	ctx.SkipCandidatesWhenFull = true
+	ctx.SymbolNotes = map[string]string{"SOLUSDT": "下周解锁，避免做多"}
+	ctx.AcceptPartial = true
+	ctx.MaxConcurrentFetches = 2
+	ctx.PositionFetchAttempts = 4
+	ctx.PositionFetchBackoff = time.Second
+	ctx.ExtraSections = []string{"## 情绪指标\n恐慌贪婪指数: 72"}
+	ctx.TradingEnabled = &enabled
+	ctx.Risk = RiskConfig{MaxTotalRiskPct: 5, MaxHoldingDuration: 4 * time.Hour}
+	ctx.SharpeHaltStartCycle = 3
+
+	data, err := ctx.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("MarshalCheckpoint: %v", err)
+	}
+	restored, err := LoadCheckpoint(data)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+
+	if got, want := buildUserPrompt(restored), buildUserPrompt(ctx); got != want {
+		t.Errorf("恢复后 User Prompt 不一致\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+	if got, want := buildSystemPrompt(restored, ""), buildSystemPrompt(ctx, ""); got != want {
+		t.Errorf("恢复后 System Prompt 不一致\n--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+
+	orig := reflect.ValueOf(ctx).Elem()
+	back := reflect.ValueOf(restored).Elem()
+	for _, f := range checkpointFields() {
+		if !reflect.DeepEqual(orig.FieldByIndex(f.Index).Interface(), back.FieldByIndex(f.Index).Interface()) {
+			t.Errorf("字段 %s 未在检查点中保留", f.Name)
+		}
+	}
+	if !restored.restored {
+		t.Error("带市场数据的检查点应标记为已恢复")
+	}
+}
+
+func TestCheckpointFieldsCoverConfig(t *testing.T) {
+	names := make(map[string]bool)
+	for _, f := range checkpointFields() {
+		names[f.Name] = true
+	}
+	for _, name := range []string{"MaxPositions", "SymbolNotes", "ExtraSections", "TradingEnabled", "Risk", "MarketDataMap"} {
+		if !names[name] {
+			t.Errorf("检查点缺少字段 %s", name)
+		}
+	}
+	for _, name := range []string{"LimitsProvider", "LivePositions", "MarketData", "Store", "Enricher", "Performance"} {
+		if names[name] {
+			t.Errorf("检查点不应包含不可序列化的字段 %s", name)
+		}
+	}
+}
+
+func TestCheckpointKeepsKillSwitch(t *testing.T) {
+	disabled := false
+	ctx := testContext()
+	ctx.TradingEnabled = &disabled
+
+	data, err := ctx.MarshalCheckpoint()
+	if err != nil {
+		t.Fatalf("MarshalCheckpoint: %v", err)
+	}
+	restored, err := LoadCheckpoint(data)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint: %v", err)
+	}
+	if restored.TradingEnabled == nil || *restored.TradingEnabled {
+		t.Fatalf("恢复后交易开关应保持关闭，got %v", restored.TradingEnabled)
+	}
+	if restored.tradingEnabled() {
+		t.Fatal("恢复后 tradingEnabled() 应为 false")
+	}
+
+	decisions := []Decision{{Symbol: "ETHUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 100, StopLoss: 2900, TakeProfit: 3300, Reasoning: "突破"}}
+	if err := validateDecisions(decisions, restored); err != nil {
+		t.Fatalf("观察模式下的决策应通过验证: %v", err)
+	}
+	if decisions[0].Action != "wait" {
+		t.Errorf("恢复后开仓应降级为观望，got %s", decisions[0].Action)
+	}
+}
@@ -0,0 +1,67 @@
+package decision
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultConfirmReasoningMaxChars 确认提示词中每个决策理由的默认最大字符数
+const defaultConfirmReasoningMaxChars = 300
+
+// BuildConfirmationPrompt 构建二次确认用的精简 User Prompt：只包含待执行的决策、决策理由（按 ConfirmReasoningMaxChars 截断）
+// 和相关币种的市场快照，不重复发送完整的候选币种数据，使确认调用保持低成本
+// 没有需要确认的决策（全部为 hold/wait）时返回空字符串
+func BuildConfirmationPrompt(decisions []Decision, ctx *Context) string {
+	var sb strings.Builder
+	count := 0
+	for _, d := range decisions {
+		if d.Action == "hold" || d.Action == "wait" {
+			continue
+		}
+		count++
+		sb.WriteString(fmt.Sprintf("### %d. %s %s\n", count, d.Symbol, d.Action))
+		if isOpenAction(d.Action) || isAddAction(d.Action) {
+			sb.WriteString(fmt.Sprintf("杠杆%dx | 仓位%.2f USD | 止损%.4f | 止盈%.4f | 信心度%d\n",
+				d.Leverage, d.PositionSizeUSD, d.StopLoss, d.TakeProfit, d.Confidence))
+		} else if d.ClosePercentage > 0 {
+			sb.WriteString(fmt.Sprintf("平仓比例%.0f%%\n", d.ClosePercentage))
+		}
+		if pos := findPosition(ctx, d.Symbol, positionSide(d.Action)); pos != nil {
+			sb.WriteString(fmt.Sprintf("当前持仓: 入场价%.4f 标记价%.4f 盈亏%+.2f%% 杠杆%dx\n",
+				pos.EntryPrice, pos.MarkPrice, pos.UnrealizedPnLPct, pos.Leverage))
+		}
+		if data, ok := ctx.MarketDataMap[d.Symbol]; ok && data != nil {
+			sb.WriteString(fmt.Sprintf("市场快照: 价格%.4f (1h: %+.2f%%, 4h: %+.2f%%) | RSI7: %.2f | MACD: %.4f | 资金费率: %.4f%%\n",
+				data.CurrentPrice, data.PriceChange1h, data.PriceChange4h, data.CurrentRSI7, data.CurrentMACD, data.FundingRate*100))
+		}
+		sb.WriteString(fmt.Sprintf("理由: %s\n\n", truncateRunes(d.Reasoning, confirmReasoningMaxChars(ctx))))
+	}
+	if count == 0 {
+		return ""
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString(fmt.Sprintf("时间: %s | 账户净值%.2f | 可用余额%.2f | 持仓%d个\n\n",
+		ctx.CurrentTime, ctx.Account.TotalEquity, ctx.Account.AvailableBalance, ctx.Account.PositionCount))
+	prompt.WriteString(fmt.Sprintf("## 待确认决策 (%d个)\n\n", count))
+	prompt.WriteString(sb.String())
+	prompt.WriteString("---\n\n请逐个判断以上决策是否应该执行，对不应执行的决策说明原因。\n")
+	return prompt.String()
+}
+
+// confirmReasoningMaxChars 返回确认提示词中决策理由的最大字符数（负数表示不截断）
+func confirmReasoningMaxChars(ctx *Context) int {
+	if ctx.ConfirmReasoningMaxChars == 0 {
+		return defaultConfirmReasoningMaxChars
+	}
+	return ctx.ConfirmReasoningMaxChars
+}
+
+// truncateRunes 按字符（而非字节）截断文本，超出时追加省略号；limit<0 时不截断
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if limit < 0 || len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
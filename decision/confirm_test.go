@@ -0,0 +1,47 @@
+package decision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildConfirmationPrompt(t *testing.T) {
+	ctx := testContext()
+	ctx.ConfirmReasoningMaxChars = 10
+
+	open := testOpens()[0]
+	open.Reasoning = strings.Repeat("突破", 20)
+	decisions := []Decision{
+		open,
+		{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈"},
+		{Symbol: "SOLUSDT", Action: "wait", Reasoning: "观望"},
+	}
+
+	prompt := BuildConfirmationPrompt(decisions, ctx)
+	for _, want := range []string{
+		"## 待确认决策 (2个)",
+		"### 1. ETHUSDT open_long",
+		"杠杆3x | 仓位300.00 USD | 止损2940.0000 | 止盈3300.0000",
+		"市场快照: 价格3000.0000",
+		"理由: " + strings.Repeat("突破", 5) + "…\n",
+		"### 2. BTCUSDT close_long",
+		"当前持仓: 入场价100000.0000 标记价101000.0000",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("确认提示词缺少 %q:\n%s", want, prompt)
+		}
+	}
+	// 不包含完整的候选币种数据
+	for _, unwanted := range []string{"SOLUSDT", "## 候选币种", "current_price"} {
+		if strings.Contains(prompt, unwanted) {
+			t.Errorf("确认提示词不应包含 %q:\n%s", unwanted, prompt)
+		}
+	}
+	if len(prompt) >= len(buildUserPrompt(ctx)) {
+		t.Error("确认提示词应比完整的User Prompt短")
+	}
+
+	if got := BuildConfirmationPrompt(decisions[2:], ctx); got != "" {
+		t.Errorf("没有需要确认的决策时应返回空: %q", got)
+	}
+}
@@ -0,0 +1,155 @@
+package decision
+
+import (
+	"fmt"
+	"math"
+)
+
+// diffRelTolerance 数值字段的相对容差，变化不超过该比例视为相同（避免浮点误差产生噪音）
+const diffRelTolerance = 0.001
+
+// ActionChange 同一币种的决策动作变化
+type ActionChange struct {
+	Symbol string `json:"symbol"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// FieldDelta 同一币种决策的数值字段变化
+type FieldDelta struct {
+	Symbol string  `json:"symbol"`
+	Field  string  `json:"field"` // JSON字段名（如 stop_loss）
+	From   float64 `json:"from"`
+	To     float64 `json:"to"`
+}
+
+// FullDecisionDiff 两次决策输出的差异（忽略时间戳、提示词等非决策内容）
+type FullDecisionDiff struct {
+	ActionChanges []ActionChange `json:"action_changes,omitempty"` // 动作变化
+	FieldDeltas   []FieldDelta   `json:"field_deltas,omitempty"`   // 数值字段变化（动作相同时才比较）
+	Added         []Decision     `json:"added,omitempty"`          // b 中新增的决策
+	Removed       []Decision     `json:"removed,omitempty"`        // a 中被移除的决策
+}
+
+// Empty 判断两次决策是否没有差异
+func (d FullDecisionDiff) Empty() bool {
+	return len(d.ActionChanges) == 0 && len(d.FieldDeltas) == 0 && len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+// DiffFullDecisions 比较两次决策输出，用于修改提示词或验证逻辑后的回归对比
+// 决策按"交易所|币种"和出现顺序配对，配对成功的比较动作和数值字段，未配对的记为新增或移除
+func DiffFullDecisions(a, b *FullDecision) FullDecisionDiff {
+	var diff FullDecisionDiff
+	before := groupDecisions(a)
+	after := groupDecisions(b)
+
+	for _, key := range orderedKeys(a, b) {
+		olds, news := before[key], after[key]
+		n := len(olds)
+		if len(news) < n {
+			n = len(news)
+		}
+		for i := 0; i < n; i++ {
+			oldD, newD := olds[i], news[i]
+			if oldD.Action != newD.Action {
+				diff.ActionChanges = append(diff.ActionChanges, ActionChange{Symbol: newD.Symbol, From: oldD.Action, To: newD.Action})
+				continue
+			}
+			diff.FieldDeltas = append(diff.FieldDeltas, decisionFieldDeltas(oldD, newD)...)
+		}
+		diff.Removed = append(diff.Removed, olds[n:]...)
+		diff.Added = append(diff.Added, news[n:]...)
+	}
+	return diff
+}
+
+// decisionKey 决策的配对键（交易所|币种）
+func decisionKey(d Decision) string {
+	return d.Exchange + "|" + d.Symbol
+}
+
+// groupDecisions 按配对键分组（保持原有顺序）
+func groupDecisions(fd *FullDecision) map[string][]Decision {
+	groups := make(map[string][]Decision)
+	if fd == nil {
+		return groups
+	}
+	for _, d := range fd.Decisions {
+		key := decisionKey(d)
+		groups[key] = append(groups[key], d)
+	}
+	return groups
+}
+
+// orderedKeys 按首次出现顺序返回两次决策的全部配对键，保证差异输出稳定
+func orderedKeys(a, b *FullDecision) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, fd := range []*FullDecision{a, b} {
+		if fd == nil {
+			continue
+		}
+		for _, d := range fd.Decisions {
+			if key := decisionKey(d); !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// decisionFieldDeltas 比较同一动作决策的数值字段，返回超出容差的变化
+func decisionFieldDeltas(a, b Decision) []FieldDelta {
+	fields := []struct {
+		name     string
+		from, to float64
+	}{
+		{"leverage", float64(a.Leverage), float64(b.Leverage)},
+		{"position_size_usd", a.PositionSizeUSD, b.PositionSizeUSD},
+		{"stop_loss", a.StopLoss, b.StopLoss},
+		{"take_profit", a.TakeProfit, b.TakeProfit},
+		{"confidence", float64(a.Confidence), float64(b.Confidence)},
+		{"risk_usd", a.RiskUSD, b.RiskUSD},
+		{"close_percentage", a.ClosePercentage, b.ClosePercentage},
+		{"slippage_bps", float64(a.SlippageBps), float64(b.SlippageBps)},
+		{"limit_price", a.LimitPrice, b.LimitPrice},
+		{"new_stop_loss", derefFloat(a.NewStopLoss), derefFloat(b.NewStopLoss)},
+	}
+
+	var deltas []FieldDelta
+	for _, f := range fields {
+		if !withinTolerance(f.from, f.to) {
+			deltas = append(deltas, FieldDelta{Symbol: b.Symbol, Field: f.name, From: f.from, To: f.to})
+		}
+	}
+	if len(a.TakeProfitLevels) != len(b.TakeProfitLevels) {
+		deltas = append(deltas, FieldDelta{Symbol: b.Symbol, Field: "take_profit_levels.len",
+			From: float64(len(a.TakeProfitLevels)), To: float64(len(b.TakeProfitLevels))})
+	} else {
+		for i := range a.TakeProfitLevels {
+			if !withinTolerance(a.TakeProfitLevels[i], b.TakeProfitLevels[i]) {
+				deltas = append(deltas, FieldDelta{Symbol: b.Symbol, Field: fmt.Sprintf("take_profit_levels[%d]", i),
+					From: a.TakeProfitLevels[i], To: b.TakeProfitLevels[i]})
+			}
+		}
+	}
+	return deltas
+}
+
+// withinTolerance 判断两个数值的相对差异是否在容差内
+func withinTolerance(a, b float64) bool {
+	scale := math.Max(math.Abs(a), math.Abs(b))
+	if scale == 0 {
+		return true
+	}
+	return math.Abs(a-b)/scale <= diffRelTolerance
+}
+
+// derefFloat 返回指针指向的值（nil时为0）
+func derefFloat(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -0,0 +1,45 @@
+package decision
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffFullDecisions(t *testing.T) {
+	base := func() *FullDecision {
+		return &FullDecision{Decisions: testOpens(), Timestamp: time.Now()}
+	}
+
+	a, b := base(), base()
+	b.Timestamp = a.Timestamp.Add(time.Hour)
+	b.UserPrompt = "不同的prompt"
+	b.Decisions[0].StopLoss += 0.5 // 相对变化0.017%，在容差内
+	if diff := DiffFullDecisions(a, b); !diff.Empty() {
+		t.Errorf("相同决策不应有差异: %+v", diff)
+	}
+
+	b = base()
+	b.Decisions[1].Action = "wait"
+	diff := DiffFullDecisions(a, b)
+	if len(diff.ActionChanges) != 1 || diff.ActionChanges[0] != (ActionChange{Symbol: "SOLUSDT", From: "open_short", To: "wait"}) {
+		t.Errorf("应报告动作变化: %+v", diff)
+	}
+	if len(diff.FieldDeltas) != 0 || len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Errorf("不应有其他差异: %+v", diff)
+	}
+
+	b = base()
+	b.Decisions[0].StopLoss = 2900
+	b.Decisions = append(b.Decisions, Decision{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈"})
+	diff = DiffFullDecisions(a, b)
+	if len(diff.FieldDeltas) != 1 || diff.FieldDeltas[0] != (FieldDelta{Symbol: "ETHUSDT", Field: "stop_loss", From: 2940, To: 2900}) {
+		t.Errorf("应报告止损变化: %+v", diff.FieldDeltas)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].Symbol != "BTCUSDT" || len(diff.Removed) != 0 {
+		t.Errorf("应报告新增决策: %+v", diff)
+	}
+
+	if diff := DiffFullDecisions(b, a); len(diff.Removed) != 1 || diff.Removed[0].Symbol != "BTCUSDT" {
+		t.Errorf("反向比较应报告移除的决策: %+v", diff)
+	}
+}
@@ -0,0 +1,131 @@
+package decision
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 指标偏差的标记阈值
+const (
+	driftRRThreshold        = 0.5 // AI报告的风险回报比比计算值高出0.5以上
+	driftChecklistThreshold = 2   // AI报告的检查项通过数比计算值多2项以上
+	driftOIStrengthMin      = 0.3 // 计算的OI信号强度绝对值达到0.3才判断方向是否矛盾
+)
+
+// MetricDrift 单个开仓决策中AI自评指标与引擎独立计算值的偏差（用于发现AI编造自我评估）
+type MetricDrift struct {
+	Symbol string `json:"symbol"`
+
+	ReportedRR float64 `json:"reported_rr,omitempty"` // AI报告的风险回报比
+	ComputedRR float64 `json:"computed_rr"`           // 按当前价、止损、止盈计算的风险回报比
+
+	ReportedChecklist int `json:"reported_checklist,omitempty"` // AI报告的检查项通过数
+	ComputedChecklist int `json:"computed_checklist"`           // 引擎按市场数据计算的检查项通过数（满分 engineChecklistSize）
+
+	ReportedOISignal string  `json:"reported_oi_signal,omitempty"` // AI报告的OI信号
+	ComputedOISignal float64 `json:"computed_oi_signal"`           // 引擎计算的OI信号强度（-1~+1）
+
+	Flags []string `json:"flags,omitempty"` // 超出阈值的偏差说明（为空表示一致）
+}
+
+// engineChecklistSize 引擎检查项总数（见 engineChecklist）
+const engineChecklistSize = 5
+
+// ComputeMetricDrift 对每个开仓决策比较AI自评指标与引擎计算值
+func ComputeMetricDrift(decisions []Decision, ctx *Context) []MetricDrift {
+	var drifts []MetricDrift
+	for i := range decisions {
+		d := &decisions[i]
+		if !isOpenAction(d.Action) {
+			continue
+		}
+
+		drift := MetricDrift{
+			Symbol:            d.Symbol,
+			ReportedRR:        d.RiskRewardRatio,
+			ComputedRR:        computedRiskReward(d, decisionEntryPrice(d, ctx)),
+			ReportedChecklist: d.ChecklistPassed,
+			ComputedChecklist: engineChecklist(d, ctx),
+			ReportedOISignal:  d.OISignal,
+		}
+		if oi, ok := ctx.OITopDataMap[d.Symbol]; ok {
+			drift.ComputedOISignal = oi.SignalStrength
+		}
+
+		if d.RiskRewardRatio > 0 && d.RiskRewardRatio-drift.ComputedRR > driftRRThreshold {
+			drift.Flags = append(drift.Flags, fmt.Sprintf("风险回报比高报: 报告%.2f，计算%.2f", d.RiskRewardRatio, drift.ComputedRR))
+		}
+		if d.ChecklistPassed > 0 && d.ChecklistPassed-drift.ComputedChecklist >= driftChecklistThreshold {
+			drift.Flags = append(drift.Flags, fmt.Sprintf("检查项高报: 报告通过%d项，计算通过%d/%d项",
+				d.ChecklistPassed, drift.ComputedChecklist, engineChecklistSize))
+		}
+		if reported := oiSignalDirection(d.OISignal); reported != 0 && math.Abs(drift.ComputedOISignal) >= driftOIStrengthMin &&
+			reported*drift.ComputedOISignal < 0 {
+			drift.Flags = append(drift.Flags, fmt.Sprintf("OI信号方向矛盾: 报告%q，计算强度%+.2f", d.OISignal, drift.ComputedOISignal))
+		}
+
+		drifts = append(drifts, drift)
+	}
+	return drifts
+}
+
+// computedRiskReward 按入场价计算风险回报比（数据无效时返回0）
+func computedRiskReward(d *Decision, entry float64) float64 {
+	if entry <= 0 || d.StopLoss <= 0 || d.TakeProfit <= 0 {
+		return 0
+	}
+	dir := 1.0
+	if positionSide(d.Action) == "short" {
+		dir = -1.0
+	}
+	risk := (entry - d.StopLoss) * dir
+	reward := (d.TakeProfit - entry) * dir
+	if risk <= 0 {
+		return 0
+	}
+	return reward / risk
+}
+
+// engineChecklist 按市场数据计算开仓方向的检查项通过数：
+// 价格在EMA20同侧、MACD同向、RSI7未极端、4小时EMA20/EMA50同向、OI信号同向
+func engineChecklist(d *Decision, ctx *Context) int {
+	data := ctx.MarketDataMap[d.Symbol]
+	if data == nil {
+		return 0
+	}
+	dir := 1.0
+	if positionSide(d.Action) == "short" {
+		dir = -1.0
+	}
+
+	passed := 0
+	if (data.CurrentPrice-data.CurrentEMA20)*dir > 0 {
+		passed++
+	}
+	if data.CurrentMACD*dir > 0 {
+		passed++
+	}
+	if data.CurrentRSI7 > contradictionRSIOversold && data.CurrentRSI7 < contradictionRSIOverbought {
+		passed++
+	}
+	if lt := data.LongerTermContext; lt != nil && (lt.EMA20-lt.EMA50)*dir > 0 {
+		passed++
+	}
+	if oi, ok := ctx.OITopDataMap[d.Symbol]; ok && oi.SignalStrength*dir > 0 {
+		passed++
+	}
+	return passed
+}
+
+// oiSignalDirection 解析AI报告的OI信号方向（+1看多，-1看空，0未知/中性）
+func oiSignalDirection(signal string) float64 {
+	s := strings.ToLower(signal)
+	switch {
+	case strings.Contains(s, "bull") || strings.Contains(s, "看多"):
+		return 1
+	case strings.Contains(s, "bear") || strings.Contains(s, "看空"):
+		return -1
+	}
+	return 0
+}
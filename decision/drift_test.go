@@ -0,0 +1,45 @@
+package decision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComputeMetricDrift(t *testing.T) {
+	ctx := testContext()
+	ctx.OITopDataMap = map[string]*OITopData{"SOLUSDT": {SignalStrength: 0.6}}
+
+	decisions := testOpens()
+	// ETH做多：计算风险回报比5（入场3000、止损2940、止盈3300），检查项4/5（无OI数据）
+	decisions[0].RiskRewardRatio = 5.2
+	decisions[0].ChecklistPassed = 5
+	// SOL做空：计算风险回报比5，检查项1/5（只有RSI未极端，OI信号看多），AI全部高报
+	decisions[1].RiskRewardRatio = 8
+	decisions[1].ChecklistPassed = 5
+	decisions[1].OISignal = "bearish"
+	decisions = append(decisions, Decision{Symbol: "BTCUSDT", Action: "hold", Reasoning: "持有"})
+
+	drifts := ComputeMetricDrift(decisions, ctx)
+	if len(drifts) != 2 {
+		t.Fatalf("应只比较开仓决策, got %d", len(drifts))
+	}
+
+	eth := drifts[0]
+	if eth.ComputedRR != 5 || eth.ComputedChecklist != 4 || len(eth.Flags) != 0 {
+		t.Errorf("ETH 偏差在阈值内不应标记: %+v", eth)
+	}
+
+	sol := drifts[1]
+	if sol.ComputedRR != 5 || sol.ComputedChecklist != 1 || sol.ComputedOISignal != 0.6 {
+		t.Errorf("SOL 计算值 = %+v", sol)
+	}
+	for _, want := range []string{"风险回报比高报", "检查项高报", "OI信号方向矛盾"} {
+		found := false
+		for _, flag := range sol.Flags {
+			found = found || strings.Contains(flag, want)
+		}
+		if !found {
+			t.Errorf("SOL 应标记 %q: %v", want, sol.Flags)
+		}
+	}
+}
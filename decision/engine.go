@@ -1,14 +1,23 @@
 package decision
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"nofx/market"
 	"nofx/mcp"
 	"nofx/pool"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // PositionInfo 持仓信息
@@ -23,7 +32,11 @@ type PositionInfo struct {
 	UnrealizedPnLPct float64 `json:"unrealized_pnl_pct"`
 	LiquidationPrice float64 `json:"liquidation_price"`
 	MarginUsed       float64 `json:"margin_used"`
-	UpdateTime       int64   `json:"update_time"` // 持仓更新时间戳（毫秒）
+	StopLoss         float64 `json:"stop_loss,omitempty"`         // 当前止损价（0表示未知，不计入总风险）
+	UpdateTime       int64   `json:"update_time"`                 // 持仓更新时间戳（毫秒）
+	Exchange         string  `json:"exchange,omitempty"`          // 所在交易所（空表示主交易所）
+	IntendedQuantity float64 `json:"intended_quantity,omitempty"` // 开仓时计划的数量（部分成交时大于 Quantity，0表示未知）
+	FilledPct        float64 `json:"filled_pct,omitempty"`        // 成交比例（%，0时按 Quantity/IntendedQuantity 计算）
 }
 
 // AccountInfo 账户信息
@@ -32,6 +45,8 @@ type AccountInfo struct {
 	AvailableBalance float64 `json:"available_balance"` // 可用余额
 	TotalPnL         float64 `json:"total_pnl"`         // 总盈亏
 	TotalPnLPct      float64 `json:"total_pnl_pct"`     // 总盈亏百分比
+	RealizedPnL      float64 `json:"realized_pnl"`      // 当日已实现盈亏（已平仓交易，日亏损熔断依据）
+	UnrealizedPnL    float64 `json:"unrealized_pnl"`    // 持仓未实现盈亏
 	MarginUsed       float64 `json:"margin_used"`       // 已用保证金
 	MarginUsedPct    float64 `json:"margin_used_pct"`   // 保证金使用率
 	PositionCount    int     `json:"position_count"`    // 持仓数量
@@ -40,7 +55,8 @@ type AccountInfo struct {
 // CandidateCoin 候选币种（来自币种池）
 type CandidateCoin struct {
 	Symbol  string   `json:"symbol"`
-	Sources []string `json:"sources"` // 来源: "ai500" 和/或 "oi_top"
+	Sources []string `json:"sources"`         // 来源: "ai500" 和/或 "oi_top"
+	Score   float64  `json:"score,omitempty"` // 综合评分（来源权重+OI变化幅度，见 ScoreCandidate）
 }
 
 // OITopData 持仓量增长Top数据（用于AI决策参考）
@@ -51,6 +67,7 @@ type OITopData struct {
 	PriceDeltaPercent float64 // 价格变化百分比
 	NetLong           float64 // 净多仓
 	NetShort          float64 // 净空仓
+	SignalStrength    float64 // OI信号强度（-1~+1，见 OISignalStrength，获取市场数据后计算）
 }
 
 // Context 交易上下文（传递给AI的完整信息）
@@ -61,33 +78,141 @@ type Context struct {
 	Account         AccountInfo             `json:"account"`
 	Positions       []PositionInfo          `json:"positions"`
 	CandidateCoins  []CandidateCoin         `json:"candidate_coins"`
-	MarketDataMap   map[string]*market.Data `json:"-"` // 不序列化，但内部使用
-	OITopDataMap    map[string]*OITopData   `json:"-"` // OI Top数据映射
-	Performance     interface{}             `json:"-"` // 历史表现分析（logger.PerformanceAnalysis）
-	BTCETHLeverage  int                     `json:"-"` // BTC/ETH杠杆倍数（从配置读取）
-	AltcoinLeverage int                     `json:"-"` // 山寨币杠杆倍数（从配置读取）
+	MarketDataMap   map[string]*market.Data `json:"-"`                    // 不序列化，但内部使用
+	OITopDataMap    map[string]*OITopData   `json:"-"`                    // OI Top数据映射
+	Performance     interface{}             `json:"-"`                    // 历史表现分析（logger.PerformanceAnalysis）
+	BTCETHLeverage  int                     `json:"-"`                    // BTC/ETH杠杆倍数（从配置读取）
+	AltcoinLeverage int                     `json:"-"`                    // 山寨币杠杆倍数（从配置读取）
+	Risk            RiskConfig              `json:"-"`                    // 决策层风控配置（从配置读取）
+	CycleType       string                  `json:"cycle_type,omitempty"` // 周期类型: "scan"（例行扫描）或 "evaluate"（深度评估），空表示不区分
+
+	RequirePerCandidateReasoning bool `json:"-"` // 要求AI逐个点评每个候选币种（未覆盖的候选币种产生警告）
+	MinHoldReasoningLen          int  `json:"-"` // hold决策理由的最少字符数（0=不检查），要求AI说明继续持有的依据
+	WarnRoundTakeProfits         bool `json:"-"` // 所有止盈目标都是整数关口时产生警告（启发式，不拒绝）
+	RequireSignalType            bool `json:"-"` // 开仓必须给出 signal_type（为空时拒绝）
+
+	AllowedSignalTypes []string `json:"-"` // 已知的信号类型（空时使用 DefaultSignalTypes），未知类型产生警告
+
+	LastCycleTime       time.Time     `json:"-"` // 上一个决策周期的时间（配合 MinCycleInterval 使用）
+	MinCycleInterval    time.Duration `json:"-"` // 两个决策周期的最小间隔（0=不限制），防止调用方误触发连续调用
+	MarketDataFetchedAt time.Time     `json:"-"` // 市场数据获取时间（非零表示该Context已经用过一个周期，再次使用时会丢弃旧数据）
+
+	CandidateWeights       CandidateScoreWeights `json:"-"` // 候选币种评分权重（零值使用 DefaultCandidateScoreWeights）
+	MinVolume24hUSD        float64               `json:"-"` // 持仓价值低于15M时的备用流动性标准：24小时成交额（USD）达到该值仍保留候选币种（0=不启用）
+	LowLiquidityWindows    []LiquidityWindow     `json:"-"` // 低流动性时段（UTC，如周末、亚洲深夜），时段内收紧开仓要求（见 RiskConfig.LowLiquidity*）
+	SymbolNotes            map[string]string     `json:"-"` // 操作员对特定币种的备注（如"下周解锁，避免做多"），渲染在该币种的持仓/候选信息中
+	MaxPositions           int                   `json:"-"` // 最多持仓币种数（0时默认3个），同时用于系统提示词和验证
+	SkipCandidatesWhenFull bool                  `json:"-"` // 已达持仓上限或保证金不足（无法开新仓）时跳过候选币种的数据获取和展示
+	MaxRenderedCandidates  int                   `json:"-"` // prompt中最多展示的候选币种数（按评分取前N个，0=全部展示），与获取数量（calculateMaxCandidates）独立
+	SourceCaps             map[string]int        `json:"-"` // 每个来源（"ai500"/"oi_top"）最多入选的候选币种数（未配置或≤0=不限制）
+	LimitsProvider         LimitsProvider        `json:"-"` // 交易所实时限制（设置后开仓需同时满足交易所的杠杆和仓位上限）
+	PrimaryExchange        string                `json:"-"` // 主交易所（决策和持仓未指定交易所时使用）
+	LivePositions          LivePositionsProvider `json:"-"` // 交易所实时持仓（设置后每个周期先核对 Positions，找出已不存在的幽灵持仓）
+	ReconcileDropGhosts    bool                  `json:"-"` // 核对发现的幽灵持仓从上下文中移除（默认保留并提示）
+	MarketData             MarketDataProvider    `json:"-"` // 市场数据来源（未设置时使用 market.Get）
+	Enricher               func(*Context) error  `json:"-"` // 构建prompt前调用的上下文补充钩子（获取市场数据之后），可写入 ExtraSections、SymbolNotes 等派生信息，返回错误时中止本周期
+	ExtraSections          []string              `json:"-"` // 附加在User Prompt末尾（决策指令之前）的自定义段落，如外部情绪指标
+	MaxConcurrentFetches   int                   `json:"-"` // 并发获取市场数据的最大数量（0时默认8），避免候选币种较多时连接数激增
+	PositionFetchAttempts  int                   `json:"-"` // 持仓币种市场数据的最大获取次数（0时默认3次，1表示不重试），候选币种不重试
+	PositionFetchBackoff   time.Duration         `json:"-"` // 持仓币种重试前的初始等待时间（每次翻倍，0时默认500ms）
+	Store                  DecisionStore         `json:"-"` // 决策归档存储（设置后每个周期的决策都会保存，包括验证失败的）
+
+	TradingEnabled *bool `json:"-"` // 全局交易开关（nil=开启）；设为false时进入观察模式，所有交易动作在验证阶段降级为观望
+
+	NoJSONAsWait      bool `json:"-"` // AI响应中没有JSON决策数组时，视为一个观望决策（默认视为错误）
+	RetryOnRejection  bool `json:"-"` // 决策未通过验证时，把拒绝原因反馈给AI重新决策一次（默认直接返回验证错误）
+	CollectAllErrors  bool `json:"-"` // 验证单个决策时汇总全部错误一起返回（默认遇到第一个错误即返回）
+	AcceptPartial     bool `json:"-"` // 部分决策未通过验证时只剔除这些决策（批次检查超限时剔除超出限制的开仓，记入 FullDecision.Rejected），其余照常返回（默认整批拒绝）
+	WarnUnknownFields bool `json:"-"` // AI输出 Decision 中不存在的字段时产生警告（列出字段名）
+
+	AnalysisDepth AnalysisDepth `json:"-"` // 每个币种市场数据的渲染详细程度（空=standard）
+
+	ConfirmReasoningMaxChars int `json:"-"` // 二次确认提示词中每个决策理由的最大字符数（0时默认300，负数表示不截断，见 BuildConfirmationPrompt）
+
+	PreviousEquity       float64       `json:"-"` // 上一周期的账户净值（用于净值突变检测，0=未知），由调用方跨周期保存
+	SharpeWindow         time.Duration `json:"-"` // 夏普比率的滚动统计窗口（需与调用方计算 Performance 时使用的窗口一致，0=不标注窗口）
+	SharpeHaltStartCycle int           `json:"-"` // 夏普比率过低触发暂停开仓的周期序号加1（CallCount+1，0=未触发），由调用方跨周期保存
+
+	reconcileNotes []string // 本周期持仓核对的说明（随警告一起返回）
+	restored       bool     // 从检查点恢复（下一个周期直接使用检查点中的市场数据）
 }
 
+// AnalysisDepth 市场数据渲染详细程度：精简的数据适合部分模型，也能节省token
+type AnalysisDepth string
+
+const (
+	AnalysisDepthTerse    AnalysisDepth = "terse"    // 精简：去掉OI和4小时数据
+	AnalysisDepthStandard AnalysisDepth = "standard" // 标准：完整指标
+	AnalysisDepthVerbose  AnalysisDepth = "verbose"  // 详细：额外输出1h/4h价格变化
+)
+
+// marketDepth 转换为 market 包的渲染级别（未知值按标准处理）
+func (d AnalysisDepth) marketDepth() market.Depth {
+	switch d {
+	case AnalysisDepthTerse:
+		return market.DepthTerse
+	case AnalysisDepthVerbose:
+		return market.DepthVerbose
+	}
+	return market.DepthStandard
+}
+
+// ErrCycleTooSoon 距上一个决策周期的时间短于 MinCycleInterval
+var ErrCycleTooSoon = errors.New("决策周期间隔过短")
+
+// ErrValidationFailed AI决策解析成功但未通过验证（硬约束、风控等）
+var ErrValidationFailed = errors.New("决策验证失败")
+
+// errNoJSONArray AI响应中找不到JSON决策数组
+var errNoJSONArray = errors.New("无法找到JSON数组起始")
+
+// 决策周期类型
+const (
+	CycleTypeScan     = "scan"     // 例行扫描：以持仓管理和防御性操作为主
+	CycleTypeEvaluate = "evaluate" // 深度评估：允许寻找新的开仓机会
+)
+
 // Decision AI的交易决策
 type Decision struct {
-	Symbol          string  `json:"symbol"`
-	Action          string  `json:"action"` // "open_long", "open_short", "close_long", "close_short", "hold", "wait"
-	Leverage        int     `json:"leverage,omitempty"`
-	PositionSizeUSD float64 `json:"position_size_usd,omitempty"`
-	StopLoss        float64 `json:"stop_loss,omitempty"`
-	TakeProfit      float64 `json:"take_profit,omitempty"`
-	Confidence      int     `json:"confidence,omitempty"` // 信心度 (0-100)
-	RiskUSD         float64 `json:"risk_usd,omitempty"`   // 最大美元风险
-	Reasoning       string  `json:"reasoning"`
+	Symbol           string          `json:"symbol"`
+	Action           string          `json:"action"` // "open_long", "open_short", "close_long", "close_short", "add_long", "add_short", "update_stop", "partial_close", "hold", "wait"
+	Leverage         int             `json:"leverage,omitempty"`
+	PositionSizeUSD  float64         `json:"position_size_usd,omitempty"`
+	StopLoss         float64         `json:"stop_loss,omitempty"`
+	TakeProfit       float64         `json:"take_profit,omitempty"`
+	TakeProfitLevels []float64       `json:"take_profit_levels,omitempty"` // 分批止盈目标（由近到远，做多递增、做空递减）
+	Confidence       int             `json:"confidence,omitempty"`         // 信心度 (0-100)
+	RiskUSD          float64         `json:"risk_usd,omitempty"`           // 最大美元风险
+	ClosePercentage  float64         `json:"close_percentage,omitempty"`   // 部分平仓百分比（partial_close使用）
+	NewStopLoss      *float64        `json:"new_stop_loss,omitempty"`      // 新止损价（update_stop使用）
+	Exchange         string          `json:"exchange,omitempty"`           // 目标交易所（空时补全为主交易所）
+	SlippageBps      int             `json:"slippage_bps,omitempty"`       // 市价单最大可接受滑点（基点，开仓未给出时使用配置默认值）
+	OrderType        string          `json:"order_type,omitempty"`         // 开仓订单类型（market/limit，空为市价单）
+	LimitPrice       float64         `json:"limit_price,omitempty"`        // 限价单挂单价（order_type为limit时必填）
+	Breaker          *BreakerContext `json:"breaker,omitempty"`            // 验证时生效的熔断及该决策是否被允许（引擎填写，未熔断时为空）
+	SignalType       string          `json:"signal_type,omitempty"`        // 开仓信号类型（trend_follow/breakout/squeeze/bottom_fish等，用于事后分类分析）
+	RiskRewardRatio  float64         `json:"risk_reward_ratio,omitempty"`  // AI自评的风险回报比
+	ChecklistPassed  int             `json:"checklist_passed,omitempty"`   // AI自评的开仓检查项通过数
+	OISignal         string          `json:"oi_signal,omitempty"`          // AI对OI信号的判断（bullish/bearish/neutral）
+	Reasoning        string          `json:"reasoning"`
 }
 
 // FullDecision AI的完整决策（包含思维链）
 type FullDecision struct {
-	SystemPrompt string     `json:"system_prompt"` // 系统提示词（发送给AI的系统prompt）
-	UserPrompt   string     `json:"user_prompt"`   // 发送给AI的输入prompt
-	CoTTrace     string     `json:"cot_trace"`     // 思维链分析（AI输出）
-	Decisions    []Decision `json:"decisions"`     // 具体决策列表
-	Timestamp    time.Time  `json:"timestamp"`
+	SystemPrompt   string             `json:"system_prompt"`             // 系统提示词（发送给AI的系统prompt）
+	UserPrompt     string             `json:"user_prompt"`               // 发送给AI的输入prompt
+	CoTTrace       string             `json:"cot_trace"`                 // 思维链分析（AI输出）
+	RiskAssessment string             `json:"risk_assessment,omitempty"` // 风险评估段落（AI在【风险评估】标记后、JSON之前输出的内容，没有时为空）
+	RawResponse    string             `json:"raw_response"`              // AI原始响应（用于离线复盘）
+	PromptVersion  string             `json:"prompt_version"`            // 生成该决策的系统提示词版本
+	PromptHash     string             `json:"prompt_hash"`               // 系统提示词内容哈希
+	Decisions      []Decision         `json:"decisions"`                 // 具体决策列表
+	Warnings       []string           `json:"warnings"`                  // 软性检查警告（不影响执行，供操作员关注）
+	MetricDrift    []MetricDrift      `json:"metric_drift,omitempty"`    // AI自评指标与引擎计算值的偏差（开仓决策）
+	MarketRegime   MarketRegime       `json:"market_regime,omitempty"`   // 决策时的市场状态（见 ComputeMarketRegime），用于按市场状态统计表现
+	Rejected       []RejectedDecision `json:"rejected,omitempty"`        // 未通过验证而被剔除的决策（仅 Context.AcceptPartial 时）
+	Error          string             `json:"error,omitempty"`           // 提取、解析或验证失败的原因（归档时标记失败的周期，成功时为空）
+	Timestamp      time.Time          `json:"timestamp"`
 }
 
 // GetFullDecision 获取AI的完整交易决策（批量分析所有币种和持仓）
@@ -95,88 +220,144 @@ func GetFullDecision(ctx *Context, mcpClient *mcp.Client) (*FullDecision, error)
 	return GetFullDecisionWithCustomPrompt(ctx, mcpClient, "", false, "")
 }
 
+// GetFullDecisionCtx 同 GetFullDecision，reqCtx 取消或超时时中止市场数据获取和AI调用，返回 reqCtx.Err()
+func GetFullDecisionCtx(reqCtx context.Context, ctx *Context, mcpClient *mcp.Client) (*FullDecision, error) {
+	return GetFullDecisionWithCustomPromptCtx(reqCtx, ctx, mcpClient, "", false, "")
+}
+
 // GetFullDecisionWithCustomPrompt 获取AI的完整交易决策（支持自定义prompt和模板选择）
 func GetFullDecisionWithCustomPrompt(ctx *Context, mcpClient *mcp.Client, customPrompt string, overrideBase bool, templateName string) (*FullDecision, error) {
-	// 1. 为所有币种获取市场数据
-	if err := fetchMarketDataForContext(ctx); err != nil {
-		return nil, fmt.Errorf("获取市场数据失败: %w", err)
+	return GetFullDecisionWithCustomPromptCtx(context.Background(), ctx, mcpClient, customPrompt, overrideBase, templateName)
+}
+
+// GetFullDecisionWithCustomPromptCtx 同 GetFullDecisionWithCustomPrompt，支持通过 reqCtx 取消
+func GetFullDecisionWithCustomPromptCtx(reqCtx context.Context, ctx *Context, mcpClient *mcp.Client, customPrompt string, overrideBase bool, templateName string) (*FullDecision, error) {
+	// 0. 周期间隔保护（避免调用方bug导致频繁请求AI和交易所）
+	if err := checkCycleInterval(ctx); err != nil {
+		return nil, err
+	}
+
+	// 夏普比率过低时记录暂停起点（调用方需保存 ctx.SharpeHaltStartCycle 供后续周期使用）
+	updateSharpeHalt(ctx)
+
+	if ctx.restored {
+		// 从检查点恢复：直接使用检查点中的市场数据（确定性重放）
+		log.Printf("♻️  从检查点恢复决策上下文（市场数据获取于%s）", ctx.MarketDataFetchedAt.Format("15:04:05"))
+		ctx.restored = false
+	} else {
+		// 核对持仓（在获取市场数据之前，避免为幽灵持仓获取数据）
+		ctx.reconcileNotes = reconcilePositions(ctx)
+
+		// 复用上一周期的Context时，丢弃上一周期的市场数据，避免陈旧数据进入本周期的prompt
+		if !ctx.MarketDataFetchedAt.IsZero() {
+			log.Printf("⚠️  检测到复用的决策上下文（市场数据获取于%s），重新获取市场数据", ctx.MarketDataFetchedAt.Format("15:04:05"))
+			ctx.MarketDataMap = nil
+			ctx.OITopDataMap = nil
+		}
+
+		// 1. 为所有币种获取市场数据
+		if err := fetchMarketDataForContext(reqCtx, ctx); err != nil {
+			if reqCtx.Err() != nil {
+				return nil, reqCtx.Err()
+			}
+			return nil, fmt.Errorf("获取市场数据失败: %w", err)
+		}
+	}
+
+	// 补充派生信息（自定义钩子）
+	if ctx.Enricher != nil {
+		if err := ctx.Enricher(ctx); err != nil {
+			return nil, fmt.Errorf("补充决策上下文失败: %w", err)
+		}
 	}
 
 	// 2. 构建 System Prompt（固定规则）和 User Prompt（动态数据）
-	systemPrompt := buildSystemPromptWithCustom(ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage, customPrompt, overrideBase, templateName)
+	systemPrompt := buildSystemPromptWithCustom(ctx, customPrompt, overrideBase, templateName)
 	userPrompt := buildUserPrompt(ctx)
 
 	// 3. 调用AI API（使用 system + user prompt）
-	aiResponse, err := mcpClient.CallWithMessages(systemPrompt, userPrompt)
+	aiResponse, err := mcpClient.CallWithMessagesCtx(reqCtx, systemPrompt, userPrompt)
+	if reqCtx.Err() != nil {
+		return nil, reqCtx.Err()
+	}
 	if err != nil {
 		return nil, fmt.Errorf("调用AI API失败: %w", err)
 	}
 
 	// 4. 解析AI响应
-	decision, err := parseFullDecisionResponse(aiResponse, ctx.Account.TotalEquity, ctx.BTCETHLeverage, ctx.AltcoinLeverage)
+	decision, err := parseFullDecisionResponse(aiResponse, ctx)
+
+	// 验证失败时把拒绝原因反馈给AI，在本周期内重新决策一次（可配置）
+	if err != nil && ctx.RetryOnRejection && errors.Is(err, ErrValidationFailed) {
+		log.Printf("🔁 决策被拒绝，反馈原因后重新请求AI: %v", err)
+		retryPrompt := buildRejectionRetryPrompt(userPrompt, err)
+		if retryResponse, callErr := mcpClient.CallWithMessagesCtx(reqCtx, systemPrompt, retryPrompt); callErr != nil {
+			log.Printf("⚠️  重新决策调用AI失败: %v，返回原始拒绝", callErr)
+		} else if retried, retryErr := parseFullDecisionResponse(retryResponse, ctx); retryErr != nil {
+			log.Printf("⚠️  重新决策仍然失败: %v，返回原始拒绝", retryErr)
+		} else {
+			log.Printf("✓ 重新决策通过验证")
+			retried.Warnings = append(retried.Warnings, fmt.Sprintf("首次决策被拒绝，已反馈原因重新决策: %v", err))
+			decision, err = retried, nil
+			userPrompt, aiResponse = retryPrompt, retryResponse
+		}
+	}
+	if decision != nil {
+		// 即使解析/验证失败也保存prompt和原始响应（便于复盘）
+		decision.Timestamp = time.Now()
+		decision.SystemPrompt = systemPrompt // 保存系统prompt
+		decision.UserPrompt = userPrompt     // 保存输入prompt
+		decision.RawResponse = aiResponse    // 保存AI原始响应
+		decision.PromptVersion = PromptVersion
+		decision.PromptHash = PromptHash(systemPrompt)
+		decision.MarketRegime = ComputeMarketRegime(ctx)
+		decision.Warnings = append(contextWarnings(ctx), decision.Warnings...)
+		for _, w := range decision.Warnings {
+			log.Printf("⚠️  决策警告: %s", w)
+		}
+		if err != nil {
+			decision.Error = err.Error()
+		}
+		if ctx.Store != nil {
+			if saveErr := ctx.Store.Save(reqCtx, decision); saveErr != nil {
+				log.Printf("⚠️  决策归档失败: %v", saveErr)
+			}
+		}
+	}
 	if err != nil {
 		return decision, fmt.Errorf("解析AI响应失败: %w", err)
 	}
 
-	decision.Timestamp = time.Now()
-	decision.SystemPrompt = systemPrompt // 保存系统prompt
-	decision.UserPrompt = userPrompt     // 保存输入prompt
 	return decision, nil
 }
 
-// fetchMarketDataForContext 为上下文中的所有币种获取市场数据和OI数据
-func fetchMarketDataForContext(ctx *Context) error {
-	ctx.MarketDataMap = make(map[string]*market.Data)
-	ctx.OITopDataMap = make(map[string]*OITopData)
-
-	// 收集所有需要获取数据的币种
-	symbolSet := make(map[string]bool)
-
-	// 1. 优先获取持仓币种的数据（这是必须的）
-	for _, pos := range ctx.Positions {
-		symbolSet[pos.Symbol] = true
-	}
+// buildRejectionRetryPrompt 在原始 User Prompt 后追加上一次决策被拒绝的原因，供AI修正后重新决策
+func buildRejectionRetryPrompt(userPrompt string, rejection error) string {
+	var sb strings.Builder
+	sb.WriteString(userPrompt)
+	sb.WriteString("\n---\n\n")
+	sb.WriteString("## ⛔ 上一次决策被拒绝\n\n")
+	sb.WriteString(fmt.Sprintf("拒绝原因: %v\n\n", rejection))
+	sb.WriteString("请针对上述原因修正违规的决策后，重新输出完整的思维链和JSON决策数组；无法在约束内修正的开仓请改为 wait。\n")
+	return sb.String()
+}
 
-	// 2. 候选币种数量根据账户状态动态调整
-	maxCandidates := calculateMaxCandidates(ctx)
-	for i, coin := range ctx.CandidateCoins {
-		if i >= maxCandidates {
-			break
-		}
-		symbolSet[coin.Symbol] = true
+// checkCycleInterval 检查距上一个决策周期是否已超过最小间隔
+func checkCycleInterval(ctx *Context) error {
+	if ctx.MinCycleInterval <= 0 || ctx.LastCycleTime.IsZero() {
+		return nil
 	}
-
-	// 并发获取市场数据
-	// 持仓币种集合（用于判断是否跳过OI检查）
-	positionSymbols := make(map[string]bool)
-	for _, pos := range ctx.Positions {
-		positionSymbols[pos.Symbol] = true
+	if elapsed := time.Since(ctx.LastCycleTime); elapsed < ctx.MinCycleInterval {
+		return fmt.Errorf("%w: 距上次周期%.0f秒，最小间隔%.0f秒", ErrCycleTooSoon, elapsed.Seconds(), ctx.MinCycleInterval.Seconds())
 	}
+	return nil
+}
 
-	for symbol := range symbolSet {
-		data, err := market.Get(symbol)
-		if err != nil {
-			// 单个币种失败不影响整体，只记录错误
-			continue
-		}
-
-		// ⚠️ 流动性过滤：持仓价值低于15M USD的币种不做（多空都不做）
-		// 持仓价值 = 持仓量 × 当前价格
-		// 但现有持仓必须保留（需要决策是否平仓）
-		isExistingPosition := positionSymbols[symbol]
-		if !isExistingPosition && data.OpenInterest != nil && data.CurrentPrice > 0 {
-			// 计算持仓价值（USD）= 持仓量 × 当前价格
-			oiValue := data.OpenInterest.Latest * data.CurrentPrice
-			oiValueInMillions := oiValue / 1_000_000 // 转换为百万美元单位
-			if oiValueInMillions < 15 {
-				log.Printf("⚠️  %s 持仓价值过低(%.2fM USD < 15M)，跳过此币种 [持仓量:%.0f × 价格:%.4f]",
-					symbol, oiValueInMillions, data.OpenInterest.Latest, data.CurrentPrice)
-				continue
-			}
-		}
-
-		ctx.MarketDataMap[symbol] = data
-	}
+// fetchMarketDataForContext 为上下文中的所有币种获取市场数据和OI数据（reqCtx 取消时停止获取并返回 reqCtx.Err()）
+func fetchMarketDataForContext(reqCtx context.Context, ctx *Context) error {
+	ctx.MarketDataMap = make(map[string]*market.Data)
+	ctx.OITopDataMap = make(map[string]*OITopData)
+	ctx.MarketDataFetchedAt = time.Now()
 
 	// 加载OI Top数据（不影响主流程）
 	oiPositions, err := pool.GetOITopPositions()
@@ -195,11 +376,96 @@ func fetchMarketDataForContext(ctx *Context) error {
 		}
 	}
 
-	return nil
+	// 按综合评分排序候选币种（双重信号和OI变化大的优先分析）
+	rankCandidates(ctx)
+	candidates := capCandidatesPerSource(ctx)
+
+	// 持仓币种集合（用于判断是否跳过OI检查）
+	positionSymbols := make(map[string]bool)
+	for _, pos := range ctx.Positions {
+		positionSymbols[pos.Symbol] = true
+	}
+
+	// 第一轮：持仓币种（必须获取，失败时重试，不经过流动性过滤）
+	if err := fetchSymbols(reqCtx, ctx, sortedSymbols(positionSymbols), positionSymbols, func(result fetchResult) {
+		if result.err != nil || result.data == nil {
+			// 缺少数据时AI无法管理该持仓，需要醒目提示（持仓信息中也会标注，见 positionAnomalies）
+			log.Printf("🚨 持仓币种%s市场数据获取失败（已尝试%d次），本周期prompt中缺少该持仓的市场数据: %v",
+				result.symbol, ctx.positionFetchAttempts(), result.err)
+			return
+		}
+		storeMarketData(ctx, result.symbol, result.data)
+	}); err != nil {
+		return err
+	}
+
+	// 第二轮：候选币种（尽力获取，数量根据账户状态动态调整，单个币种失败不影响整体）
+	candidateSymbols := make(map[string]bool)
+	maxCandidates := calculateMaxCandidates(ctx)
+	for i, coin := range candidates {
+		if i >= maxCandidates {
+			break
+		}
+		if !positionSymbols[coin.Symbol] {
+			candidateSymbols[coin.Symbol] = true
+		}
+	}
+	return fetchSymbols(reqCtx, ctx, sortedSymbols(candidateSymbols), nil, func(result fetchResult) {
+		if result.err != nil || result.data == nil {
+			log.Printf("⚠️  获取%s市场数据失败: %v", result.symbol, result.err)
+			return
+		}
+		if admitMarketData(result.symbol, result.data, ctx) {
+			storeMarketData(ctx, result.symbol, result.data)
+		}
+	})
+}
+
+// sortedSymbols 返回集合中的币种（排序后，保证获取顺序稳定）
+func sortedSymbols(set map[string]bool) []string {
+	symbols := make([]string, 0, len(set))
+	for symbol := range set {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// storeMarketData 写入币种的市场数据，并更新其OI信号强度
+func storeMarketData(ctx *Context, symbol string, data *market.Data) {
+	ctx.MarketDataMap[symbol] = data
+	if oi, ok := ctx.OITopDataMap[symbol]; ok {
+		oi.SignalStrength = OISignalStrength(oi, data.FundingRate)
+	}
+}
+
+// admitMarketData 候选币种的流动性过滤：持仓价值低于15M USD的币种不做（多空都不做）；现有持仓不经过该过滤（需要决策是否平仓）
+func admitMarketData(symbol string, data *market.Data, ctx *Context) bool {
+	if data.OpenInterest == nil || data.CurrentPrice <= 0 {
+		return true
+	}
+	// 持仓价值（USD）= 持仓量 × 当前价格
+	oiValue := data.OpenInterest.Latest * data.CurrentPrice
+	oiValueInMillions := oiValue / 1_000_000 // 转换为百万美元单位
+	if oiValueInMillions < 15 && ctx.MinVolume24hUSD > 0 && data.QuoteVolume24h >= ctx.MinVolume24hUSD {
+		// 新上线币种OI尚未积累，但成交活跃时仍保留
+		log.Printf("💧 %s 持仓价值%.2fM USD < 15M，但24小时成交额%.2fM USD达标，保留此币种",
+			symbol, oiValueInMillions, data.QuoteVolume24h/1_000_000)
+	} else if oiValueInMillions < 15 {
+		log.Printf("⚠️  %s 持仓价值过低(%.2fM USD < 15M)，跳过此币种 [持仓量:%.0f × 价格:%.4f]",
+			symbol, oiValueInMillions, data.OpenInterest.Latest, data.CurrentPrice)
+		return false
+	}
+	return true
 }
 
 // calculateMaxCandidates 根据账户状态计算需要分析的候选币种数量
 func calculateMaxCandidates(ctx *Context) int {
+	// 无法开新仓时不分析候选币种，只获取持仓数据（可配置）
+	if ctx.SkipCandidatesWhenFull && newOpensBlocked(ctx) != "" {
+		return 0
+	}
+
 	// 直接返回候选池的全部币种数量
 	// 因为候选池已经在 auto_trader.go 中筛选过了
 	// 固定分析前20个评分最高的币种（来自AI500）
@@ -207,14 +473,14 @@ func calculateMaxCandidates(ctx *Context) int {
 }
 
 // buildSystemPromptWithCustom 构建包含自定义内容的 System Prompt
-func buildSystemPromptWithCustom(accountEquity float64, btcEthLeverage, altcoinLeverage int, customPrompt string, overrideBase bool, templateName string) string {
+func buildSystemPromptWithCustom(ctx *Context, customPrompt string, overrideBase bool, templateName string) string {
 	// 如果覆盖基础prompt且有自定义prompt，只使用自定义prompt
 	if overrideBase && customPrompt != "" {
 		return customPrompt
 	}
 
 	// 获取基础prompt（使用指定的模板）
-	basePrompt := buildSystemPrompt(accountEquity, btcEthLeverage, altcoinLeverage, templateName)
+	basePrompt := buildSystemPrompt(ctx, templateName)
 
 	// 如果没有自定义prompt，直接返回基础prompt
 	if customPrompt == "" {
@@ -233,9 +499,20 @@ func buildSystemPromptWithCustom(accountEquity float64, btcEthLeverage, altcoinL
 	return sb.String()
 }
 
+// PromptVersion 系统提示词版本（buildSystemPrompt 的规则或输出格式有实质变化时递增），记录在每个决策上便于对比不同版本的表现
+const PromptVersion = "v3"
+
+// PromptHash 计算prompt内容的短哈希（同一版本下用于区分模板和动态参数带来的差异）
+func PromptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
+}
+
 // buildSystemPrompt 构建 System Prompt（使用模板+动态部分）
-func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage int, templateName string) string {
+func buildSystemPrompt(ctx *Context, templateName string) string {
 	var sb strings.Builder
+	accountEquity := ctx.Account.TotalEquity
+	btcEthLeverage, altcoinLeverage := ctx.BTCETHLeverage, ctx.AltcoinLeverage
 
 	// 1. 加载提示词模板（核心交易策略部分）
 	if templateName == "" {
@@ -263,7 +540,7 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	// 2. 硬约束（风险控制）- 动态生成
 	sb.WriteString("# 硬约束（风险控制）\n\n")
 	sb.WriteString("1. 风险回报比: 必须 ≥ 1:3（冒1%风险，赚3%+收益）\n")
-	sb.WriteString("2. 最多持仓: 3个币种（质量>数量）\n")
+	sb.WriteString(fmt.Sprintf("2. 最多持仓: %d个币种（质量>数量）\n", ctx.maxPositions()))
 	sb.WriteString(fmt.Sprintf("3. 单币仓位: 山寨%.0f-%.0f U(%dx杠杆) | BTC/ETH %.0f-%.0f U(%dx杠杆)\n",
 		accountEquity*0.8, accountEquity*1.5, altcoinLeverage, accountEquity*5, accountEquity*10, btcEthLeverage))
 	sb.WriteString("4. 保证金: 总使用率 ≤ 90%\n\n")
@@ -271,17 +548,40 @@ func buildSystemPrompt(accountEquity float64, btcEthLeverage, altcoinLeverage in
 	// 3. 输出格式 - 动态生成
 	sb.WriteString("#输出格式\n\n")
 	sb.WriteString("第一步: 思维链（纯文本）\n")
-	sb.WriteString("简洁分析你的思考过程\n\n")
+	sb.WriteString("简洁分析你的思考过程\n")
+	if ctx.RequirePerCandidateReasoning {
+		sb.WriteString("必须逐个点评每个候选币种，每个一行（格式: SYMBOL: 简短结论），即使决定观望\n")
+	}
+	sb.WriteString("\n")
 	sb.WriteString("第二步: JSON决策数组\n\n")
 	sb.WriteString("```json\n[\n")
-	sb.WriteString(fmt.Sprintf("  {\"symbol\": \"BTCUSDT\", \"action\": \"open_short\", \"leverage\": %d, \"position_size_usd\": %.0f, \"stop_loss\": 97000, \"take_profit\": 91000, \"confidence\": 85, \"risk_usd\": 300, \"reasoning\": \"下跌趋势+MACD死叉\"},\n", btcEthLeverage, accountEquity*5))
+	sb.WriteString(fmt.Sprintf("  {\"symbol\": \"BTCUSDT\", \"action\": \"open_short\", \"leverage\": %d, \"position_size_usd\": %.0f, \"stop_loss\": 97000, \"take_profit\": 91000, \"take_profit_levels\": [94000, 92500, 91000], \"confidence\": 85, \"risk_usd\": 300, \"reasoning\": \"下跌趋势+MACD死叉\"},\n", btcEthLeverage, accountEquity*5))
+	sb.WriteString(fmt.Sprintf("  {\"symbol\": \"SOLUSDT\", \"action\": \"open_long\", \"leverage\": %d, \"position_size_usd\": %.0f, \"stop_loss\": 180, \"take_profit\": 210, \"take_profit_levels\": [195, 202, 210], \"confidence\": 80, \"risk_usd\": 100, \"reasoning\": \"突破回踩确认+放量\"},\n", altcoinLeverage, accountEquity))
 	sb.WriteString("  {\"symbol\": \"ETHUSDT\", \"action\": \"close_long\", \"reasoning\": \"止盈离场\"}\n")
 	sb.WriteString("]\n```\n\n")
 	sb.WriteString("字段说明:\n")
-	sb.WriteString("- `action`: open_long | open_short | close_long | close_short | hold | wait\n")
+	sb.WriteString("- `action`: open_long | open_short | close_long | close_short | add_long | add_short | update_stop | partial_close | hold | wait\n")
+	sb.WriteString("- `update_stop`: 调整已有持仓的止损，需给出 new_stop_loss；`partial_close`: 部分平仓，需给出 close_percentage（1-100）\n")
+	sb.WriteString("- `add_long`/`add_short`: 仅用于补足部分成交的持仓，需给出 position_size_usd（不超过未成交部分）以及整个持仓的 stop_loss、take_profit（补仓后按总数量重新挂单）\n")
 	sb.WriteString("- `confidence`: 0-100（开仓建议≥75）\n")
+	sb.WriteString("- `order_type`: 可选，limit 表示限价开仓，需给出 limit_price（做多挂在现价下方、做空挂在现价上方，止损止盈按挂单价计算）\n")
+	sb.WriteString("- `take_profit_levels`: 可选，分批止盈目标数组（做多递增、做空递减，不能重复）\n")
+	sb.WriteString("- 方向: 做多止损在入场价下方、止盈在上方；做空止损在入场价上方、止盈在下方（见上方两个示例）\n")
+	if ctx.RequireSignalType {
+		sb.WriteString(fmt.Sprintf("- `signal_type`: 开仓必填，信号类型: %s\n", strings.Join(signalTypes(ctx), " | ")))
+	}
 	sb.WriteString("- 开仓时必填: leverage, position_size_usd, stop_loss, take_profit, confidence, risk_usd, reasoning\n\n")
 
+	// 4. 周期类型 - 根据本周期目的调整侧重点
+	switch ctx.CycleType {
+	case CycleTypeScan:
+		sb.WriteString("# 本周期: 例行扫描\n\n")
+		sb.WriteString("以持仓管理为主（hold/wait/平仓），除非出现极强信号，否则不要开新仓。\n\n")
+	case CycleTypeEvaluate:
+		sb.WriteString("# 本周期: 深度评估\n\n")
+		sb.WriteString("全面重新评估持仓和候选币种，可以寻找新的开仓机会。\n\n")
+	}
+
 	return sb.String()
 }
 
@@ -301,18 +601,24 @@ func buildUserPrompt(ctx *Context) string {
 	}
 
 	// 账户
-	sb.WriteString(fmt.Sprintf("账户: 净值%.2f | 余额%.2f (%.1f%%) | 盈亏%+.2f%% | 保证金%.1f%% | 持仓%d个\n\n",
+	sb.WriteString(fmt.Sprintf("账户: 净值%.2f | 余额%.2f (%.1f%%) | 盈亏%+.2f%% (当日已实现%+.2f / 未实现%+.2f) | 保证金%.1f%% | 持仓%d个\n\n",
 		ctx.Account.TotalEquity,
 		ctx.Account.AvailableBalance,
 		(ctx.Account.AvailableBalance/ctx.Account.TotalEquity)*100,
 		ctx.Account.TotalPnLPct,
+		ctx.Account.RealizedPnL,
+		ctx.Account.UnrealizedPnL,
 		ctx.Account.MarginUsedPct,
 		ctx.Account.PositionCount))
+	if note := abnormalEquityChange(ctx); note != "" {
+		sb.WriteString(fmt.Sprintf("🚨 %s，请格外谨慎，优先检查持仓状态\n\n", note))
+	}
 
-	// 持仓（完整市场数据）
-	if len(ctx.Positions) > 0 {
-		sb.WriteString("## 当前持仓\n")
-		for i, pos := range ctx.Positions {
+	// 持仓（完整市场数据），数量无效的持仓不渲染，避免AI管理不存在的仓位
+	positions := activePositions(ctx.Positions)
+	if len(positions) > 0 {
+		sb.WriteString(fmt.Sprintf("## 当前持仓 (%d个)\n", len(positions)))
+		for i, pos := range positions {
 			// 计算持仓时长
 			holdingDuration := ""
 			if pos.UpdateTime > 0 {
@@ -332,9 +638,37 @@ func buildUserPrompt(ctx *Context) string {
 				pos.EntryPrice, pos.MarkPrice, pos.UnrealizedPnLPct,
 				pos.Leverage, pos.MarginUsed, pos.LiquidationPrice, holdingDuration))
 
+			// 时间止损紧迫提示（让AI优先处理持仓过久的仓位）；新仓位在保护期内不施加重新评估压力
+			if inHoldGracePeriod(pos, ctx.Risk, time.Now()) {
+				sb.WriteString("🆕 新仓位保护期内，除非触发止损条件，请给交易留出空间\n\n")
+			} else if urgency := timeStopUrgency(pos, ctx.Risk, time.Now()); urgency != "" {
+				sb.WriteString(urgency + "\n\n")
+			}
+
+			// 资金费结算提示（不利费率即将结算时升级）
+			if funding := fundingUrgency(pos, ctx.MarketDataMap[pos.Symbol], time.Now()); funding != "" {
+				sb.WriteString(funding + "\n\n")
+			}
+
+			// 部分成交提示（可用 add_long/add_short 补足）
+			if filled := positionFilledPct(pos); filled < 100 {
+				sb.WriteString(fmt.Sprintf("📉 部分成交: 已成交%.0f%%（%.4f / 计划%.4f），可用add_%s补足剩余部分\n\n",
+					filled, pos.Quantity, pos.IntendedQuantity, pos.Side))
+			}
+
+			// 数据异常提示（避免AI基于错误数据推理）
+			for _, anomaly := range positionAnomalies(pos, ctx) {
+				sb.WriteString(fmt.Sprintf("⚠️ %s\n\n", anomaly))
+			}
+
+			// 操作员对该币种的备注
+			if note := ctx.SymbolNotes[pos.Symbol]; note != "" {
+				sb.WriteString(fmt.Sprintf("📝 备注: %s\n\n", note))
+			}
+
 			// 使用FormatMarketData输出完整市场数据
 			if marketData, ok := ctx.MarketDataMap[pos.Symbol]; ok {
-				sb.WriteString(market.Format(marketData))
+				sb.WriteString(market.FormatWithDepth(marketData, ctx.AnalysisDepth.marketDepth()))
 				sb.WriteString("\n")
 			}
 		}
@@ -342,14 +676,11 @@ func buildUserPrompt(ctx *Context) string {
 		sb.WriteString("当前持仓: 无\n\n")
 	}
 
-	// 候选币种（完整市场数据）
-	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", len(ctx.MarketDataMap)))
+	// 候选币种（完整市场数据），先渲染再写标题，数量只统计实际展示的候选币种（不含持仓币种）
+	var candidatesSB strings.Builder
 	displayedCount := 0
-	for _, coin := range ctx.CandidateCoins {
-		marketData, hasData := ctx.MarketDataMap[coin.Symbol]
-		if !hasData {
-			continue
-		}
+	for _, coin := range renderedCandidates(ctx) {
+		marketData := ctx.MarketDataMap[coin.Symbol]
 		displayedCount++
 
 		sourceTags := ""
@@ -360,23 +691,47 @@ func buildUserPrompt(ctx *Context) string {
 		}
 
 		// 使用FormatMarketData输出完整市场数据
-		sb.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, sourceTags))
-		sb.WriteString(market.Format(marketData))
-		sb.WriteString("\n")
+		candidatesSB.WriteString(fmt.Sprintf("### %d. %s%s\n\n", displayedCount, coin.Symbol, sourceTags))
+		if oi, ok := ctx.OITopDataMap[coin.Symbol]; ok {
+			if oi.Rank > 0 {
+				candidatesSB.WriteString(fmt.Sprintf("🔥 OI增长榜第%d名（1小时OI变化%+.2f%%）\n", oi.Rank, oi.OIDeltaPercent))
+			}
+			candidatesSB.WriteString(fmt.Sprintf("OI信号强度: %+.2f（-1看空 ~ +1看多）\n\n", oi.SignalStrength))
+		}
+		if note := ctx.SymbolNotes[coin.Symbol]; note != "" {
+			candidatesSB.WriteString(fmt.Sprintf("📝 备注: %s\n\n", note))
+		}
+		candidatesSB.WriteString(market.FormatWithDepth(marketData, ctx.AnalysisDepth.marketDepth()))
+		candidatesSB.WriteString("\n")
+	}
+	sb.WriteString(fmt.Sprintf("## 候选币种 (%d个)\n\n", displayedCount))
+	if ctx.SkipCandidatesWhenFull {
+		if reason := newOpensBlocked(ctx); reason != "" {
+			sb.WriteString(fmt.Sprintf("%s，本周期不分析候选币种，只管理现有持仓\n\n", reason))
+		}
 	}
+	sb.WriteString(candidatesSB.String())
 	sb.WriteString("\n")
 
 	// 夏普比率（直接传值，不要复杂格式化）
-	if ctx.Performance != nil {
-		// 直接从interface{}中提取SharpeRatio
-		type PerformanceData struct {
-			SharpeRatio float64 `json:"sharpe_ratio"`
-		}
-		var perfData PerformanceData
-		if jsonData, err := json.Marshal(ctx.Performance); err == nil {
-			if err := json.Unmarshal(jsonData, &perfData); err == nil {
-				sb.WriteString(fmt.Sprintf("## 📊 夏普比率: %.2f\n\n", perfData.SharpeRatio))
-			}
+	if sharpe, ok := performanceSharpe(ctx); ok {
+		if ctx.SharpeWindow > 0 {
+			sb.WriteString(fmt.Sprintf("## 📊 夏普比率（%s滚动窗口）: %.2f\n\n", formatWindow(ctx.SharpeWindow), sharpe))
+		} else {
+			sb.WriteString(fmt.Sprintf("## 📊 夏普比率: %.2f\n\n", sharpe))
+		}
+	}
+	if w, ok := activeLiquidityWindow(ctx, time.Now()); ok {
+		sb.WriteString(fmt.Sprintf("🌙 当前处于低流动性时段（%s），滑点和扫止损风险更高：%s\n\n", w, lowLiquidityRules(ctx.Risk)))
+	}
+	if halted, reason := sharpeHalted(ctx); halted {
+		sb.WriteString(fmt.Sprintf("⚠️ %s，本周期禁止开仓，只允许持仓管理和平仓\n\n", reason))
+	}
+
+	// 自定义段落（通常由 Enricher 写入）
+	for _, section := range ctx.ExtraSections {
+		if section = strings.TrimSpace(section); section != "" {
+			sb.WriteString(section + "\n\n")
 		}
 	}
 
@@ -387,35 +742,186 @@ func buildUserPrompt(ctx *Context) string {
 }
 
 // parseFullDecisionResponse 解析AI的完整决策响应
-func parseFullDecisionResponse(aiResponse string, accountEquity float64, btcEthLeverage, altcoinLeverage int) (*FullDecision, error) {
-	// 1. 提取思维链
-	cotTrace := extractCoTTrace(aiResponse)
+func parseFullDecisionResponse(aiResponse string, ctx *Context) (*FullDecision, error) {
+	return ProcessResponse(aiResponse, ctx)
+}
 
-	// 2. 提取JSON决策列表
-	decisions, err := extractDecisions(aiResponse)
+// ProcessResponse 一次完成AI响应的全部处理：提取、修复、解析、数值检查、标准化、软性检查和验证
+// 返回的 FullDecision 包含决策和累计的警告；任一步失败时仍返回已得到的部分结果
+func ProcessResponse(raw string, ctx *Context) (*FullDecision, error) {
+	// 1. 提取思维链（以及可选的风险评估段落）
+	cotTrace := extractCoTTrace(raw)
+	riskAssessment := extractRiskAssessment(raw)
+
+	// 2. 提取JSON决策列表（含格式修复和解析）
+	decisions, err := extractDecisions(raw)
+	if err != nil && ctx.NoJSONAsWait && errors.Is(err, errNoJSONArray) {
+		// 没有JSON但响应完整时，按观望处理（思维链作为理由）
+		log.Printf("⚠️  AI响应中没有JSON决策，按观望处理")
+		decisions, err = []Decision{{Action: "wait", Reasoning: cotTrace}}, nil
+	}
 	if err != nil {
 		return &FullDecision{
-			CoTTrace:  cotTrace,
-			Decisions: []Decision{},
+			CoTTrace:       cotTrace,
+			RiskAssessment: riskAssessment,
+			Decisions:      []Decision{},
 		}, fmt.Errorf("提取决策失败: %w", err)
 	}
 
-	// 3. 验证决策
-	if err := validateDecisions(decisions, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
+	// 3. 数值检查（负数等明显错误的数值）
+	if err := checkNumericSanity(decisions); err != nil {
+		return &FullDecision{
+			CoTTrace:       cotTrace,
+			RiskAssessment: riskAssessment,
+			Decisions:      decisions,
+		}, fmt.Errorf("数值检查失败: %w", err)
+	}
+
+	// 4. 标准化决策（补全可推导的字段，去掉与持仓管理矛盾的开仓）
+	normalizeDecisions(decisions, ctx)
+	decisions, dedupWarnings := dedupPositionCandidateDecisions(decisions, ctx)
+	dedupWarnings = append(dedupWarnings, autoCorrectRiskReward(decisions, ctx)...)
+
+	// 5. 软性检查（只产生警告，不拒绝决策）
+	warnings := append(dedupWarnings, lintDecisions(decisions, ctx)...)
+	warnings = append(warnings, lintCandidateCoverage(cotTrace, decisions, ctx)...)
+	if ctx.WarnUnknownFields {
+		if jsonContent, err := extractDecisionJSON(raw); err == nil {
+			if unknown := unknownDecisionFields(jsonContent); len(unknown) > 0 {
+				warnings = append(warnings, fmt.Sprintf("AI输出了未知字段（已忽略，可能是字段名写错）: %s", strings.Join(unknown, ", ")))
+			}
+		}
+	}
+
+	// AI自评指标偏差（出现偏差时同时作为警告提示操作员）
+	drift := ComputeMetricDrift(decisions, ctx)
+	for _, m := range drift {
+		for _, flag := range m.Flags {
+			warnings = append(warnings, fmt.Sprintf("%s 指标偏差: %s", m.Symbol, flag))
+		}
+	}
+
+	// 6. 验证决策（AcceptPartial 时剔除未通过的决策，其余照常返回）
+	var rejected []RejectedDecision
+	err = validateDecisions(decisions, ctx)
+	if err != nil && ctx.AcceptPartial {
+		if kept, dropped, ok := acceptPartial(decisions, err, ctx); ok {
+			for _, r := range dropped {
+				log.Printf("⚠️  剔除未通过验证的决策: %s %s - %s", r.Decision.Symbol, r.Decision.Action, r.Reason)
+				warnings = append(warnings, fmt.Sprintf("已剔除决策 %s %s: %s", r.Decision.Symbol, r.Decision.Action, r.Reason))
+			}
+			decisions, rejected, err = kept, dropped, nil
+		}
+	}
+	if err != nil {
 		return &FullDecision{
-			CoTTrace:  cotTrace,
-			Decisions: decisions,
-		}, fmt.Errorf("决策验证失败: %w", err)
+			CoTTrace:       cotTrace,
+			RiskAssessment: riskAssessment,
+			Decisions:      decisions,
+			Warnings:       warnings,
+			MetricDrift:    drift,
+		}, fmt.Errorf("%w: %w", ErrValidationFailed, err)
 	}
 
 	return &FullDecision{
-		CoTTrace:  cotTrace,
-		Decisions: decisions,
+		CoTTrace:       cotTrace,
+		RiskAssessment: riskAssessment,
+		Decisions:      decisions,
+		Warnings:       warnings,
+		MetricDrift:    drift,
+		Rejected:       rejected,
 	}, nil
 }
 
+// RejectedDecision 未通过验证而被剔除的决策及原因
+type RejectedDecision struct {
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason"`
+}
+
+// acceptPartial 从批次中剔除验证失败的决策，剩余决策重新验证（批次层面的检查需要按剔除后的批次重算），直到剩余决策全部通过
+// 存在无法归因到具体决策的批次错误时返回false，由调用方整批拒绝
+func acceptPartial(decisions []Decision, err error, ctx *Context) (kept []Decision, rejected []RejectedDecision, ok bool) {
+	kept = decisions
+	for err != nil {
+		var verrs *ValidationErrors
+		if !errors.As(err, &verrs) {
+			return nil, nil, false
+		}
+		reasons := rejectionReasons(verrs)
+		if len(reasons) == 0 {
+			return nil, nil, false
+		}
+		var next []Decision
+		for i, d := range kept {
+			if reason, found := reasons[i]; found {
+				rejected = append(rejected, RejectedDecision{Decision: d, Reason: reason})
+			} else {
+				next = append(next, d)
+			}
+		}
+		kept = next
+		err = validateDecisions(kept, ctx)
+	}
+	if kept == nil {
+		kept = []Decision{}
+	}
+	return kept, rejected, true
+}
+
+// rejectionReasons 返回本轮应剔除的决策（下标 -> 原因）：优先剔除单个验证失败的决策（剔除后批次检查可能已经满足），
+// 没有单个失败时按批次错误剔除导致超限的决策；存在无法归因的批次错误时返回nil
+func rejectionReasons(verrs *ValidationErrors) map[int]string {
+	reasons := make(map[int]string)
+	if len(verrs.Decisions) > 0 {
+		for _, de := range verrs.Decisions {
+			reasons[de.Index] = de.Err.Error()
+		}
+		return reasons
+	}
+	for _, err := range verrs.Batch {
+		var be *BatchError
+		if !errors.As(err, &be) || len(be.Indices) == 0 {
+			return nil
+		}
+		for _, i := range be.Indices {
+			if _, found := reasons[i]; !found {
+				reasons[i] = be.Error()
+			}
+		}
+	}
+	return reasons
+}
+
+// checkNumericSanity 检查决策中的数值字段没有明显错误（负数、超出范围）
+func checkNumericSanity(decisions []Decision) error {
+	for i, d := range decisions {
+		if d.Leverage < 0 || d.PositionSizeUSD < 0 || d.StopLoss < 0 || d.TakeProfit < 0 || d.RiskUSD < 0 {
+			return fmt.Errorf("决策 #%d %s 含有负数数值（杠杆:%d 仓位:%.2f 止损:%.4f 止盈:%.4f 风险:%.2f）",
+				i+1, d.Symbol, d.Leverage, d.PositionSizeUSD, d.StopLoss, d.TakeProfit, d.RiskUSD)
+		}
+		if d.Confidence < 0 || d.Confidence > 100 {
+			return fmt.Errorf("决策 #%d %s 信心度必须在0-100之间: %d", i+1, d.Symbol, d.Confidence)
+		}
+		if d.ClosePercentage < 0 || d.ClosePercentage > 100 {
+			return fmt.Errorf("决策 #%d %s 平仓比例必须在0-100之间: %.2f", i+1, d.Symbol, d.ClosePercentage)
+		}
+		for _, tp := range d.TakeProfitLevels {
+			if tp < 0 {
+				return fmt.Errorf("决策 #%d %s 止盈目标不能为负数: %.4f", i+1, d.Symbol, tp)
+			}
+		}
+	}
+	return nil
+}
+
 // extractCoTTrace 提取思维链分析
 func extractCoTTrace(response string) string {
+	// 有 ```json 代码块时，思维链是代码块之前的内容
+	if _, fenceStart, ok := jsonFenceContent(response); ok {
+		return strings.TrimSpace(response[:fenceStart])
+	}
+
 	// 查找JSON数组的开始位置
 	jsonStart := strings.Index(response, "[")
 
@@ -428,18 +934,61 @@ func extractCoTTrace(response string) string {
 	return strings.TrimSpace(response)
 }
 
+// riskAssessmentMarker 风险评估段落的标记（部分提示词模板要求AI在JSON之前输出风险评估）
+const riskAssessmentMarker = "【风险评估】"
+
+// extractRiskAssessment 提取【风险评估】标记之后、JSON数组（或下一个【】标记）之前的内容，没有标记时返回空
+func extractRiskAssessment(response string) string {
+	start := strings.Index(response, riskAssessmentMarker)
+	if start < 0 {
+		return ""
+	}
+	block := response[start+len(riskAssessmentMarker):]
+	if end := strings.Index(block, "【"); end >= 0 {
+		block = block[:end]
+	}
+	if end := strings.Index(block, "```"); end >= 0 {
+		block = block[:end]
+	}
+	if end := strings.Index(block, "["); end >= 0 {
+		block = block[:end]
+	}
+	return strings.TrimSpace(block)
+}
+
 // extractDecisions 提取JSON决策列表
 func extractDecisions(response string) ([]Decision, error) {
+	jsonContent, err := extractDecisionJSON(response)
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析JSON
+	var decisions []Decision
+	if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
+		return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
+	}
+
+	return decisions, nil
+}
+
+// extractDecisionJSON 定位响应中的JSON决策数组并修复常见格式错误，返回可直接解析的JSON文本
+func extractDecisionJSON(response string) (string, error) {
+	// 有 ```json 代码块时只在代码块内查找（避免思维链中的"[2条]"之类文字被当成数组起点）
+	if fenced, _, ok := jsonFenceContent(response); ok {
+		response = fenced
+	}
+
 	// 直接查找JSON数组 - 找第一个完整的JSON数组
 	arrayStart := strings.Index(response, "[")
 	if arrayStart == -1 {
-		return nil, fmt.Errorf("无法找到JSON数组起始")
+		return "", errNoJSONArray
 	}
 
 	// 从 [ 开始，匹配括号找到对应的 ]
 	arrayEnd := findMatchingBracket(response, arrayStart)
 	if arrayEnd == -1 {
-		return nil, fmt.Errorf("无法找到JSON数组结束")
+		return "", fmt.Errorf("无法找到JSON数组结束")
 	}
 
 	jsonContent := strings.TrimSpace(response[arrayStart : arrayEnd+1])
@@ -450,144 +999,1119 @@ func extractDecisions(response string) ([]Decision, error) {
 	// 使用简单的字符串扫描而不是正则表达式
 	jsonContent = fixMissingQuotes(jsonContent)
 
-	// 解析JSON
-	var decisions []Decision
-	if err := json.Unmarshal([]byte(jsonContent), &decisions); err != nil {
-		return nil, fmt.Errorf("JSON解析失败: %w\nJSON内容: %s", err, jsonContent)
-	}
+	// 🔧 去掉 ] 和 } 前多余的逗号（AI经常在最后一个元素后多写逗号）
+	jsonContent = removeTrailingCommas(jsonContent)
 
-	return decisions, nil
+	return jsonContent, nil
 }
 
-// fixMissingQuotes 替换中文引号为英文引号（避免输入法自动转换）
-func fixMissingQuotes(jsonStr string) string {
-	jsonStr = strings.ReplaceAll(jsonStr, "\u201c", "\"") // "
-	jsonStr = strings.ReplaceAll(jsonStr, "\u201d", "\"") // "
-	jsonStr = strings.ReplaceAll(jsonStr, "\u2018", "'")  // '
-	jsonStr = strings.ReplaceAll(jsonStr, "\u2019", "'")  // '
-	return jsonStr
-}
+// jsonFenceMarker JSON代码块的起始标记（System Prompt 要求AI用它包裹决策数组）
+const jsonFenceMarker = "```json"
 
-// validateDecisions 验证所有决策（需要账户信息和杠杆配置）
-func validateDecisions(decisions []Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
-	for i, decision := range decisions {
-		if err := validateDecision(&decision, accountEquity, btcEthLeverage, altcoinLeverage); err != nil {
-			return fmt.Errorf("决策 #%d 验证失败: %w", i+1, err)
-		}
+// jsonFenceContent 返回 ```json 代码块内的内容及代码块在响应中的起始位置；没有代码块时 ok 为 false
+// 缺少结束标记（响应被截断）时返回起始标记之后的全部内容
+func jsonFenceContent(response string) (content string, fenceStart int, ok bool) {
+	fenceStart = strings.Index(response, jsonFenceMarker)
+	if fenceStart == -1 {
+		return "", -1, false
 	}
-	return nil
+	content = response[fenceStart+len(jsonFenceMarker):]
+	if end := strings.Index(content, "```"); end >= 0 {
+		content = content[:end]
+	}
+	return content, fenceStart, true
 }
 
-// findMatchingBracket 查找匹配的右括号
-func findMatchingBracket(s string, start int) int {
-	if start >= len(s) || s[start] != '[' {
-		return -1
+// unknownDecisionFields 找出AI输出中 Decision 不认识的字段（json.Unmarshal 会静默忽略，常见于字段名写错）
+func unknownDecisionFields(jsonContent string) []string {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(jsonContent), &raw); err != nil {
+		return nil
 	}
 
-	depth := 0
-	for i := start; i < len(s); i++ {
-		switch s[i] {
-		case '[':
-			depth++
-		case ']':
-			depth--
-			if depth == 0 {
-				return i
+	known := make(map[string]bool)
+	t := reflect.TypeOf(Decision{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	var unknown []string
+	for _, obj := range raw {
+		for key := range obj {
+			if !known[key] && !seen[key] {
+				seen[key] = true
+				unknown = append(unknown, key)
 			}
 		}
 	}
+	sort.Strings(unknown)
+	return unknown
+}
 
-	return -1
+// unquotedStringFields AI常漏写引号的字符串字段
+var unquotedStringFields = map[string]bool{
+	"reasoning":     true,
+	"signal_type":   true,
+	"oi_signal":     true,
+	"oi_adjustment": true,
 }
 
-// validateDecision 验证单个决策的有效性
-func validateDecision(d *Decision, accountEquity float64, btcEthLeverage, altcoinLeverage int) error {
-	// 验证action
-	validActions := map[string]bool{
-		"open_long":   true,
-		"open_short":  true,
-		"close_long":  true,
-		"close_short": true,
-		"hold":        true,
-		"wait":        true,
-	}
+// fixMissingQuotes 修复AI输出中的引号问题：
+// 1. 替换中文引号为英文引号（避免输入法自动转换）
+// 2. 为缺少引号的字符串字段值补上引号，如 "reasoning": 内容} → "reasoning": "内容"}（值截止到下一个 , 或 } ]）
+func fixMissingQuotes(jsonStr string) string {
+	jsonStr = strings.ReplaceAll(jsonStr, "\u201c", "\"") // "
+	jsonStr = strings.ReplaceAll(jsonStr, "\u201d", "\"") // "
+	jsonStr = strings.ReplaceAll(jsonStr, "\u2018", "'")  // '
+	jsonStr = strings.ReplaceAll(jsonStr, "\u2019", "'")  // '
+	return quoteBareStringValues(jsonStr)
+}
 
-	if !validActions[d.Action] {
-		return fmt.Errorf("无效的action: %s", d.Action)
-	}
+// quoteBareStringValues 扫描JSON文本（跳过字符串内容），为 unquotedStringFields 中值未加引号的字段补上引号
+func quoteBareStringValues(jsonStr string) string {
+	var sb strings.Builder
+	sb.Grow(len(jsonStr) + 16)
+	i := 0
+	for i < len(jsonStr) {
+		c := jsonStr[i]
+		if c != '"' {
+			sb.WriteByte(c)
+			i++
+			continue
+		}
 
-	// 开仓操作必须提供完整参数
-	if d.Action == "open_long" || d.Action == "open_short" {
-		// 根据币种使用配置的杠杆上限
-		maxLeverage := altcoinLeverage          // 山寨币使用配置的杠杆
-		maxPositionValue := accountEquity * 1.5 // 山寨币最多1.5倍账户净值
-		if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-			maxLeverage = btcEthLeverage          // BTC和ETH使用配置的杠杆
-			maxPositionValue = accountEquity * 10 // BTC/ETH最多10倍账户净值
-		}
-
-		if d.Leverage <= 0 || d.Leverage > maxLeverage {
-			return fmt.Errorf("杠杆必须在1-%d之间（%s，当前配置上限%d倍）: %d", maxLeverage, d.Symbol, maxLeverage, d.Leverage)
-		}
-		if d.PositionSizeUSD <= 0 {
-			return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
-		}
-		// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
-		tolerance := maxPositionValue * 0.01 // 1%容差
-		if d.PositionSizeUSD > maxPositionValue+tolerance {
-			if d.Symbol == "BTCUSDT" || d.Symbol == "ETHUSDT" {
-				return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
-			} else {
-				return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+		// 读取完整的字符串token
+		end := i + 1
+		for escaped := false; end < len(jsonStr); end++ {
+			if escaped {
+				escaped = false
+			} else if jsonStr[end] == '\\' {
+				escaped = true
+			} else if jsonStr[end] == '"' {
+				break
 			}
 		}
-		if d.StopLoss <= 0 || d.TakeProfit <= 0 {
-			return fmt.Errorf("止损和止盈必须大于0")
+		if end >= len(jsonStr) {
+			sb.WriteString(jsonStr[i:])
+			break
 		}
-
-		// 验证止损止盈的合理性
-		if d.Action == "open_long" {
-			if d.StopLoss >= d.TakeProfit {
-				return fmt.Errorf("做多时止损价必须小于止盈价")
-			}
-		} else {
-			if d.StopLoss <= d.TakeProfit {
-				return fmt.Errorf("做空时止损价必须大于止盈价")
-			}
+		key := jsonStr[i+1 : end]
+		sb.WriteString(jsonStr[i : end+1])
+		i = end + 1
+		if !unquotedStringFields[key] {
+			continue
 		}
 
-		// 验证风险回报比（必须≥1:3）
-		// 计算入场价（假设当前市价）
-		var entryPrice float64
-		if d.Action == "open_long" {
-			// 做多：入场价在止损和止盈之间
-			entryPrice = d.StopLoss + (d.TakeProfit-d.StopLoss)*0.2 // 假设在20%位置入场
-		} else {
-			// 做空：入场价在止损和止盈之间
-			entryPrice = d.StopLoss - (d.StopLoss-d.TakeProfit)*0.2 // 假设在20%位置入场
+		// 字段名后跟冒号，且值不以引号开头时补引号
+		j := skipJSONSpace(jsonStr, i)
+		if j >= len(jsonStr) || jsonStr[j] != ':' {
+			continue
 		}
+		valueStart := skipJSONSpace(jsonStr, j+1)
+		if valueStart >= len(jsonStr) || jsonStr[valueStart] == '"' || strings.HasPrefix(jsonStr[valueStart:], "null") {
+			continue
+		}
+		valueEnd := valueStart
+		for valueEnd < len(jsonStr) && !strings.ContainsRune(",}]", rune(jsonStr[valueEnd])) {
+			valueEnd++
+		}
+		value := strings.TrimSpace(jsonStr[valueStart:valueEnd])
+		if value == "" {
+			continue
+		}
+		sb.WriteString(jsonStr[i:valueStart])
+		sb.WriteString(strconv.Quote(value))
+		i = valueEnd
+	}
+	return sb.String()
+}
+
+// skipJSONSpace 返回从 i 开始第一个非空白字符的位置
+func skipJSONSpace(s string, i int) int {
+	for i < len(s) && strings.ContainsRune(" \t\r\n", rune(s[i])) {
+		i++
+	}
+	return i
+}
 
-		var riskPercent, rewardPercent, riskRewardRatio float64
-		if d.Action == "open_long" {
-			riskPercent = (entryPrice - d.StopLoss) / entryPrice * 100
-			rewardPercent = (d.TakeProfit - entryPrice) / entryPrice * 100
-			if riskPercent > 0 {
-				riskRewardRatio = rewardPercent / riskPercent
+// removeTrailingCommas 删除 ] 和 } 前的多余逗号（跳过字符串内容）
+func removeTrailingCommas(jsonStr string) string {
+	var sb strings.Builder
+	sb.Grow(len(jsonStr))
+	inString, escaped := false, false
+	for i := 0; i < len(jsonStr); i++ {
+		c := jsonStr[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
 			}
-		} else {
-			riskPercent = (d.StopLoss - entryPrice) / entryPrice * 100
-			rewardPercent = (entryPrice - d.TakeProfit) / entryPrice * 100
-			if riskPercent > 0 {
-				riskRewardRatio = rewardPercent / riskPercent
+			sb.WriteByte(c)
+			continue
+		}
+		if c == '"' {
+			inString = true
+		}
+		if c == ',' {
+			// 向后跳过空白，若下一个字符是 ] 或 } 则丢弃该逗号（如 take_profit_levels 或决策数组末尾的逗号）
+			j := skipJSONSpace(jsonStr, i+1)
+			if j < len(jsonStr) && (jsonStr[j] == ']' || jsonStr[j] == '}') {
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// actionAliases AI常用的动作别名 → 标准动作
+var actionAliases = map[string]string{
+	"long":       "open_long",
+	"buy":        "open_long",
+	"short":      "open_short",
+	"sell":       "open_short",
+	"exit_long":  "close_long",
+	"exit_short": "close_short",
+	"none":       "wait",
+	"skip":       "wait",
+	"no_action":  "wait",
+}
+
+// normalizeAction 统一动作写法（大小写、空格/连字符）并映射常见别名
+func normalizeAction(action string) string {
+	action = strings.ToLower(strings.TrimSpace(action))
+	action = strings.NewReplacer("-", "_", " ", "_").Replace(action)
+	if canonical, ok := actionAliases[action]; ok {
+		return canonical
+	}
+	return action
+}
+
+// normalizeDecisions 标准化决策字段（原地修改）
+func normalizeDecisions(decisions []Decision, ctx *Context) {
+	for i := range decisions {
+		d := &decisions[i]
+		d.Action = normalizeAction(d.Action)
+		// 未指定交易所时使用主交易所
+		if d.Exchange == "" {
+			d.Exchange = ctx.PrimaryExchange
+		}
+		// 只给出分批止盈时，第一目标作为主止盈价
+		if d.TakeProfit <= 0 && len(d.TakeProfitLevels) > 0 {
+			d.TakeProfit = d.TakeProfitLevels[0]
+		}
+		// 开仓未给出滑点容忍度时使用配置的默认值
+		if isOpenAction(d.Action) && d.SlippageBps == 0 && ctx.Risk.DefaultSlippageBps > 0 {
+			d.SlippageBps = ctx.Risk.DefaultSlippageBps
+		}
+		// 开仓未给出杠杆时使用配置的默认杠杆（不超过该币种的杠杆上限）
+		if isOpenAction(d.Action) && d.Leverage == 0 && ctx.Risk.DefaultLeverage > 0 {
+			maxLeverage := maxLeverageFor(d.Symbol, ctx)
+			d.Leverage = ctx.Risk.DefaultLeverage
+			if maxLeverage > 0 && d.Leverage > maxLeverage {
+				d.Leverage = maxLeverage
 			}
+			log.Printf("⚠️  %s %s 未指定杠杆，使用默认杠杆 %dx", d.Symbol, d.Action, d.Leverage)
+		}
+		// 杠杆不在允许档位时调整到最近的档位（可配置，默认拒绝）
+		if isOpenAction(d.Action) && d.Leverage > 0 && ctx.Risk.SnapLeverage && len(ctx.Risk.AllowedLeverages) > 0 &&
+			!containsInt(ctx.Risk.AllowedLeverages, d.Leverage) {
+			snapped := snapLeverage(d.Leverage, ctx.Risk.AllowedLeverages)
+			log.Printf("⚠️  %s 杠杆%dx不在允许档位%v中，调整为%dx", d.Symbol, d.Leverage, ctx.Risk.AllowedLeverages, snapped)
+			d.Leverage = snapped
 		}
+	}
+}
 
-		// 硬约束：风险回报比必须≥3.0
-		if riskRewardRatio < 3.0 {
-			return fmt.Errorf("风险回报比过低(%.2f:1)，必须≥3.0:1 [风险:%.2f%% 收益:%.2f%%] [止损:%.2f 止盈:%.2f]",
-				riskRewardRatio, riskPercent, rewardPercent, d.StopLoss, d.TakeProfit)
+// dedupPositionCandidateDecisions 既是持仓又是候选的币种，AI可能同时给出持仓管理和开仓决策
+// 此时优先持仓管理：持有(hold)时丢弃该币种的开仓，平仓后同方向重新开仓也丢弃（反向开仓视为反手，保留）
+func dedupPositionCandidateDecisions(decisions []Decision, ctx *Context) ([]Decision, []string) {
+	candidates := make(map[string]bool, len(ctx.CandidateCoins))
+	for _, coin := range ctx.CandidateCoins {
+		candidates[coin.Symbol] = true
+	}
+	held := make(map[string]bool)
+	for _, pos := range activePositions(ctx.Positions) {
+		if candidates[pos.Symbol] {
+			held[pos.Symbol] = true
+		}
+	}
+	if len(held) == 0 {
+		return decisions, nil
+	}
+
+	holding := make(map[string]bool) // symbol -> 有hold决策
+	closing := make(map[string]bool) // symbol_side -> 有平仓决策
+	for _, d := range decisions {
+		switch d.Action {
+		case "hold":
+			holding[d.Symbol] = true
+		case "close_long", "close_short":
+			closing[d.Symbol+"_"+positionSide(d.Action)] = true
 		}
 	}
 
+	var warnings []string
+	kept := make([]Decision, 0, len(decisions))
+	for _, d := range decisions {
+		if isOpenAction(d.Action) && held[d.Symbol] {
+			if holding[d.Symbol] {
+				warnings = append(warnings, fmt.Sprintf("%s 同时有hold和%s决策，已忽略开仓（优先持仓管理）", d.Symbol, d.Action))
+				continue
+			}
+			if closing[d.Symbol+"_"+positionSide(d.Action)] {
+				warnings = append(warnings, fmt.Sprintf("%s 平仓后又同方向%s，已忽略开仓（优先持仓管理）", d.Symbol, d.Action))
+				continue
+			}
+		}
+		kept = append(kept, d)
+	}
+	return kept, warnings
+}
+
+// validateDecisions 验证所有决策（需要账户信息、持仓和杠杆配置）
+// 不在第一个错误处停止：收集全部决策的错误和批次层面的错误，以 *ValidationErrors 返回，便于一次看到所有问题
+func validateDecisions(decisions []Decision, ctx *Context) error {
+	// 观察模式：所有交易动作降级为观望（保留AI的理由用于记录）
+	if !ctx.tradingEnabled() {
+		downgradeToAdvisory(decisions)
+	}
+
+	stampBreakerContext(decisions, ctx)
+
+	verrs := &ValidationErrors{}
+	known := knownSymbols(ctx)
+	for i := range decisions {
+		decision := decisions[i]
+		if err := validateSingleDecision(&decision, ctx, known); err != nil {
+			verrs.Decisions = append(verrs.Decisions, DecisionError{Index: i, Symbol: decision.Symbol, Err: err})
+		}
+	}
+
+	for _, check := range []func([]Decision, *Context) error{
+		validateConflicts,     // 同一交易所同一币种只允许一个开仓决策
+		validatePositionLimit, // 持仓数量上限检查
+		validateSideBalance,   // 多空平衡检查
+		validateRiskBudget,    // 组合层面的风险预算检查
+	} {
+		if err := check(decisions, ctx); err != nil {
+			verrs.Batch = append(verrs.Batch, err)
+		}
+	}
+
+	if len(verrs.Decisions) == 0 && len(verrs.Batch) == 0 {
+		return nil
+	}
+	return verrs
+}
+
+// validateSingleDecision 验证单个决策，返回第一个失败的检查
+func validateSingleDecision(decision *Decision, ctx *Context, known []string) error {
+	if err := validateKnownSymbol(decision, known); err != nil {
+		return err
+	}
+	if err := validateDecision(decision, ctx); err != nil {
+		return err
+	}
+	if err := validatePositionTarget(decision, ctx); err != nil {
+		return err
+	}
+	if err := validateExchangeLimits(decision, ctx); err != nil {
+		return err
+	}
+	if err := validatePartialCloseRemainder(decision, ctx); err != nil {
+		return err
+	}
+	if err := validateAnalyzedSymbol(decision, ctx); err != nil {
+		return err
+	}
+	if err := validateSignalType(decision, ctx); err != nil {
+		return err
+	}
+	if err := validateHoldReasoning(decision, ctx.MinHoldReasoningLen); err != nil {
+		return err
+	}
+	// 分批止盈最后一级目标风险回报比不足时拒绝（可配置，默认只警告）
+	if ctx.Risk.RejectWeakLadder {
+		if w := weakLadder(decision, ctx); w != "" {
+			return fmt.Errorf("%s %s", decision.Symbol, w)
+		}
+	}
+	// 止损距离小于K倍ATR时拒绝（可配置，默认只警告）
+	if ctx.Risk.RejectTightStop {
+		if w := tightStop(decision, ctx); w != "" {
+			return fmt.Errorf("%s %s", decision.Symbol, w)
+		}
+	}
+	// 开仓方向与指标明显矛盾时拒绝（可配置，默认只警告）
+	if ctx.Risk.RejectContradictions {
+		if c := DataContradiction(decision, ctx.MarketDataMap[decision.Symbol]); c != "" {
+			return fmt.Errorf("%s %s", decision.Symbol, c)
+		}
+	}
+	// 可用余额低于保留底线时只允许平仓/持有（可配置）
+	if increasesExposure(decision.Action) && ctx.Risk.MinAvailableBalanceUSD > 0 && ctx.Account.AvailableBalance < ctx.Risk.MinAvailableBalanceUSD {
+		return fmt.Errorf("可用余额%.2f USDT低于保留底线%.2f USDT，禁止开仓: %s %s",
+			ctx.Account.AvailableBalance, ctx.Risk.MinAvailableBalanceUSD, decision.Symbol, decision.Action)
+	}
+	// 熔断期间（夏普比率冷却、日亏损上限、净值突变）只允许持仓管理和防御性操作（可配置）
+	if b := decision.Breaker; b != nil && !b.Permitted {
+		return fmt.Errorf("%s，禁止开仓: %s %s", b.Reason, decision.Symbol, decision.Action)
+	}
+	// 低流动性时段收紧开仓要求（可配置）
+	if err := validateLowLiquidity(decision, ctx, time.Now()); err != nil {
+		return err
+	}
+	// 扫描周期只允许防御性操作（可配置）
+	if ctx.CycleType == CycleTypeScan && ctx.Risk.ScanDefensiveOnly && increasesExposure(decision.Action) {
+		return fmt.Errorf("扫描周期只允许持仓管理和防御性操作，禁止开仓: %s %s", decision.Symbol, decision.Action)
+	}
 	return nil
 }
+
+// DecisionError 单个决策的验证错误（Index 为决策在数组中的下标，从0开始）
+type DecisionError struct {
+	Index  int
+	Symbol string
+	Err    error
+}
+
+func (e DecisionError) Error() string {
+	return fmt.Sprintf("决策 #%d 验证失败: %v", e.Index+1, e.Err)
+}
+
+func (e DecisionError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError 批次层面的验证错误（Indices 为导致超限的决策下标，从0开始，为空表示无法归因到具体决策）
+type BatchError struct {
+	Indices []int
+	Err     error
+}
+
+func (e *BatchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors 一批决策的全部验证错误：逐个决策的错误和批次层面（冲突、持仓上限、多空平衡、风险预算）的错误
+type ValidationErrors struct {
+	Decisions []DecisionError
+	Batch     []error
+}
+
+func (e *ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e.Decisions)+len(e.Batch))
+	for _, de := range e.Decisions {
+		lines = append(lines, de.Error())
+	}
+	for _, err := range e.Batch {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (e *ValidationErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e.Decisions)+len(e.Batch))
+	for _, de := range e.Decisions {
+		errs = append(errs, de)
+	}
+	return append(errs, e.Batch...)
+}
+
+// Failed 判断第 index 个决策（从0开始）是否未通过单个决策的验证
+func (e *ValidationErrors) Failed(index int) bool {
+	for _, de := range e.Decisions {
+		if de.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// venueKey 生成"交易所|币种"键，同币种不同交易所视为不同的持仓
+func venueKey(exchange, symbol string, ctx *Context) string {
+	if exchange == "" {
+		exchange = ctx.PrimaryExchange
+	}
+	return exchange + "|" + symbol
+}
+
+// validateConflicts 检查同一交易所同一币种上的冲突开仓（如同时开多和开空）
+func validateConflicts(decisions []Decision, ctx *Context) error {
+	opened := make(map[string]int) // venueKey -> 决策序号
+	for i, d := range decisions {
+		if !isOpenAction(d.Action) {
+			continue
+		}
+		key := venueKey(d.Exchange, d.Symbol, ctx)
+		if j, ok := opened[key]; ok {
+			return &BatchError{Indices: []int{i}, Err: fmt.Errorf("决策冲突: 决策 #%d 和 #%d 在同一交易所对 %s 重复开仓（%s / %s）",
+				j+1, i+1, d.Symbol, decisions[j].Action, d.Action)}
+		}
+		opened[key] = i
+	}
+	return nil
+}
+
+// validateAnalyzedSymbol 拒绝对未分析币种开仓（不在市场数据中，决策没有任何数据依据，可能是AI臆造的币种）
+func validateAnalyzedSymbol(d *Decision, ctx *Context) error {
+	if !isOpenAction(d.Action) {
+		return nil
+	}
+	if _, ok := ctx.MarketDataMap[d.Symbol]; ok {
+		return nil
+	}
+	// 已有持仓的币种不受限制
+	for _, pos := range activePositions(ctx.Positions) {
+		if pos.Symbol == d.Symbol {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s 不在本周期分析的币种范围内（无市场数据），禁止开仓", d.Symbol)
+}
+
+// validatePositionTarget 检查持仓管理动作指向真实存在的持仓：close_long/close_short 需要对应方向的持仓，
+// partial_close/update_stop 需要该币种有持仓（任一方向）；方向不符时在错误中给出实际持仓方向
+func validatePositionTarget(d *Decision, ctx *Context) error {
+	var wantSide string
+	switch d.Action {
+	case "close_long":
+		wantSide = "long"
+	case "close_short":
+		wantSide = "short"
+	case "partial_close", "update_stop":
+	default:
+		return nil
+	}
+
+	var held []string
+	for _, pos := range activePositions(ctx.Positions) {
+		if pos.Symbol != d.Symbol {
+			continue
+		}
+		if wantSide == "" || pos.Side == wantSide {
+			return nil
+		}
+		held = append(held, pos.Side)
+	}
+	if len(held) > 0 {
+		return fmt.Errorf("%s %s: 没有%s持仓，实际持仓方向为 %s", d.Symbol, d.Action, wantSide, strings.Join(held, "/"))
+	}
+	return fmt.Errorf("%s %s: 该币种没有持仓", d.Symbol, d.Action)
+}
+
+// tradingEnabled 判断是否允许交易（TradingEnabled 未设置时默认允许）
+func (ctx *Context) tradingEnabled() bool {
+	return ctx.TradingEnabled == nil || *ctx.TradingEnabled
+}
+
+// downgradeToAdvisory 把全部交易动作改为 wait，原动作记在理由前面，决策只作为建议保留
+func downgradeToAdvisory(decisions []Decision) {
+	for i := range decisions {
+		d := &decisions[i]
+		if d.Action == "hold" || d.Action == "wait" {
+			continue
+		}
+		log.Printf("🔒 观察模式: %s %s 降级为观望", d.Symbol, d.Action)
+		d.Reasoning = fmt.Sprintf("[观察模式，建议动作: %s] %s", d.Action, d.Reasoning)
+		d.Action = "wait"
+	}
+}
+
+// knownSymbols 返回上下文中的全部币种（持仓在前、候选币种在后，去重）
+func knownSymbols(ctx *Context) []string {
+	var symbols []string
+	seen := make(map[string]bool)
+	add := func(symbol string) {
+		if symbol != "" && !seen[symbol] {
+			seen[symbol] = true
+			symbols = append(symbols, symbol)
+		}
+	}
+	for _, pos := range activePositions(ctx.Positions) {
+		add(pos.Symbol)
+	}
+	for _, coin := range ctx.CandidateCoins {
+		add(coin.Symbol)
+	}
+	return symbols
+}
+
+// validateKnownSymbol 拒绝对上下文中不存在的币种（既不是候选币种也没有持仓，通常是AI臆造的）进行交易操作
+// 上下文中没有任何币种时（如离线验证）不检查
+func validateKnownSymbol(d *Decision, known []string) error {
+	if len(known) == 0 || d.Action == "hold" || d.Action == "wait" {
+		return nil
+	}
+	for _, symbol := range known {
+		if d.Symbol == symbol {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %s: 币种不在候选币种或持仓中，可用币种: %s", d.Symbol, d.Action, strings.Join(known, ", "))
+}
+
+// DefaultSignalTypes 默认的开仓信号类型
+var DefaultSignalTypes = []string{"trend_follow", "breakout", "squeeze", "bottom_fish", "reversal", "mean_reversion"}
+
+// signalTypes 返回已知的信号类型列表
+func signalTypes(ctx *Context) []string {
+	if len(ctx.AllowedSignalTypes) > 0 {
+		return ctx.AllowedSignalTypes
+	}
+	return DefaultSignalTypes
+}
+
+// validateSignalType 严格模式下要求开仓给出信号类型，保证每笔交易都可以分类分析
+func validateSignalType(d *Decision, ctx *Context) error {
+	if ctx.RequireSignalType && isOpenAction(d.Action) && strings.TrimSpace(d.SignalType) == "" {
+		return fmt.Errorf("%s 开仓缺少signal_type，可选: %s", d.Symbol, strings.Join(signalTypes(ctx), ", "))
+	}
+	return nil
+}
+
+// validateHoldReasoning 严格模式下要求hold决策给出足够充分的理由（趋势是否完好、止损是否合理等）
+func validateHoldReasoning(d *Decision, minLen int) error {
+	if minLen <= 0 || d.Action != "hold" {
+		return nil
+	}
+	if n := utf8.RuneCountInString(strings.TrimSpace(d.Reasoning)); n < minLen {
+		return fmt.Errorf("%s hold理由过短(%d字符)，至少需要%d字符说明继续持有的依据", d.Symbol, n, minLen)
+	}
+	return nil
+}
+
+// findMatchingBracket 查找匹配的右括号（忽略JSON字符串值中的括号，处理反斜杠转义）
+func findMatchingBracket(s string, start int) int {
+	if start >= len(s) || s[start] != '[' {
+		return -1
+	}
+
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		// 字符串内的括号（如 reasoning 中的"区间[3800,3900]"）不参与计数
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// validateDecision 验证单个决策的有效性
+// 默认遇到第一个错误即返回；ctx.CollectAllErrors 开启时汇总该决策的全部错误一次性返回，便于AI一次修正
+func validateDecision(d *Decision, ctx *Context) error {
+	// 验证action
+	validActions := map[string]bool{
+		"open_long":     true,
+		"open_short":    true,
+		"close_long":    true,
+		"close_short":   true,
+		"add_long":      true,
+		"add_short":     true,
+		"update_stop":   true,
+		"partial_close": true,
+		"hold":          true,
+		"wait":          true,
+	}
+
+	if !validActions[d.Action] {
+		return fmt.Errorf("无效的action: %s", d.Action)
+	}
+
+	// 持仓管理动作的参数检查
+	switch d.Action {
+	case "update_stop":
+		if d.NewStopLoss == nil || *d.NewStopLoss <= 0 {
+			return fmt.Errorf("update_stop 必须提供大于0的 new_stop_loss")
+		}
+		return nil
+	case "partial_close":
+		if d.ClosePercentage < 1 || d.ClosePercentage > 100 {
+			return fmt.Errorf("partial_close 的 close_percentage 必须在1-100之间: %.2f", d.ClosePercentage)
+		}
+		return nil
+	}
+
+	// 补仓只能补足部分成交的持仓
+	if isAddAction(d.Action) {
+		return validateAddDecision(d, ctx)
+	}
+
+	// 开仓操作必须提供完整参数
+	if !isOpenAction(d.Action) {
+		return nil
+	}
+
+	var errs []error
+	for _, check := range []func(*Decision, *Context) error{
+		validateOpenLeverage,
+		validateOpenPositionSize,
+		validateOpenLimitOrder,
+		validateOpenPrices,
+		validateOpenRiskReward,
+		validateOpenStopLeverage,
+		validateOpenSlippage,
+	} {
+		if err := check(d, ctx); err != nil {
+			if !ctx.CollectAllErrors {
+				return err
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateAddDecision 验证补仓决策：必须有同方向的部分成交持仓，补仓价值不超过未成交部分
+func validateAddDecision(d *Decision, ctx *Context) error {
+	side := positionSide(d.Action)
+	pos := findPosition(ctx, d.Symbol, side)
+	if pos == nil {
+		return fmt.Errorf("%s 没有%s持仓，无法%s", d.Symbol, side, d.Action)
+	}
+	if d.PositionSizeUSD <= 0 {
+		return fmt.Errorf("补仓价值必须大于0: %.2f", d.PositionSizeUSD)
+	}
+
+	remaining := pos.IntendedQuantity - pos.Quantity
+	if pos.IntendedQuantity <= 0 || remaining <= 0 {
+		return fmt.Errorf("%s %s持仓已完全成交（或计划数量未知），不允许补仓", d.Symbol, side)
+	}
+
+	price := pos.MarkPrice
+	if price <= 0 {
+		price = pos.EntryPrice
+	}
+	maxAddUSD := remaining * price
+	if d.PositionSizeUSD > maxAddUSD*1.01 { // 1%容差
+		return fmt.Errorf("%s 补仓价值%.2f超过未成交部分%.2f USDT（计划数量%.4f，已成交%.4f）",
+			d.Symbol, d.PositionSizeUSD, maxAddUSD, pos.IntendedQuantity, pos.Quantity)
+	}
+
+	// 补仓下单会撤销该币种的全部挂单，成交后按总数量重新挂止损止盈，因此必须给出整个持仓的止损止盈
+	if d.StopLoss <= 0 || d.TakeProfit <= 0 {
+		return fmt.Errorf("%s 补仓必须给出整个持仓的 stop_loss 和 take_profit（补仓后按总数量重新挂单）", d.Symbol)
+	}
+	if side == "long" && (d.StopLoss >= price || d.TakeProfit <= price) {
+		return fmt.Errorf("%s 补多仓止损%.4f必须低于当前价格%.4f、止盈%.4f必须高于当前价格", d.Symbol, d.StopLoss, price, d.TakeProfit)
+	}
+	if side == "short" && (d.StopLoss <= price || d.TakeProfit >= price) {
+		return fmt.Errorf("%s 补空仓止损%.4f必须高于当前价格%.4f、止盈%.4f必须低于当前价格", d.Symbol, d.StopLoss, price, d.TakeProfit)
+	}
+	return nil
+}
+
+// findPosition 查找指定币种和方向的有效持仓
+func findPosition(ctx *Context, symbol, side string) *PositionInfo {
+	for _, pos := range activePositions(ctx.Positions) {
+		if pos.Symbol == symbol && pos.Side == side {
+			return &pos
+		}
+	}
+	return nil
+}
+
+// positionFilledPct 返回持仓的成交比例（%），计划数量未知时返回100
+func positionFilledPct(pos PositionInfo) float64 {
+	if pos.FilledPct > 0 {
+		return pos.FilledPct
+	}
+	if pos.IntendedQuantity <= 0 {
+		return 100
+	}
+	return pos.Quantity / pos.IntendedQuantity * 100
+}
+
+// maxLeverageFor 根据币种返回配置的杠杆上限
+func maxLeverageFor(symbol string, ctx *Context) int {
+	if isMajorSymbol(symbol) {
+		return ctx.BTCETHLeverage // BTC和ETH使用配置的杠杆
+	}
+	return ctx.AltcoinLeverage // 山寨币使用配置的杠杆
+}
+
+// validateOpenLeverage 验证开仓杠杆在配置范围内
+func validateOpenLeverage(d *Decision, ctx *Context) error {
+	maxLeverage := maxLeverageFor(d.Symbol, ctx)
+	if d.Leverage <= 0 || d.Leverage > maxLeverage {
+		return fmt.Errorf("杠杆必须在1-%d之间（%s，当前配置上限%d倍）: %d", maxLeverage, d.Symbol, maxLeverage, d.Leverage)
+	}
+	if allowed := ctx.Risk.AllowedLeverages; len(allowed) > 0 && !containsInt(allowed, d.Leverage) {
+		return fmt.Errorf("杠杆%dx不是交易所允许的档位，可选: %v", d.Leverage, allowed)
+	}
+	return nil
+}
+
+// containsInt 判断切片中是否包含指定值
+func containsInt(values []int, v int) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// snapLeverage 将杠杆调整到最接近的允许档位（距离相同时取较低的档位）
+func snapLeverage(leverage int, allowed []int) int {
+	best := leverage
+	bestDist := -1
+	for _, v := range allowed {
+		dist := v - leverage
+		if dist < 0 {
+			dist = -dist
+		}
+		if bestDist < 0 || dist < bestDist || (dist == bestDist && v < best) {
+			best, bestDist = v, dist
+		}
+	}
+	return best
+}
+
+// validateOpenPositionSize 验证开仓仓位大小及单币种仓位价值上限
+func validateOpenPositionSize(d *Decision, ctx *Context) error {
+	maxPositionValue := maxPositionValueFor(d.Symbol, ctx)
+
+	if d.PositionSizeUSD <= 0 {
+		return fmt.Errorf("仓位大小必须大于0: %.2f", d.PositionSizeUSD)
+	}
+	// 验证仓位价值上限（加1%容差以避免浮点数精度问题）
+	tolerance := maxPositionValue * 0.01 // 1%容差
+	if d.PositionSizeUSD > maxPositionValue+tolerance {
+		if isMajorSymbol(d.Symbol) {
+			return fmt.Errorf("BTC/ETH单币种仓位价值不能超过%.0f USDT（10倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+		}
+		return fmt.Errorf("山寨币单币种仓位价值不能超过%.0f USDT（1.5倍账户净值），实际: %.0f", maxPositionValue, d.PositionSizeUSD)
+	}
+	return nil
+}
+
+// maxPositionValueFor 返回单币种仓位价值上限（BTC/ETH为10倍账户净值，山寨币为1.5倍）
+func maxPositionValueFor(symbol string, ctx *Context) float64 {
+	if isMajorSymbol(symbol) {
+		return ctx.Account.TotalEquity * 10
+	}
+	return ctx.Account.TotalEquity * 1.5
+}
+
+// validateOpenPrices 验证止损止盈的合理性（入场价假设在止损和止盈之间）
+func validateOpenPrices(d *Decision, ctx *Context) error {
+	if d.StopLoss <= 0 || d.TakeProfit <= 0 {
+		return fmt.Errorf("止损和止盈必须大于0")
+	}
+	return validatePriceStructure(positionSide(d.Action), assumedEntryPrice(d), d.StopLoss, takeProfitTargets(d))
+}
+
+// validateOpenLimitOrder 验证限价开仓：挂单价必须大于0，且做多挂在现价下方、做空挂在现价上方（否则会立即以市价成交）
+// 止损止盈相对挂单价的结构由 validateOpenPrices 检查（assumedEntryPrice 对限价单返回挂单价）
+func validateOpenLimitOrder(d *Decision, ctx *Context) error {
+	switch d.OrderType {
+	case "", OrderTypeMarket:
+		return nil
+	case OrderTypeLimit:
+	default:
+		return fmt.Errorf("无效的order_type: %s（只支持 market/limit）", d.OrderType)
+	}
+
+	if d.LimitPrice <= 0 {
+		return fmt.Errorf("限价单必须提供大于0的 limit_price")
+	}
+	data, ok := ctx.MarketDataMap[d.Symbol]
+	if !ok || data == nil || data.CurrentPrice <= 0 {
+		return nil
+	}
+	if d.Action == "open_long" && d.LimitPrice >= data.CurrentPrice {
+		return fmt.Errorf("做多限价单挂单价%.4f必须低于当前价格%.4f", d.LimitPrice, data.CurrentPrice)
+	}
+	if d.Action == "open_short" && d.LimitPrice <= data.CurrentPrice {
+		return fmt.Errorf("做空限价单挂单价%.4f必须高于当前价格%.4f", d.LimitPrice, data.CurrentPrice)
+	}
+	return nil
+}
+
+// validateOpenRiskReward 验证风险回报比（必须≥1:3）
+func validateOpenRiskReward(d *Decision, ctx *Context) error {
+	if d.StopLoss <= 0 || d.TakeProfit <= 0 {
+		return nil // 由 validateOpenPrices 报告
+	}
+
+	// 硬约束：风险回报比必须≥3.0（减去容差以避免浮点数精度问题）
+	riskRewardRatio, riskPercent, rewardPercent := openRiskReward(d, ctx)
+	if riskRewardRatio < minRiskRewardRatio-ctx.Risk.rrTolerance() {
+		return fmt.Errorf("风险回报比过低(%.2f:1)，必须≥%.1f:1 [风险:%.2f%% 收益:%.2f%%] [止损:%.2f 止盈:%.2f]",
+			riskRewardRatio, minRiskRewardRatio, riskPercent, rewardPercent, d.StopLoss, d.TakeProfit)
+	}
+	return nil
+}
+
+// openRiskReward 计算开仓的风险回报比及风险、收益百分比（已计入手续费）
+func openRiskReward(d *Decision, ctx *Context) (ratio, riskPercent, rewardPercent float64) {
+	entryPrice := assumedEntryPrice(d)
+	if d.Action == "open_long" {
+		riskPercent = (entryPrice - d.StopLoss) / entryPrice * 100
+		rewardPercent = (d.TakeProfit - entryPrice) / entryPrice * 100
+	} else {
+		riskPercent = (d.StopLoss - entryPrice) / entryPrice * 100
+		rewardPercent = (entryPrice - d.TakeProfit) / entryPrice * 100
+	}
+	// 计入手续费：止损出场多付一次吃单费，止盈出场按挂单费（未配置时按吃单费）
+	riskPercent += ctx.Risk.roundTripFeePct(false)
+	rewardPercent -= ctx.Risk.roundTripFeePct(true)
+	if riskPercent > 0 {
+		ratio = rewardPercent / riskPercent
+	}
+	return ratio, riskPercent, rewardPercent
+}
+
+// autoCorrectRiskReward 风险回报比略低于硬约束时，将第一止盈目标向外放宽到刚好满足约束（需配置 RRAutoCorrectMax）
+// 有分批止盈时按第一级目标（TakeProfitLevels[0]）计算和放宽，take_profit 只在等于第一级目标时同步修改；
+// 放宽后重新检查价格结构，分批止盈的顺序或间距被破坏时放弃修正（由验证阶段拒绝），返回修正说明
+func autoCorrectRiskReward(decisions []Decision, ctx *Context) []string {
+	maxGap := ctx.Risk.RRAutoCorrectMax
+	if maxGap <= 0 {
+		return nil
+	}
+
+	var notes []string
+	for i := range decisions {
+		d := &decisions[i]
+		if !isOpenAction(d.Action) || d.StopLoss <= 0 || d.TakeProfit <= 0 {
+			continue
+		}
+		first := *d
+		first.TakeProfit = takeProfitTargets(d)[0]
+		first.TakeProfitLevels = nil
+		if first.TakeProfit <= 0 {
+			continue
+		}
+		ratio, _, _ := openRiskReward(&first, ctx)
+		gap := minRiskRewardRatio - ratio
+		if gap <= ctx.Risk.rrTolerance() || gap > maxGap {
+			continue
+		}
+
+		tp, ok := widenTakeProfit(first, ctx)
+		if !ok {
+			continue
+		}
+		corrected := *d
+		if d.TakeProfit == first.TakeProfit {
+			corrected.TakeProfit = tp
+		}
+		if len(d.TakeProfitLevels) > 0 {
+			corrected.TakeProfitLevels = append([]float64{tp}, d.TakeProfitLevels[1:]...)
+		}
+		if err := validateOpenPrices(&corrected, ctx); err != nil {
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("决策 #%d %s: 风险回报比%.2f:1略低于%.1f:1，第一止盈目标 %.4f → %.4f",
+			i+1, d.Symbol, ratio, minRiskRewardRatio, first.TakeProfit, tp))
+		*d = corrected
+	}
+	return notes
+}
+
+// widenTakeProfit 二分查找使风险回报比刚好达到硬约束的第一止盈价（最多放宽到止损距离的10倍，找不到时返回false）
+func widenTakeProfit(d Decision, ctx *Context) (float64, bool) {
+	near := d.TakeProfit
+	far := d.TakeProfit + 10*(d.TakeProfit-d.StopLoss) // 做空时止盈在止损下方，方向自动为向下
+	if far <= 0 {
+		far = near / 2
+	}
+	d.TakeProfit = far
+	if ratio, _, _ := openRiskReward(&d, ctx); ratio < minRiskRewardRatio {
+		return 0, false
+	}
+	for i := 0; i < 60; i++ {
+		d.TakeProfit = (near + far) / 2
+		if ratio, _, _ := openRiskReward(&d, ctx); ratio >= minRiskRewardRatio {
+			far = d.TakeProfit
+		} else {
+			near = d.TakeProfit
+		}
+	}
+	return far, true
+}
+
+// validateOpenStopLeverage 验证止损距离×杠杆（触发止损时的保证金亏损比例）不超过上限
+// 例如10倍杠杆+8%止损意味着亏掉80%保证金，止损已接近甚至超过强平价，这种组合没有意义
+func validateOpenStopLeverage(d *Decision, ctx *Context) error {
+	limit := ctx.Risk.maxStopMarginLossPct()
+	entry := decisionEntryPrice(d, ctx)
+	if limit <= 0 || entry <= 0 || d.StopLoss <= 0 || d.Leverage <= 0 {
+		return nil
+	}
+
+	stopPct := math.Abs(entry-d.StopLoss) / entry * 100
+	if marginLossPct := stopPct * float64(d.Leverage); marginLossPct > limit {
+		return fmt.Errorf("止损距离%.2f%%×杠杆%dx=保证金亏损%.0f%%，超过上限%.0f%%（止损接近强平价），请降低杠杆或收紧止损",
+			stopPct, d.Leverage, marginLossPct, limit)
+	}
+	return nil
+}
+
+// maxSlippageBps 滑点容忍度上限（基点，500=5%）
+const maxSlippageBps = 500
+
+// validateOpenSlippage 验证滑点容忍度在合理范围内
+func validateOpenSlippage(d *Decision, ctx *Context) error {
+	if d.SlippageBps < 0 || d.SlippageBps > maxSlippageBps {
+		return fmt.Errorf("滑点容忍度必须在0-%d基点之间: %d", maxSlippageBps, d.SlippageBps)
+	}
+	return nil
+}
+
+// minRiskRewardRatio 开仓的最低风险回报比（硬约束）
+const minRiskRewardRatio = 3.0
+
+// defaultRRTolerance 风险回报比硬约束的默认容差
+const defaultRRTolerance = 0.02
+
+// minTakeProfitSpacingPct 相邻止盈目标的最小间距（占入场价百分比），过近的目标等同于重复
+const minTakeProfitSpacingPct = 0.1
+
+// validatePriceStructure 验证止损/止盈相对入场价的方向、顺序和间距
+// side 为 "long" 或 "short"，tps 按离入场价由近到远排列
+func validatePriceStructure(side string, entry, stop float64, tps []float64) error {
+	if entry <= 0 || stop <= 0 || len(tps) == 0 {
+		return fmt.Errorf("止损和止盈必须大于0")
+	}
+
+	// 先单独检查重复值，给AI更明确的错误提示
+	seen := make(map[float64]bool, len(tps))
+	for _, tp := range tps {
+		if seen[tp] {
+			return fmt.Errorf("重复的止盈目标: %v 中出现多次 %.4f，每个止盈目标必须不同", tps, tp)
+		}
+		seen[tp] = true
+	}
+
+	// dir: 做多为+1（止盈在上、止损在下），做空为-1
+	sideName, dir, order := "做多", 1.0, "递增"
+	stopSide, tpSide := "下方", "上方"
+	if side == "short" {
+		sideName, dir, order = "做空", -1.0, "递减"
+		stopSide, tpSide = "上方", "下方"
+	}
+
+	if (entry-stop)*dir <= 0 {
+		return fmt.Errorf("%s时止损价必须在入场价%s（止损:%.4f 入场:%.4f）", sideName, stopSide, stop, entry)
+	}
+
+	for i, tp := range tps {
+		if tp <= 0 {
+			return fmt.Errorf("止盈目标必须大于0: %v", tps)
+		}
+		if (tp-entry)*dir <= 0 {
+			return fmt.Errorf("%s时止盈价必须在入场价%s（止盈:%.4f 入场:%.4f）", sideName, tpSide, tp, entry)
+		}
+		if i == 0 {
+			continue
+		}
+		if (tp-tps[i-1])*dir <= 0 {
+			return fmt.Errorf("%s时止盈目标必须严格%s: %v", sideName, order, tps)
+		}
+		if math.Abs(tp-tps[i-1])/entry*100 < minTakeProfitSpacingPct {
+			return fmt.Errorf("止盈目标间距过小: %.4f 与 %.4f 相差不足%.1f%%", tps[i-1], tp, minTakeProfitSpacingPct)
+		}
+	}
+	return nil
+}
+
+// takeProfitTargets 返回决策的全部止盈目标（未给出分批止盈时使用单一止盈价）
+func takeProfitTargets(d *Decision) []float64 {
+	if len(d.TakeProfitLevels) > 0 {
+		return d.TakeProfitLevels
+	}
+	return []float64{d.TakeProfit}
+}
+
+// positionSide 根据动作返回持仓方向（"long" 或 "short"）
+func positionSide(action string) string {
+	if strings.HasSuffix(action, "_short") {
+		return "short"
+	}
+	return "long"
+}
+
+// assumedEntryPrice 估算开仓入场价（限价单为挂单价，否则入场价在止损和止盈之间，假设在20%位置入场）
+func assumedEntryPrice(d *Decision) float64 {
+	if isLimitOrder(d) {
+		return d.LimitPrice
+	}
+	if d.Action == "open_long" {
+		return d.StopLoss + (d.TakeProfit-d.StopLoss)*0.2
+	}
+	return d.StopLoss - (d.StopLoss-d.TakeProfit)*0.2
+}
+
+// isLimitOrder 判断是否为有效挂单价的限价开仓
+func isLimitOrder(d *Decision) bool {
+	return d.OrderType == OrderTypeLimit && d.LimitPrice > 0
+}
+
+// activePositions 过滤掉数量非正的持仓（数据不一致产生的幽灵仓位）
+func activePositions(positions []PositionInfo) []PositionInfo {
+	active := make([]PositionInfo, 0, len(positions))
+	for _, pos := range positions {
+		if pos.Quantity > 0 {
+			active = append(active, pos)
+		}
+	}
+	return active
+}
+
+// isMajorSymbol 判断是否为主流币（BTC/ETH），主流币适用独立的杠杆和仓位配置
+func isMajorSymbol(symbol string) bool {
+	return symbol == "BTCUSDT" || symbol == "ETHUSDT"
+}
+
+// isAddAction 判断是否为补仓动作（补足部分成交的持仓）
+func isAddAction(action string) bool {
+	return action == "add_long" || action == "add_short"
+}
+
+// increasesExposure 判断动作是否增加敞口（开仓或补仓），保护类规则对两者同样适用
+func increasesExposure(action string) bool {
+	return isOpenAction(action) || isAddAction(action)
+}
+
+// isOpenAction 判断是否为开仓类动作
+func isOpenAction(action string) bool {
+	return action == "open_long" || action == "open_short"
+}
@@ -0,0 +1,1149 @@
+package decision
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserPromptSharpeWindowLabel(t *testing.T) {
+	ctx := testContext()
+	ctx.Performance = map[string]interface{}{"sharpe_ratio": 1.5}
+
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "## 📊 夏普比率: 1.50") {
+		t.Errorf("未设置窗口时不应标注窗口:\n%s", prompt)
+	}
+
+	ctx.SharpeWindow = 12 * time.Hour
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "## 📊 夏普比率（12小时滚动窗口）: 1.50") {
+		t.Errorf("应标注12小时滚动窗口:\n%s", prompt)
+	}
+
+	ctx.SharpeWindow = 90 * time.Minute
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "夏普比率（90分钟滚动窗口）") {
+		t.Errorf("非整小时窗口应按分钟标注:\n%s", prompt)
+	}
+}
+
+// testOpens 返回对 testContext 中两个候选币种的有效开仓决策（ETH做多、SOL做空，止损风险各6 USDT）
+func testOpens() []Decision {
+	return []Decision{
+		{Symbol: "ETHUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 300, StopLoss: 2940, TakeProfit: 3300, Confidence: 80, Reasoning: "突破"},
+		{Symbol: "SOLUSDT", Action: "open_short", Leverage: 3, PositionSizeUSD: 300, StopLoss: 153, TakeProfit: 135, Confidence: 80, Reasoning: "跌破"},
+	}
+}
+
+func TestAcceptPartialBatchErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(ctx *Context)
+		decisions func() []Decision
+		kept      string
+		rejected  string
+	}{
+		{
+			name:      "持仓上限",
+			configure: func(ctx *Context) { ctx.MaxPositions = 2 },
+			decisions: testOpens,
+			kept:      "ETHUSDT open_long",
+			rejected:  "SOLUSDT open_short",
+		},
+		{
+			name:      "多空平衡",
+			configure: func(ctx *Context) { ctx.Risk.MaxSameSidePositions = 1 },
+			decisions: testOpens,
+			kept:      "SOLUSDT open_short",
+			rejected:  "ETHUSDT open_long",
+		},
+		{
+			name:      "风险预算",
+			configure: func(ctx *Context) { ctx.Risk.MaxTotalRiskPct = 1 },
+			decisions: testOpens,
+			kept:      "ETHUSDT open_long",
+			rejected:  "SOLUSDT open_short",
+		},
+		{
+			name:      "冲突开仓",
+			configure: func(ctx *Context) {},
+			decisions: func() []Decision {
+				ds := testOpens()
+				conflict := ds[1]
+				conflict.Symbol = "ETHUSDT"
+				conflict.StopLoss, conflict.TakeProfit = 3060, 2700
+				return []Decision{ds[0], conflict}
+			},
+			kept:     "ETHUSDT open_long",
+			rejected: "ETHUSDT open_short",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			ctx.AcceptPartial = true
+			tt.configure(ctx)
+			decisions := tt.decisions()
+
+			err := validateDecisions(decisions, ctx)
+			if err == nil {
+				t.Fatal("整批决策应未通过批次检查")
+			}
+			kept, rejected, ok := acceptPartial(decisions, err, ctx)
+			if !ok {
+				t.Fatalf("批次错误可归因到具体决策，应只剔除超限的决策: %v", err)
+			}
+			if len(kept) != 1 || kept[0].Symbol+" "+kept[0].Action != tt.kept {
+				t.Errorf("保留的决策错误: %+v", kept)
+			}
+			if len(rejected) != 1 || rejected[0].Decision.Symbol+" "+rejected[0].Decision.Action != tt.rejected || rejected[0].Reason == "" {
+				t.Errorf("剔除的决策错误: %+v", rejected)
+			}
+		})
+	}
+}
+
+func TestAcceptPartialUnattributableBatchError(t *testing.T) {
+	ctx := testContext()
+	ctx.AcceptPartial = true
+	decisions := testOpens()
+
+	// 无法归因到具体决策的批次错误（如自定义检查返回的普通错误）应整批拒绝
+	for _, batchErr := range []error{
+		errors.New("自定义批次检查失败"),
+		&BatchError{Err: errors.New("没有可剔除的决策")},
+	} {
+		err := &ValidationErrors{Batch: []error{batchErr}}
+		if _, _, ok := acceptPartial(decisions, err, ctx); ok {
+			t.Errorf("无法归因的批次错误应整批拒绝: %v", batchErr)
+		}
+	}
+
+	// 现有持仓的止损风险（0.01 BTC × 20000 = 200 USDT）已超出预算时，只剔除增加风险的开仓
+	ctx.Risk.MaxTotalRiskPct = 1
+	ctx.Positions[0].StopLoss = 80000
+	decisions = append(testOpens(), Decision{Symbol: "BTCUSDT", Action: "hold", Reasoning: "趋势未变"})
+	err := validateDecisions(decisions, ctx)
+	if err == nil {
+		t.Fatal("应超出风险预算")
+	}
+	kept, rejected, ok := acceptPartial(decisions, err, ctx)
+	if !ok || len(kept) != 1 || kept[0].Action != "hold" || len(rejected) != 2 {
+		t.Errorf("应剔除两个开仓并保留持有: kept=%+v rejected=%d ok=%v", kept, len(rejected), ok)
+	}
+}
+
+func TestCycleTypeScanDefensiveOnly(t *testing.T) {
+	for _, tt := range []struct {
+		cycleType string
+		wantErr   bool
+	}{
+		{CycleTypeScan, true},
+		{CycleTypeEvaluate, false},
+		{"", false},
+	} {
+		ctx := testContext()
+		ctx.CycleType = tt.cycleType
+		ctx.Risk.ScanDefensiveOnly = true
+		err := validateDecisions(testOpens(), ctx)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("周期类型 %q: error = %v, wantErr %v", tt.cycleType, err, tt.wantErr)
+		}
+	}
+
+	// 扫描周期仍允许平仓
+	ctx := testContext()
+	ctx.CycleType = CycleTypeScan
+	ctx.Risk.ScanDefensiveOnly = true
+	closing := []Decision{{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈离场"}}
+	if err := validateDecisions(closing, ctx); err != nil {
+		t.Errorf("扫描周期应允许平仓: %v", err)
+	}
+}
+
+func TestValidatePriceStructureDuplicateTakeProfits(t *testing.T) {
+	for name, tps := range map[string][]float64{
+		"相邻重复":  {105, 105, 110},
+		"不相邻重复": {105, 110, 105},
+	} {
+		err := validatePriceStructure("long", 100, 95, tps)
+		if err == nil || !strings.Contains(err.Error(), "重复的止盈目标") {
+			t.Errorf("%s %v: 应报告重复的止盈目标, got %v", name, tps, err)
+		}
+	}
+}
+
+func TestValidatePriceStructure(t *testing.T) {
+	tests := []struct {
+		name    string
+		side    string
+		stop    float64
+		tps     []float64
+		wantErr bool
+	}{
+		{"做多有效", "long", 95, []float64{105, 110, 120}, false},
+		{"做多止损在上方", "long", 102, []float64{110}, true},
+		{"做多止盈在下方", "long", 95, []float64{98}, true},
+		{"做多止盈未递增", "long", 95, []float64{110, 105}, true},
+		{"做多止盈间距过小", "long", 95, []float64{105, 105.05}, true},
+		{"做空有效", "short", 105, []float64{95, 90, 80}, false},
+		{"做空止损在下方", "short", 98, []float64{90}, true},
+		{"做空止盈在上方", "short", 105, []float64{102}, true},
+		{"做空止盈未递减", "short", 105, []float64{90, 95}, true},
+		{"止损为0", "long", 0, []float64{110}, true},
+		{"没有止盈", "short", 105, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePriceStructure(tt.side, 100, tt.stop, tt.tps)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validatePriceStructure(%s, 100, %v, %v) error = %v, wantErr %v", tt.side, tt.stop, tt.tps, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckCycleInterval(t *testing.T) {
+	ctx := &Context{MinCycleInterval: time.Minute, LastCycleTime: time.Now().Add(-10 * time.Second)}
+	if _, err := GetFullDecision(ctx, nil); !errors.Is(err, ErrCycleTooSoon) {
+		t.Errorf("间隔不足时应返回 ErrCycleTooSoon, got %v", err)
+	}
+
+	ctx.LastCycleTime = time.Now().Add(-2 * time.Minute)
+	if err := checkCycleInterval(ctx); err != nil {
+		t.Errorf("间隔足够时应继续: %v", err)
+	}
+
+	if err := checkCycleInterval(&Context{MinCycleInterval: time.Minute}); err != nil {
+		t.Errorf("第一个周期不应受限制: %v", err)
+	}
+}
+
+func TestProcessResponseNoJSON(t *testing.T) {
+	const response = "市场震荡，没有明确方向，本周期继续观察。"
+
+	ctx := testContext()
+	if _, err := ProcessResponse(response, ctx); err == nil {
+		t.Error("默认应把没有JSON的响应视为错误")
+	}
+
+	ctx.NoJSONAsWait = true
+	fd, err := ProcessResponse(response, ctx)
+	if err != nil {
+		t.Fatalf("NoJSONAsWait 时应按观望处理: %v", err)
+	}
+	if len(fd.Decisions) != 1 || fd.Decisions[0].Action != "wait" || fd.Decisions[0].Reasoning != response {
+		t.Errorf("应生成一个以思维链为理由的观望决策: %+v", fd.Decisions)
+	}
+}
+
+func TestValidateAnalyzedSymbol(t *testing.T) {
+	ctx := testContext()
+	// 候选币种被流动性过滤，没有市场数据
+	ctx.CandidateCoins = append(ctx.CandidateCoins, CandidateCoin{Symbol: "DOGEUSDT", Sources: []string{"ai500"}})
+
+	unanalyzed := &Decision{Symbol: "DOGEUSDT", Action: "open_long"}
+	if err := validateAnalyzedSymbol(unanalyzed, ctx); err == nil || !strings.Contains(err.Error(), "无市场数据") {
+		t.Errorf("对未分析币种开仓应被拒绝: %v", err)
+	}
+	if err := validateDecisions(testOpens(), ctx); err != nil {
+		t.Errorf("对已分析币种开仓应通过: %v", err)
+	}
+	if err := validateAnalyzedSymbol(&Decision{Symbol: "DOGEUSDT", Action: "wait"}, ctx); err != nil {
+		t.Errorf("非开仓决策不受限制: %v", err)
+	}
+}
+
+func TestValidateHoldReasoning(t *testing.T) {
+	ctx := testContext()
+	ctx.MinHoldReasoningLen = 10
+
+	empty := []Decision{{Symbol: "BTCUSDT", Action: "hold"}}
+	if err := validateDecisions(empty, ctx); err == nil {
+		t.Error("严格模式下空理由的hold应被拒绝")
+	}
+	substantive := []Decision{{Symbol: "BTCUSDT", Action: "hold", Reasoning: "价格仍在4小时EMA20上方，趋势未破坏，继续持有"}}
+	if err := validateDecisions(substantive, ctx); err != nil {
+		t.Errorf("有实质内容的hold应通过: %v", err)
+	}
+
+	ctx.MinHoldReasoningLen = 0
+	if err := validateDecisions(empty, ctx); err != nil {
+		t.Errorf("未启用时不检查hold理由: %v", err)
+	}
+}
+
+// limitLong 入场100、止损95（风险5%）的限价做多，止盈价按目标风险回报比计算
+func limitLong(rr float64) *Decision {
+	return &Decision{Symbol: "SOLUSDT", Action: "open_long", OrderType: OrderTypeLimit, LimitPrice: 100, StopLoss: 95, TakeProfit: 100 + 5*rr}
+}
+
+func TestValidateOpenRiskRewardTolerance(t *testing.T) {
+	ctx := &Context{}
+	if err := validateOpenRiskReward(limitLong(minRiskRewardRatio-0.001), ctx); err != nil {
+		t.Errorf("略低于硬约束（容差内）应通过: %v", err)
+	}
+	if err := validateOpenRiskReward(limitLong(minRiskRewardRatio-0.1), ctx); err == nil {
+		t.Error("明显低于硬约束应被拒绝")
+	}
+
+	ctx.Risk.RRTolerance = -1 // 不允许容差
+	if err := validateOpenRiskReward(limitLong(minRiskRewardRatio-0.001), ctx); err == nil {
+		t.Error("禁用容差时应严格拒绝")
+	}
+	ctx.Risk.RRTolerance = 0.2
+	if err := validateOpenRiskReward(limitLong(minRiskRewardRatio-0.1), ctx); err != nil {
+		t.Errorf("自定义容差0.2内应通过: %v", err)
+	}
+}
+
+func TestSystemPromptExampleLadders(t *testing.T) {
+	ctx := testContext()
+	// 当前价与示例的价格结构一致
+	ctx.MarketDataMap["BTCUSDT"] = testMarketData("BTCUSDT", 95800)
+	ctx.MarketDataMap["SOLUSDT"] = testMarketData("SOLUSDT", 186)
+	prompt := buildSystemPrompt(ctx, "")
+	for _, ladder := range []string{`"take_profit_levels": [94000, 92500, 91000]`, `"take_profit_levels": [195, 202, 210]`} {
+		if !strings.Contains(prompt, ladder) {
+			t.Errorf("系统提示词缺少示例止盈阶梯 %s", ladder)
+		}
+	}
+
+	decisions, err := extractDecisions(prompt[strings.Index(prompt, "```json"):])
+	if err != nil {
+		t.Fatalf("示例JSON应能解析: %v", err)
+	}
+	sides := make(map[string]bool)
+	for i := range decisions {
+		d := &decisions[i]
+		if !isOpenAction(d.Action) {
+			continue
+		}
+		sides[positionSide(d.Action)] = true
+		if err := validateDecision(d, ctx); err != nil {
+			t.Errorf("示例 %s %s 应通过验证: %v", d.Symbol, d.Action, err)
+		}
+	}
+	if !sides["long"] || !sides["short"] {
+		t.Errorf("示例应同时包含做多和做空: %v", sides)
+	}
+}
+
+func TestDefaultLeverage(t *testing.T) {
+	omitted := func() []Decision {
+		ds := testOpens()[:1]
+		ds[0].Leverage = 0
+		return ds
+	}
+
+	// 默认模式：未给出杠杆按无效杠杆拒绝
+	ctx := testContext()
+	decisions := omitted()
+	normalizeDecisions(decisions, ctx)
+	if err := validateDecisions(decisions, ctx); err == nil {
+		t.Error("未配置默认杠杆时，缺少杠杆的开仓应被拒绝")
+	}
+
+	// 补全模式：使用默认杠杆，且不超过币种上限
+	for _, tt := range []struct{ defaultLeverage, want int }{{3, 3}, {10, 5}} {
+		ctx.Risk.DefaultLeverage = tt.defaultLeverage
+		decisions = omitted()
+		normalizeDecisions(decisions, ctx)
+		if decisions[0].Leverage != tt.want {
+			t.Errorf("默认杠杆%dx: 补全为%dx, want %dx", tt.defaultLeverage, decisions[0].Leverage, tt.want)
+		}
+		if err := validateDecisions(decisions, ctx); err != nil {
+			t.Errorf("默认杠杆%dx: 补全后应通过验证: %v", tt.defaultLeverage, err)
+		}
+	}
+}
+
+func TestActivePositionsFiltersZeroQuantity(t *testing.T) {
+	positions := []PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long", Quantity: 0.01},
+		{Symbol: "ETHUSDT", Side: "long", Quantity: 0},
+		{Symbol: "SOLUSDT", Side: "short", Quantity: -1},
+	}
+	active := activePositions(positions)
+	if len(active) != 1 || active[0].Symbol != "BTCUSDT" {
+		t.Errorf("应只保留数量为正的持仓: %+v", active)
+	}
+
+	ctx := testContext()
+	ctx.Positions = append(ctx.Positions, PositionInfo{Symbol: "XRPUSDT", Side: "long", Quantity: 0, EntryPrice: 0.5, MarkPrice: 0.5})
+	prompt := buildUserPrompt(ctx)
+	if !strings.Contains(prompt, "## 当前持仓 (1个)") || strings.Contains(prompt, "XRPUSDT") {
+		t.Errorf("数量为0的持仓不应渲染:\n%s", prompt)
+	}
+}
+
+func TestValidateDecisionCollectAllErrors(t *testing.T) {
+	// 风险回报比0.5且止损距离20%×5x杠杆，两项同时不满足
+	bad := func() *Decision {
+		return &Decision{Symbol: "ETHUSDT", Action: "open_long", Leverage: 5, PositionSizeUSD: 300,
+			OrderType: OrderTypeLimit, LimitPrice: 2990, StopLoss: 2392, TakeProfit: 3289, Reasoning: "测试"}
+	}
+
+	ctx := testContext()
+	err := validateDecision(bad(), ctx)
+	if err == nil || strings.Contains(err.Error(), "\n") {
+		t.Fatalf("默认遇到第一个错误即返回: %v", err)
+	}
+
+	ctx.CollectAllErrors = true
+	err = validateDecision(bad(), ctx)
+	if err == nil {
+		t.Fatal("应返回错误")
+	}
+	for _, want := range []string{"风险回报比过低", "保证金亏损"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("汇总错误缺少 %q: %v", want, err)
+		}
+	}
+}
+
+func TestUserPromptCandidateCount(t *testing.T) {
+	ctx := testContext()
+	// 没有市场数据的候选币种不渲染，也不计入数量
+	ctx.CandidateCoins = append(ctx.CandidateCoins, CandidateCoin{Symbol: "XRPUSDT", Sources: []string{"ai500"}})
+
+	prompt := buildUserPrompt(ctx)
+	if !strings.Contains(prompt, "## 当前持仓 (1个)") {
+		t.Errorf("持仓数量应单独显示:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "## 候选币种 (2个)") {
+		t.Errorf("候选数量不应包含持仓币种和无数据的币种:\n%s", prompt)
+	}
+
+	_, candidates, _ := strings.Cut(prompt, "## 候选币种")
+	if blocks := strings.Count(candidates, "\n### "); blocks != 2 {
+		t.Errorf("渲染的候选币种块数 = %d, 期望 2", blocks)
+	}
+	if strings.Contains(candidates, "XRPUSDT") {
+		t.Error("无市场数据的候选币种不应渲染")
+	}
+}
+
+func TestValidateConflictsByExchange(t *testing.T) {
+	ctx := testContext()
+	ctx.PrimaryExchange = "binance"
+
+	ds := testOpens()
+	short := ds[1]
+	short.Symbol = "ETHUSDT"
+	short.StopLoss, short.TakeProfit = 3060, 2700
+	short.Exchange = "hyperliquid"
+	decisions := []Decision{ds[0], short}
+
+	normalizeDecisions(decisions, ctx)
+	if decisions[0].Exchange != "binance" {
+		t.Errorf("未指定交易所时应补全为主交易所, got %q", decisions[0].Exchange)
+	}
+	if err := validateConflicts(decisions, ctx); err != nil {
+		t.Errorf("不同交易所的同一币种不应冲突: %v", err)
+	}
+
+	decisions[1].Exchange = ""
+	if err := validateConflicts(decisions, ctx); err == nil {
+		t.Error("同一交易所对同一币种重复开仓应冲突")
+	}
+}
+
+// promptHashes 各提示词版本对应的系统提示词哈希（testContext、内置模板）
+// 修改 buildSystemPrompt 后此测试失败时：实质变化需递增 PromptVersion，再在此登记新版本的哈希
+var promptHashes = map[string]string{
+	"v2": "d2cf6dba93cf",
+	"v3": "7b5dda77b001",
+}
+
+func TestPromptVersionMatchesHash(t *testing.T) {
+	got := PromptHash(buildSystemPrompt(testContext(), ""))
+	if want, ok := promptHashes[PromptVersion]; !ok || got != want {
+		t.Errorf("系统提示词哈希 = %s，与版本 %s 登记的 %q 不一致，请递增 PromptVersion 并登记哈希", got, PromptVersion, want)
+	}
+}
+
+func TestGetFullDecisionStampsPromptVersion(t *testing.T) {
+	ctx := stubContext()
+	fd, err := GetFullDecision(ctx, stubAIClient(t, aiResponse(t, testOpens()[:1])))
+	if err != nil {
+		t.Fatalf("GetFullDecision: %v", err)
+	}
+	if fd.PromptVersion != PromptVersion {
+		t.Errorf("PromptVersion = %q, want %q", fd.PromptVersion, PromptVersion)
+	}
+	if fd.PromptHash != PromptHash(fd.SystemPrompt) {
+		t.Errorf("PromptHash = %q，与实际发送的系统提示词不一致", fd.PromptHash)
+	}
+}
+
+func TestDedupPositionCandidateDecisions(t *testing.T) {
+	openLong := Decision{Symbol: "BTCUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 300, StopLoss: 99000, TakeProfit: 105000}
+	openShort := Decision{Symbol: "BTCUSDT", Action: "open_short", Leverage: 3, PositionSizeUSD: 300, StopLoss: 103000, TakeProfit: 97000}
+	hold := Decision{Symbol: "BTCUSDT", Action: "hold", Reasoning: "趋势未变"}
+	closeLong := Decision{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈"}
+
+	tests := []struct {
+		name      string
+		decisions []Decision
+		wantKept  []string
+		wantWarn  bool
+	}{
+		{"hold同时开仓", []Decision{hold, openLong}, []string{"hold"}, true},
+		{"平仓后同方向开仓", []Decision{closeLong, openLong}, []string{"close_long"}, true},
+		{"平仓后反手", []Decision{closeLong, openShort}, []string{"close_long", "open_short"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			ctx.CandidateCoins = append(ctx.CandidateCoins, CandidateCoin{Symbol: "BTCUSDT", Sources: []string{"ai500"}})
+
+			kept, warnings := dedupPositionCandidateDecisions(tt.decisions, ctx)
+			var actions []string
+			for _, d := range kept {
+				actions = append(actions, d.Action)
+			}
+			if strings.Join(actions, ",") != strings.Join(tt.wantKept, ",") {
+				t.Errorf("保留的决策 = %v, want %v", actions, tt.wantKept)
+			}
+			if (len(warnings) > 0) != tt.wantWarn {
+				t.Errorf("warnings = %v, wantWarn %v", warnings, tt.wantWarn)
+			}
+		})
+	}
+
+	// 持仓币种不在候选中时不处理
+	kept, warnings := dedupPositionCandidateDecisions([]Decision{hold, openLong}, testContext())
+	if len(kept) != 2 || len(warnings) != 0 {
+		t.Errorf("非候选的持仓币种不应去重: kept=%d warnings=%v", len(kept), warnings)
+	}
+}
+
+func TestProcessResponseRepairsAll(t *testing.T) {
+	// 同时需要：中文引号替换、reasoning补引号、去掉尾随逗号、动作别名和大小写标准化
+	const response = "ETH突破前高，做多。\n\n" +
+		"[\n" +
+		"  {\"symbol\": “ETHUSDT”, \"action\": \"long\", \"leverage\": 3, \"position_size_usd\": 300, " +
+		"\"stop_loss\": 2940, \"take_profit\": 3300, \"confidence\": 80, \"reasoning\": 突破前高,},\n" +
+		"  {\"symbol\": \"BTCUSDT\", \"action\": \"HOLD\", \"reasoning\": \"趋势未变\"},\n" +
+		"]"
+
+	fd, err := ProcessResponse(response, testContext())
+	if err != nil {
+		t.Fatalf("ProcessResponse: %v", err)
+	}
+	if len(fd.Decisions) != 2 {
+		t.Fatalf("应解析出2个决策: %+v", fd.Decisions)
+	}
+	if d := fd.Decisions[0]; d.Symbol != "ETHUSDT" || d.Action != "open_long" || d.Reasoning != "突破前高" {
+		t.Errorf("第一个决策 = %+v", d)
+	}
+	if d := fd.Decisions[1]; d.Action != "hold" {
+		t.Errorf("动作大小写应标准化: %q", d.Action)
+	}
+	if fd.CoTTrace == "" {
+		t.Error("应提取思维链")
+	}
+}
+
+func TestSlippageBps(t *testing.T) {
+	for _, tt := range []struct {
+		bps     int
+		wantErr bool
+	}{
+		{30, false},
+		{500, false},
+		{501, true},
+		{-1, true},
+	} {
+		d := &testOpens()[0]
+		d.SlippageBps = tt.bps
+		if err := validateDecision(d, testContext()); (err != nil) != tt.wantErr {
+			t.Errorf("滑点%d基点: error = %v, wantErr %v", tt.bps, err, tt.wantErr)
+		}
+	}
+
+	ctx := testContext()
+	ctx.Risk.DefaultSlippageBps = 20
+	decisions := []Decision{testOpens()[0], testOpens()[1], {Symbol: "BTCUSDT", Action: "hold"}}
+	decisions[1].SlippageBps = 50
+	normalizeDecisions(decisions, ctx)
+	for i, want := range []int{20, 50, 0} {
+		if decisions[i].SlippageBps != want {
+			t.Errorf("决策 #%d 滑点 = %d, want %d", i+1, decisions[i].SlippageBps, want)
+		}
+	}
+}
+
+func TestAllowedLeverages(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.AllowedLeverages = []int{1, 2, 3, 5, 10}
+
+	d := testOpens()[0]
+	d.Leverage = 4
+	if err := validateDecision(&d, ctx); err == nil || !strings.Contains(err.Error(), "允许的档位") {
+		t.Errorf("4x不在允许档位中应拒绝: %v", err)
+	}
+
+	ctx.Risk.SnapLeverage = true
+	decisions := []Decision{d}
+	normalizeDecisions(decisions, ctx)
+	if decisions[0].Leverage != 3 {
+		t.Errorf("4x应调整到最近的较低档位3x, got %dx", decisions[0].Leverage)
+	}
+	if err := validateDecision(&decisions[0], ctx); err != nil {
+		t.Errorf("调整后应通过验证: %v", err)
+	}
+
+	for leverage, want := range map[int]int{8: 10, 6: 5, 20: 10} {
+		if got := snapLeverage(leverage, ctx.Risk.AllowedLeverages); got != want {
+			t.Errorf("snapLeverage(%d) = %d, want %d", leverage, got, want)
+		}
+	}
+}
+
+func TestReusedContextFetchesFreshData(t *testing.T) {
+	ctx := stubContext()
+	provider := ctx.MarketData.(stubMarketData)
+	client := stubAIClient(t, aiResponse(t, []Decision{{Symbol: "BTCUSDT", Action: "hold", Reasoning: "趋势未变"}}))
+
+	first, err := GetFullDecision(ctx, client)
+	if err != nil {
+		t.Fatalf("第一个周期: %v", err)
+	}
+	if !strings.Contains(first.UserPrompt, "SOLUSDT") || !strings.Contains(first.UserPrompt, "current_price = 3000.00") {
+		t.Fatalf("第一个周期应包含SOL和ETH@3000:\n%s", first.UserPrompt)
+	}
+
+	// 下一个周期复用同一个Context：SOL移出候选池，ETH价格变化
+	ctx.CandidateCoins = []CandidateCoin{{Symbol: "ETHUSDT", Sources: []string{"ai500"}}}
+	provider["ETHUSDT"] = testMarketData("ETHUSDT", 3500)
+	second, err := GetFullDecision(ctx, client)
+	if err != nil {
+		t.Fatalf("第二个周期: %v", err)
+	}
+	if strings.Contains(second.UserPrompt, "SOLUSDT") {
+		t.Error("上一周期的候选币种数据不应进入本周期prompt")
+	}
+	if strings.Contains(second.UserPrompt, "current_price = 3000.00") || !strings.Contains(second.UserPrompt, "current_price = 3500.00") {
+		t.Error("复用的Context应重新获取市场数据")
+	}
+	if _, ok := ctx.MarketDataMap["SOLUSDT"]; ok {
+		t.Error("上一周期的市场数据应被丢弃")
+	}
+}
+
+func TestValidateOpenRiskRewardFees(t *testing.T) {
+	// 风险5%、收益15.5%：不计手续费时风险回报比3.1
+	ctx := &Context{}
+	if err := validateOpenRiskReward(limitLong(3.1), ctx); err != nil {
+		t.Fatalf("不计手续费应通过: %v", err)
+	}
+
+	// 吃单0.1%：风险5%+0.2%、收益15.5%-0.2%，风险回报比降到约2.94
+	ctx.Risk.TakerFeePct = 0.1
+	if err := validateOpenRiskReward(limitLong(3.1), ctx); err == nil {
+		t.Error("计入往返手续费后应被拒绝")
+	}
+	if err := validateOpenRiskReward(limitLong(3.5), ctx); err != nil {
+		t.Errorf("扣除手续费后仍满足要求的应通过: %v", err)
+	}
+}
+
+func TestProcessResponseUnknownFields(t *testing.T) {
+	const response = "ETH突破。\n\n" +
+		`[{"symbol": "ETHUSDT", "action": "open_long", "leverage": 3, "position_size_usd": 300, "stop_loss": 2940, ` +
+		`"take_profit": 3300, "take_profits": [3150, 3300], "stop_price": 2940, "confidence": 80, "reasoning": "突破"}]`
+
+	hasWarning := func(fd *FullDecision) bool {
+		for _, w := range fd.Warnings {
+			if strings.Contains(w, "未知字段") && strings.Contains(w, "stop_price, take_profits") {
+				return true
+			}
+		}
+		return false
+	}
+
+	ctx := testContext()
+	fd, err := ProcessResponse(response, ctx)
+	if err != nil {
+		t.Fatalf("ProcessResponse: %v", err)
+	}
+	if hasWarning(fd) {
+		t.Error("未启用时不应警告未知字段")
+	}
+
+	ctx.WarnUnknownFields = true
+	fd, err = ProcessResponse(response, ctx)
+	if err != nil {
+		t.Fatalf("未知字段只警告，不应导致失败: %v", err)
+	}
+	if !hasWarning(fd) {
+		t.Errorf("应列出未知字段: %v", fd.Warnings)
+	}
+}
+
+func TestAddToUnderfilledPosition(t *testing.T) {
+	ctx := testContext()
+	ctx.Positions[0].IntendedQuantity = 0.02 // 计划0.02，只成交0.01，未成交部分约1010 USDT
+
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "部分成交: 已成交50%") {
+		t.Errorf("部分成交的持仓应标注:\n%s", prompt)
+	}
+
+	add := func(size float64) *Decision {
+		return &Decision{Symbol: "BTCUSDT", Action: "add_long", PositionSizeUSD: size, StopLoss: 99000, TakeProfit: 105000, Reasoning: "补足"}
+	}
+	if err := validateDecision(add(500), ctx); err != nil {
+		t.Errorf("未成交部分内补仓应通过: %v", err)
+	}
+	noStop := add(500)
+	noStop.StopLoss = 0
+	if err := validateDecision(noStop, ctx); err == nil || !strings.Contains(err.Error(), "stop_loss 和 take_profit") {
+		t.Errorf("补仓缺少止损应拒绝（补仓后需按总数量重新挂单）: %v", err)
+	}
+	wrongSide := add(500)
+	wrongSide.StopLoss = 102000 // 高于标记价101000
+	if err := validateDecision(wrongSide, ctx); err == nil {
+		t.Error("补多仓止损高于当前价格应拒绝")
+	}
+	if err := validateDecision(add(2000), ctx); err == nil {
+		t.Error("补仓超过未成交部分应拒绝")
+	}
+	if err := validateDecision(&Decision{Symbol: "BTCUSDT", Action: "add_short", PositionSizeUSD: 500, Reasoning: "补足"}, ctx); err == nil {
+		t.Error("没有同方向持仓时不能补仓")
+	}
+
+	ctx.Positions[0].IntendedQuantity = 0.01
+	if err := validateDecision(add(500), ctx); err == nil {
+		t.Error("已完全成交的持仓不允许补仓")
+	}
+	if prompt := buildUserPrompt(ctx); strings.Contains(prompt, "部分成交") {
+		t.Error("完全成交的持仓不应标注部分成交")
+	}
+}
+
+func TestValidateOpenStopLeverage(t *testing.T) {
+	// ETH当前价3000
+	open := func(leverage int, stopPct float64) *Decision {
+		return &Decision{Symbol: "ETHUSDT", Action: "open_long", Leverage: leverage, StopLoss: 3000 * (1 - stopPct/100)}
+	}
+
+	ctx := testContext()
+	if err := validateOpenStopLeverage(open(10, 8), ctx); err == nil || !strings.Contains(err.Error(), "保证金亏损80%") {
+		t.Errorf("10x+8%%止损应拒绝: %v", err)
+	}
+	if err := validateOpenStopLeverage(open(3, 5), ctx); err != nil {
+		t.Errorf("3x+5%%止损应通过: %v", err)
+	}
+
+	ctx.Risk.MaxStopMarginLossPct = 10
+	if err := validateOpenStopLeverage(open(3, 5), ctx); err == nil {
+		t.Error("自定义上限10%时3x+5%止损应拒绝")
+	}
+	ctx.Risk.MaxStopMarginLossPct = -1
+	if err := validateOpenStopLeverage(open(10, 8), ctx); err != nil {
+		t.Errorf("负数表示不检查: %v", err)
+	}
+}
+
+func TestAutoCorrectRiskReward(t *testing.T) {
+	ctx := &Context{Risk: RiskConfig{RRAutoCorrectMax: 0.2}}
+
+	// 风险回报比2.9：第一止盈114.5放宽到115（刚好3:1）
+	decisions := []Decision{*limitLong(2.9)}
+	decisions[0].TakeProfitLevels = []float64{114.5, 118, 122}
+	notes := autoCorrectRiskReward(decisions, ctx)
+	if len(notes) != 1 {
+		t.Fatalf("应修正一个决策: %v", notes)
+	}
+	d := decisions[0]
+	if math.Abs(d.TakeProfit-115) > 1e-6 || d.TakeProfitLevels[0] != d.TakeProfit || d.TakeProfitLevels[1] != 118 {
+		t.Errorf("修正后止盈 = %v %v", d.TakeProfit, d.TakeProfitLevels)
+	}
+	if err := validateOpenRiskReward(&d, ctx); err != nil {
+		t.Errorf("修正后应通过风险回报比检查: %v", err)
+	}
+
+	// 第二目标114.8：放宽到115会破坏分批顺序，放弃修正，由验证阶段拒绝
+	decisions = []Decision{*limitLong(2.9)}
+	decisions[0].TakeProfitLevels = []float64{114.5, 114.8, 122}
+	if notes := autoCorrectRiskReward(decisions, ctx); len(notes) != 0 || decisions[0].TakeProfit != 114.5 {
+		t.Errorf("破坏顺序时不应修正: %v %v", notes, decisions[0].TakeProfit)
+	}
+	if err := validateOpenRiskReward(&decisions[0], ctx); err == nil {
+		t.Error("未修正的决策应被拒绝")
+	}
+
+	// 差距超过配置上限时不修正
+	decisions = []Decision{*limitLong(2.5)}
+	if notes := autoCorrectRiskReward(decisions, ctx); len(notes) != 0 {
+		t.Errorf("差距过大时不应修正: %v", notes)
+	}
+}
+
+func TestAutoCorrectRiskRewardKeepsLadderOrder(t *testing.T) {
+	ctx := &Context{Risk: RiskConfig{RRAutoCorrectMax: 0.2}}
+	// 限价开空100、止损105（风险5），take_profit 为最后一级目标
+	short := func(levels ...float64) Decision {
+		return Decision{Symbol: "SOLUSDT", Action: "open_short", OrderType: OrderTypeLimit, LimitPrice: 100, StopLoss: 105,
+			TakeProfit: levels[len(levels)-1], TakeProfitLevels: levels}
+	}
+	strictlyDescending := func(levels []float64) bool {
+		for i := 1; i < len(levels); i++ {
+			if levels[i] >= levels[i-1] {
+				return false
+			}
+		}
+		return true
+	}
+
+	// 第一级目标85.5（2.9:1）放宽到85（3:1），最后一级目标不变
+	decisions := []Decision{short(85.5, 80, 75)}
+	if notes := autoCorrectRiskReward(decisions, ctx); len(notes) != 1 {
+		t.Fatalf("应按第一级目标修正: %v", notes)
+	}
+	d := decisions[0]
+	if math.Abs(d.TakeProfitLevels[0]-85) > 1e-6 || d.TakeProfit != 75 || !strictlyDescending(d.TakeProfitLevels) {
+		t.Errorf("修正后止盈 = %v %v", d.TakeProfit, d.TakeProfitLevels)
+	}
+
+	// 最后一级目标85.5（2.9:1）但第一级只有2:1：差距超出上限，不修正，阶梯保持原样
+	decisions = []Decision{short(90, 87, 85.5)}
+	if notes := autoCorrectRiskReward(decisions, ctx); len(notes) != 0 {
+		t.Errorf("第一级目标差距过大时不应修正: %v", notes)
+	}
+	if d := decisions[0]; d.TakeProfit != 85.5 || !strictlyDescending(d.TakeProfitLevels) || d.TakeProfitLevels[0] != 90 {
+		t.Errorf("阶梯不应被修改: %v %v", d.TakeProfit, d.TakeProfitLevels)
+	}
+}
+
+func TestRetryOnRejection(t *testing.T) {
+	rejected := func(leverage int) string {
+		ds := testOpens()[:1]
+		ds[0].Leverage = leverage // 超过山寨币杠杆上限5x
+		return aiResponse(t, ds)
+	}
+	valid := aiResponse(t, testOpens()[:1])
+
+	t.Run("重试后通过", func(t *testing.T) {
+		ctx := stubContext()
+		ctx.RetryOnRejection = true
+		fd, err := GetFullDecision(ctx, stubAIClient(t, rejected(20), valid))
+		if err != nil {
+			t.Fatalf("重试后应通过: %v", err)
+		}
+		if !strings.Contains(fd.UserPrompt, "## ⛔ 上一次决策被拒绝") || fd.RawResponse != valid {
+			t.Error("应记录重试时的prompt和响应")
+		}
+		found := false
+		for _, w := range fd.Warnings {
+			found = found || strings.Contains(w, "首次决策被拒绝")
+		}
+		if !found {
+			t.Errorf("应提示首次决策被拒绝: %v", fd.Warnings)
+		}
+	})
+
+	t.Run("重试仍失败", func(t *testing.T) {
+		ctx := stubContext()
+		ctx.RetryOnRejection = true
+		fd, err := GetFullDecision(ctx, stubAIClient(t, rejected(20), rejected(30), valid))
+		if !errors.Is(err, ErrValidationFailed) || !strings.Contains(err.Error(), "上限5倍）: 20") {
+			t.Fatalf("应返回原始拒绝: %v", err)
+		}
+		if strings.Contains(fd.UserPrompt, "上一次决策被拒绝") {
+			t.Error("重试失败时应保留原始prompt")
+		}
+	})
+
+	t.Run("未启用", func(t *testing.T) {
+		if _, err := GetFullDecision(stubContext(), stubAIClient(t, rejected(20), valid)); !errors.Is(err, ErrValidationFailed) {
+			t.Errorf("未启用重试时应直接返回拒绝: %v", err)
+		}
+	})
+}
+
+func TestProcessResponseRiskAssessment(t *testing.T) {
+	decisions := `[{"symbol": "BTCUSDT", "action": "hold", "reasoning": "趋势未变"}]`
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{"JSON前的风险评估", "BTC趋势未变。\n\n【风险评估】\n总风险1.2%，无相关性集中。\n\n" + decisions, "总风险1.2%，无相关性集中。"},
+		{"下一个标记截止", "【风险评估】保证金充足\n【决策】\n" + decisions, "保证金充足"},
+		{"代码块截止", "【风险评估】波动加大\n```json\n" + decisions + "\n```", "波动加大"},
+		{"没有风险评估", "BTC趋势未变。\n\n" + decisions, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := ProcessResponse(tt.response, testContext())
+			if err != nil {
+				t.Fatalf("缺少风险评估不应影响解析: %v", err)
+			}
+			if fd.RiskAssessment != tt.want {
+				t.Errorf("RiskAssessment = %q, want %q", fd.RiskAssessment, tt.want)
+			}
+			if len(fd.Decisions) != 1 {
+				t.Errorf("应解析出决策: %+v", fd.Decisions)
+			}
+		})
+	}
+}
+
+// symbolBlock 返回prompt中以 header 开头、到下一个 "### " 或 "## " 标题之前的内容
+func symbolBlock(prompt, header string) string {
+	start := strings.Index(prompt, header)
+	if start < 0 {
+		return ""
+	}
+	block := prompt[start+len(header):]
+	for _, next := range []string{"\n### ", "\n## "} {
+		if end := strings.Index(block, next); end >= 0 {
+			block = block[:end]
+		}
+	}
+	return block
+}
+
+func TestUserPromptSymbolNotes(t *testing.T) {
+	ctx := testContext()
+	base := buildUserPrompt(ctx)
+	ctx.SymbolNotes = map[string]string{"XRPUSDT": "不在本周期的币种"}
+	if got := buildUserPrompt(ctx); got != base {
+		t.Error("没有对应币种的备注不应改变prompt")
+	}
+
+	ctx.SymbolNotes = map[string]string{
+		"SOLUSDT": "下周解锁，避免做多",
+		"BTCUSDT": "长期持有",
+	}
+	prompt := buildUserPrompt(ctx)
+	if block := symbolBlock(prompt, "### 2. SOLUSDT"); !strings.Contains(block, "📝 备注: 下周解锁，避免做多") {
+		t.Errorf("SOL的备注应渲染在SOL的候选信息中:\n%s", block)
+	}
+	if block := symbolBlock(prompt, "### 1. ETHUSDT"); strings.Contains(block, "📝") {
+		t.Errorf("ETH没有备注:\n%s", block)
+	}
+	if block := symbolBlock(prompt, "## 当前持仓"); !strings.Contains(block, "📝 备注: 长期持有") {
+		t.Errorf("BTC的备注应渲染在持仓信息中:\n%s", block)
+	}
+}
+
+func TestExtractDecisionsJSONFence(t *testing.T) {
+	const array = `[{"symbol": "BTCUSDT", "action": "hold", "reasoning": "趋势未变"}]`
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{"思维链中有方括号", "检查清单满足[2条]，OI排名[3]。\n\n```json\n" + array + "\n```"},
+		{"代码块后还有方括号", "满足[2条]\n```json\n" + array + "\n```\n以上决策已复核[完毕]"},
+		{"没有代码块时回退到括号扫描", "BTC趋势未变。\n\n" + array},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions, err := extractDecisions(tt.response)
+			if err != nil {
+				t.Fatalf("extractDecisions: %v", err)
+			}
+			if len(decisions) != 1 || decisions[0].Symbol != "BTCUSDT" || decisions[0].Action != "hold" {
+				t.Errorf("decisions = %+v", decisions)
+			}
+		})
+	}
+}
+
+func TestFindMatchingBracketIgnoresStrings(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+	}{
+		{"字符串中的右括号", `[{"reasoning": "突破区间[3800,3900]后回踩]"}]`},
+		{"字符串中的左括号", `[{"reasoning": "支撑[3800"}]`},
+		{"转义引号", `[{"reasoning": "他说\"[关键位]\"未破"}]`},
+		{"嵌套数组", `[{"take_profit_levels": [3150, 3225]}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findMatchingBracket(tt.s, 0); got != len(tt.s)-1 {
+				t.Errorf("findMatchingBracket() = %d, want %d", got, len(tt.s)-1)
+			}
+		})
+	}
+	if got := findMatchingBracket(`[{"reasoning": "]"}`, 0); got != -1 {
+		t.Errorf("未闭合的数组应返回-1, got %d", got)
+	}
+
+	decisions, err := extractDecisions(`BTC维持趋势。` + "\n\n" +
+		`[{"symbol": "BTCUSDT", "action": "hold", "reasoning": "价格在区间[100000,102000]内震荡]"}]`)
+	if err != nil {
+		t.Fatalf("extractDecisions: %v", err)
+	}
+	if len(decisions) != 1 || decisions[0].Reasoning != "价格在区间[100000,102000]内震荡]" {
+		t.Errorf("reasoning中的括号应原样保留: %+v", decisions)
+	}
+}
+
+func TestTradingDisabledDowngradesToAdvisory(t *testing.T) {
+	ctx := testContext()
+	disabled := false
+	ctx.TradingEnabled = &disabled
+
+	decisions := append(testOpens(), Decision{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "跌破EMA20"})
+	decisions[0].Leverage = 20 // 观察模式下不应因无效参数而拒绝
+	if err := validateDecisions(decisions, ctx); err != nil {
+		t.Fatalf("观察模式下不应返回验证错误: %v", err)
+	}
+	for _, d := range decisions {
+		if d.Action != "wait" {
+			t.Errorf("%s 应降级为wait, got %s", d.Symbol, d.Action)
+		}
+	}
+	if want := "[观察模式，建议动作: close_long] 跌破EMA20"; decisions[2].Reasoning != want {
+		t.Errorf("理由应保留原动作, got %q", decisions[2].Reasoning)
+	}
+
+	enabled := true
+	ctx.TradingEnabled = &enabled
+	decisions = testOpens()
+	if err := validateDecisions(decisions, ctx); err != nil {
+		t.Fatalf("validateDecisions: %v", err)
+	}
+	if decisions[0].Action != "open_long" || decisions[1].Action != "open_short" {
+		t.Errorf("开启交易时不应降级: %+v", decisions)
+	}
+}
+
+func TestFixMissingQuotes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"末尾字段", `{"action": "hold", "reasoning": 趋势未变}`, `{"action": "hold", "reasoning": "趋势未变"}`},
+		{"中间字段", `{"signal_type": 突破, "action": "wait"}`, `{"signal_type": "突破", "action": "wait"}`},
+		{"数组最后一个对象", `[{"oi_signal": OI增长 }]`, `[{"oi_signal": "OI增长"}]`},
+		{"多个字段", `{"oi_signal": 多头增仓,"oi_adjustment": 加仓}`, `{"oi_signal": "多头增仓","oi_adjustment": "加仓"}`},
+		{"值中含引号", `{"reasoning": 跌破"关键位"}`, `{"reasoning": "跌破\"关键位\""}`},
+		{"中文引号", "{\"reasoning\": “趋势未变”}", `{"reasoning": "趋势未变"}`},
+		{"已有引号不变", `{"reasoning": "区间, 震荡"}`, `{"reasoning": "区间, 震荡"}`},
+		{"null不变", `{"reasoning": null}`, `{"reasoning": null}`},
+		{"非字符串字段不变", `{"leverage": 3, "action": "open_long"}`, `{"leverage": 3, "action": "open_long"}`},
+		{"字符串值中的字段名不变", `{"action": "wait", "note": "reasoning: x"}`, `{"action": "wait", "note": "reasoning: x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fixMissingQuotes(tt.in); got != tt.want {
+				t.Errorf("fixMissingQuotes() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	decisions, err := extractDecisions("观望。\n\n" +
+		`[{"symbol": "BTCUSDT", "action": "hold", "signal_type": 趋势延续, "reasoning": 持仓盈利且趋势未变}]`)
+	if err != nil {
+		t.Fatalf("extractDecisions: %v", err)
+	}
+	if len(decisions) != 1 || decisions[0].SignalType != "趋势延续" || decisions[0].Reasoning != "持仓盈利且趋势未变" {
+		t.Errorf("decisions = %+v", decisions)
+	}
+}
+
+func TestValidateLimitOrder(t *testing.T) {
+	// ETH当前价3000
+	limit := func(action string, price, stop, tp float64) *Decision {
+		return &Decision{Symbol: "ETHUSDT", Action: action, Leverage: 3, PositionSizeUSD: 300,
+			OrderType: OrderTypeLimit, LimitPrice: price, StopLoss: stop, TakeProfit: tp, Reasoning: "回踩EMA20挂单"}
+	}
+	tests := []struct {
+		name    string
+		d       *Decision
+		wantErr string
+	}{
+		{"做多挂在现价下方", limit("open_long", 2950, 2900, 3125), ""},
+		{"做多挂在现价上方", limit("open_long", 3050, 3000, 3225), "做多限价单挂单价3050.0000必须低于当前价格3000.0000"},
+		{"做多止损高于挂单价", limit("open_long", 2950, 2960, 3125), "止损价必须在入场价下方（止损:2960.0000 入场:2950.0000）"},
+		{"做空挂在现价上方", limit("open_short", 3050, 3100, 2875), ""},
+		{"做空挂在现价下方", limit("open_short", 2950, 3000, 2775), "做空限价单挂单价2950.0000必须高于当前价格3000.0000"},
+		{"做空止损低于挂单价", limit("open_short", 3050, 3040, 2875), "止损价必须在入场价上方（止损:3040.0000 入场:3050.0000）"},
+		{"缺少挂单价", limit("open_long", 0, 2900, 3125), "limit_price"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDecision(tt.d, testContext())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("应通过: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("错误应包含 %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRemoveTrailingCommas(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"止盈档位末尾", `{"take_profit_levels": [3150, 3225,]}`, `{"take_profit_levels": [3150, 3225]}`},
+		{"对象末尾", `{"action": "hold",  }`, `{"action": "hold"  }`},
+		{"数组末尾的对象", "[{\"a\": 1},\n]", "[{\"a\": 1}\n]"},
+		{"字符串中的逗号不变", `{"reasoning": "区间,]震荡,}"}`, `{"reasoning": "区间,]震荡,}"}`},
+		{"转义引号后的逗号不变", `{"reasoning": "\",]"}`, `{"reasoning": "\",]"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeTrailingCommas(tt.in); got != tt.want {
+				t.Errorf("removeTrailingCommas() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	decisions, err := extractDecisions("两个决策。\n\n[\n" +
+		`{"symbol": "ETHUSDT", "action": "open_long", "take_profit_levels": [3150, 3225, 3300,], "reasoning": "突破,回踩"},` + "\n" +
+		`{"symbol": "BTCUSDT", "action": "hold", "reasoning": "趋势未变"},` + "\n]")
+	if err != nil {
+		t.Fatalf("extractDecisions: %v", err)
+	}
+	if len(decisions) != 2 || len(decisions[0].TakeProfitLevels) != 3 || decisions[1].Symbol != "BTCUSDT" {
+		t.Errorf("decisions = %+v", decisions)
+	}
+}
+
+func TestEnricherAdditionsInPrompt(t *testing.T) {
+	ctx := stubContext()
+	ctx.Enricher = func(c *Context) error {
+		eth := c.MarketDataMap["ETHUSDT"]
+		if eth == nil {
+			return errors.New("市场数据尚未获取")
+		}
+		c.ExtraSections = append(c.ExtraSections, "## 新闻情绪\nETH情绪评分: 0.72")
+		c.SymbolNotes = map[string]string{"ETHUSDT": fmt.Sprintf("自定义评分基于现价%.0f", eth.CurrentPrice)}
+		return nil
+	}
+
+	fd, err := GetFullDecision(ctx, stubAIClient(t, aiResponse(t, testOpens()[:1])))
+	if err != nil {
+		t.Fatalf("GetFullDecision: %v", err)
+	}
+	for _, want := range []string{"## 新闻情绪\nETH情绪评分: 0.72", "自定义评分基于现价3000"} {
+		if !strings.Contains(fd.UserPrompt, want) {
+			t.Errorf("User Prompt 应包含补充内容 %q:\n%s", want, fd.UserPrompt)
+		}
+	}
+
+	errEnrich := errors.New("情绪服务不可用")
+	ctx = stubContext()
+	ctx.Enricher = func(*Context) error { return errEnrich }
+	if _, err := GetFullDecision(ctx, stubAIClient(t, aiResponse(t, testOpens()[:1]))); !errors.Is(err, errEnrich) {
+		t.Errorf("补充失败应中止本周期: %v", err)
+	}
+}
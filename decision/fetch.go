@@ -0,0 +1,150 @@
+package decision
+
+import (
+	"context"
+	"nofx/market"
+	"sync"
+	"time"
+)
+
+// 市场数据获取的默认参数
+const (
+	defaultMaxConcurrentFetches  = 8                      // 并发获取的最大数量
+	defaultPositionFetchAttempts = 3                      // 持仓币种的最大获取次数
+	defaultPositionFetchBackoff  = 500 * time.Millisecond // 持仓币种重试的初始等待时间
+)
+
+// MarketDataProvider 获取单个币种的市场数据（未设置时使用 market.Get），可替换为缓存或测试桩
+type MarketDataProvider interface {
+	GetMarketData(symbol string) (*market.Data, error)
+}
+
+// defaultMarketDataProvider 直接调用 market.Get
+type defaultMarketDataProvider struct{}
+
+func (defaultMarketDataProvider) GetMarketData(symbol string) (*market.Data, error) {
+	return market.Get(symbol)
+}
+
+// marketDataProvider 返回上下文配置的市场数据来源（未设置时使用 market.Get）
+func (ctx *Context) marketDataProvider() MarketDataProvider {
+	if ctx.MarketData == nil {
+		return defaultMarketDataProvider{}
+	}
+	return ctx.MarketData
+}
+
+// maxConcurrentFetches 返回并发获取市场数据的最大数量（未配置时使用默认值）
+func (ctx *Context) maxConcurrentFetches() int {
+	if ctx.MaxConcurrentFetches <= 0 {
+		return defaultMaxConcurrentFetches
+	}
+	return ctx.MaxConcurrentFetches
+}
+
+// positionFetchAttempts 返回持仓币种的最大获取次数（未配置时使用默认值）
+func (ctx *Context) positionFetchAttempts() int {
+	if ctx.PositionFetchAttempts <= 0 {
+		return defaultPositionFetchAttempts
+	}
+	return ctx.PositionFetchAttempts
+}
+
+// positionFetchBackoff 返回持仓币种重试的初始等待时间（未配置时使用默认值）
+func (ctx *Context) positionFetchBackoff() time.Duration {
+	if ctx.PositionFetchBackoff <= 0 {
+		return defaultPositionFetchBackoff
+	}
+	return ctx.PositionFetchBackoff
+}
+
+// fetchWithRetry 获取市场数据，失败时按指数退避重试，最多 attempts 次（reqCtx 取消时停止重试）
+func fetchWithRetry(reqCtx context.Context, provider MarketDataProvider, symbol string, attempts int, backoff time.Duration) (*market.Data, error) {
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		data, err := provider.GetMarketData(symbol)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-reqCtx.Done():
+			return nil, reqCtx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return nil, lastErr
+}
+
+// fetchResult 单个币种的获取结果
+type fetchResult struct {
+	symbol string
+	data   *market.Data
+	err    error
+}
+
+// fetchSymbols 并发获取多个币种的市场数据，同时进行的请求不超过 maxConcurrentFetches 个；
+// 持仓币种（positionSymbols）失败时按 PositionFetchAttempts/PositionFetchBackoff 重试，候选币种只获取一次；
+// 每个币种完成后调用 handle（调用之间互斥，handle 内可直接写 Context），单个币种失败记录在结果中，不影响其他币种；
+// reqCtx 取消时不再发起新请求并立即返回 reqCtx.Err()，进行中的请求（GetMarketData 不支持取消）结束后丢弃结果，返回后不会再调用 handle
+func fetchSymbols(reqCtx context.Context, ctx *Context, symbols []string, positionSymbols map[string]bool, handle func(fetchResult)) error {
+	provider := ctx.marketDataProvider()
+	sem := make(chan struct{}, ctx.maxConcurrentFetches())
+	var mu sync.Mutex
+	abandoned := false // 已因取消返回，之后完成的请求丢弃结果
+	var wg sync.WaitGroup
+
+	abandon := func() error {
+		mu.Lock()
+		abandoned = true
+		mu.Unlock()
+		return reqCtx.Err()
+	}
+
+	for _, symbol := range symbols {
+		// select 在取消和空闲槽位同时就绪时随机选择，先检查取消，避免取消后继续发起请求
+		if reqCtx.Err() != nil {
+			return abandon()
+		}
+		select {
+		case <-reqCtx.Done():
+			return abandon()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if reqCtx.Err() != nil {
+				return
+			}
+			attempts := 1
+			if positionSymbols[symbol] {
+				attempts = ctx.positionFetchAttempts()
+			}
+			data, err := fetchWithRetry(reqCtx, provider, symbol, attempts, ctx.positionFetchBackoff())
+			mu.Lock()
+			defer mu.Unlock()
+			if abandoned || reqCtx.Err() != nil {
+				return
+			}
+			handle(fetchResult{symbol: symbol, data: data, err: err})
+		}(symbol)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return reqCtx.Err()
+	case <-reqCtx.Done():
+		return abandon()
+	}
+}
@@ -0,0 +1,132 @@
+package decision
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"nofx/market"
+)
+
+// inFlightMarketData 记录同时进行中的请求数峰值
+type inFlightMarketData struct {
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (s *inFlightMarketData) GetMarketData(symbol string) (*market.Data, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	s.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return testMarketData(symbol, 100), nil
+}
+
+func TestFetchSymbolsConcurrencyBound(t *testing.T) {
+	symbols := make([]string, 30)
+	for i := range symbols {
+		symbols[i] = fmt.Sprintf("COIN%dUSDT", i)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"自定义上限", 3, 3},
+		{"默认上限", 0, defaultMaxConcurrentFetches},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &inFlightMarketData{}
+			ctx := &Context{MarketData: provider, MaxConcurrentFetches: tt.limit}
+
+			fetched := 0
+			err := fetchSymbols(context.Background(), ctx, symbols, nil, func(r fetchResult) {
+				if r.err == nil {
+					fetched++
+				}
+			})
+			if err != nil {
+				t.Fatalf("fetchSymbols: %v", err)
+			}
+			if fetched != len(symbols) {
+				t.Errorf("应获取全部%d个币种, got %d", len(symbols), fetched)
+			}
+			if provider.peak > tt.want {
+				t.Errorf("同时进行的请求峰值 = %d, 不应超过 %d", provider.peak, tt.want)
+			}
+			if provider.peak < 2 {
+				t.Errorf("请求应并发进行, 峰值 = %d", provider.peak)
+			}
+		})
+	}
+}
+
+// blockingMarketData 请求阻塞到 release 关闭（模拟不支持取消的慢请求），记录发起的请求数
+type blockingMarketData struct {
+	release chan struct{}
+	mu      sync.Mutex
+	calls   int
+}
+
+func (s *blockingMarketData) GetMarketData(symbol string) (*market.Data, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	<-s.release
+	return testMarketData(symbol, 100), nil
+}
+
+func TestFetchSymbolsReturnsPromptlyOnCancel(t *testing.T) {
+	provider := &blockingMarketData{release: make(chan struct{})}
+	ctx := &Context{MarketData: provider, MaxConcurrentFetches: 2}
+	symbols := []string{"AUSDT", "BUSDT", "CUSDT", "DUSDT", "EUSDT"}
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	handled := 0
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fetchSymbols(reqCtx, ctx, symbols, nil, func(fetchResult) {
+			mu.Lock()
+			handled++
+			mu.Unlock()
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond) // 等前两个请求发出并阻塞
+	cancel()
+	select {
+	case err := <-errCh:
+		if err != context.Canceled {
+			t.Errorf("取消后应返回 context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("取消后应立即返回，不等待进行中的请求")
+	}
+
+	// 放行阻塞的请求：结果应被丢弃，也不应再发起新请求
+	close(provider.release)
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 0 {
+		t.Errorf("返回后不应再处理结果, handled = %d", handled)
+	}
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.calls != 2 {
+		t.Errorf("取消后不应发起新请求, calls = %d", provider.calls)
+	}
+}
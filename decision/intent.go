@@ -0,0 +1,146 @@
+package decision
+
+// 订单意图的订单类型
+const (
+	OrderTypeMarket     = "market"      // 市价单
+	OrderTypeLimit      = "limit"       // 限价单
+	OrderTypeStopMarket = "stop_market" // 触发后市价成交的止损单
+)
+
+// 订单意图的用途
+const (
+	OrderPurposeEntry        = "entry"         // 开仓/加仓
+	OrderPurposeStopLoss     = "stop_loss"     // 止损
+	OrderPurposeTakeProfit   = "take_profit"   // 分批止盈
+	OrderPurposeTrailingStop = "trailing_stop" // 移动止损（由执行端按档位跟踪）
+	OrderPurposeClose        = "close"         // 平仓
+)
+
+// defaultLadderSplit 三级分批止盈的仓位分配（%），与提示词中的30%/30%/40%一致
+var defaultLadderSplit = []float64{30, 30, 40}
+
+// OrderIntent 可直接交给交易所客户端执行的标准化订单意图
+type OrderIntent struct {
+	Purpose     string      `json:"purpose"`                // 用途（entry/stop_loss/take_profit/trailing_stop/close）
+	Type        string      `json:"type"`                   // 订单类型（market/limit/stop_market）
+	Symbol      string      `json:"symbol"`                 // 币种
+	Exchange    string      `json:"exchange,omitempty"`     // 交易所（空表示主交易所）
+	Side        string      `json:"side"`                   // 买卖方向（BUY/SELL）
+	Quantity    float64     `json:"quantity"`               // 数量（币本位，0表示整个持仓）
+	Price       float64     `json:"price,omitempty"`        // 限价单价格或止损单触发价
+	ReduceOnly  bool        `json:"reduce_only"`            // 只减仓
+	Leverage    int         `json:"leverage,omitempty"`     // 杠杆（仅开仓单）
+	SlippageBps int         `json:"slippage_bps,omitempty"` // 市价单最大可接受滑点（基点）
+	TrailBands  []TrailBand `json:"trail_bands,omitempty"`  // 移动止损档位（仅 trailing_stop）
+}
+
+// ToOrderIntents 将决策展开为具体订单：开仓/加仓展开为入场单（市价单，限价开仓为挂单价的限价单）、止损单、按30/30/40分配的分批止盈限价单和移动止损配置，
+// 平仓展开为只减仓的市价单；entry 为预估入场价（用于把仓位价值换算为数量），无需下单的决策或数据无效时返回nil
+func (d *Decision) ToOrderIntents(entry float64) []OrderIntent {
+	switch d.Action {
+	case "close_long", "close_short":
+		return []OrderIntent{{
+			Purpose:     OrderPurposeClose,
+			Type:        OrderTypeMarket,
+			Symbol:      d.Symbol,
+			Exchange:    d.Exchange,
+			Side:        exitSide(positionSide(d.Action)),
+			ReduceOnly:  true,
+			SlippageBps: d.SlippageBps,
+		}}
+	}
+	if !increasesExposure(d.Action) || entry <= 0 || d.PositionSizeUSD <= 0 {
+		return nil
+	}
+
+	side := positionSide(d.Action)
+	entryOrder := OrderIntent{
+		Purpose:     OrderPurposeEntry,
+		Type:        OrderTypeMarket,
+		Symbol:      d.Symbol,
+		Exchange:    d.Exchange,
+		Side:        entrySide(side),
+		Leverage:    d.Leverage,
+		SlippageBps: d.SlippageBps,
+	}
+	if isLimitOrder(d) {
+		entry = d.LimitPrice
+		entryOrder.Type = OrderTypeLimit
+		entryOrder.Price = d.LimitPrice
+		entryOrder.SlippageBps = 0
+	}
+	quantity := d.PositionSizeUSD / entry
+	entryOrder.Quantity = quantity
+	intents := []OrderIntent{entryOrder}
+
+	if d.StopLoss > 0 {
+		intents = append(intents, OrderIntent{
+			Purpose:    OrderPurposeStopLoss,
+			Type:       OrderTypeStopMarket,
+			Symbol:     d.Symbol,
+			Exchange:   d.Exchange,
+			Side:       exitSide(side),
+			Quantity:   quantity,
+			Price:      d.StopLoss,
+			ReduceOnly: true,
+		})
+	}
+
+	tps := takeProfitTargets(d)
+	if len(tps) == 1 && tps[0] <= 0 {
+		tps = nil
+	}
+	split := ladderSplit(len(tps))
+	for i, tp := range tps {
+		intents = append(intents, OrderIntent{
+			Purpose:    OrderPurposeTakeProfit,
+			Type:       OrderTypeLimit,
+			Symbol:     d.Symbol,
+			Exchange:   d.Exchange,
+			Side:       exitSide(side),
+			Quantity:   quantity * split[i] / 100,
+			Price:      tp,
+			ReduceOnly: true,
+		})
+	}
+
+	intents = append(intents, OrderIntent{
+		Purpose:    OrderPurposeTrailingStop,
+		Type:       OrderTypeStopMarket,
+		Symbol:     d.Symbol,
+		Exchange:   d.Exchange,
+		Side:       exitSide(side),
+		Quantity:   quantity,
+		ReduceOnly: true,
+		TrailBands: DefaultTrailBands,
+	})
+	return intents
+}
+
+// ladderSplit 返回n级分批止盈的仓位分配（%）：三级按30/30/40，其他级数平均分配
+func ladderSplit(n int) []float64 {
+	if n == len(defaultLadderSplit) {
+		return defaultLadderSplit
+	}
+	split := make([]float64, n)
+	for i := range split {
+		split[i] = 100 / float64(n)
+	}
+	return split
+}
+
+// entrySide 开仓方向对应的下单方向
+func entrySide(side string) string {
+	if side == "short" {
+		return "SELL"
+	}
+	return "BUY"
+}
+
+// exitSide 平仓方向对应的下单方向
+func exitSide(side string) string {
+	if side == "short" {
+		return "BUY"
+	}
+	return "SELL"
+}
@@ -0,0 +1,56 @@
+package decision
+
+import (
+	"math"
+	"testing"
+)
+
+func TestToOrderIntentsLong(t *testing.T) {
+	d := &Decision{Symbol: "ETHUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 300, SlippageBps: 20,
+		StopLoss: 2940, TakeProfitLevels: []float64{3150, 3225, 3300}}
+
+	intents := d.ToOrderIntents(3000) // 数量 300/3000 = 0.1
+	want := []OrderIntent{
+		{Purpose: OrderPurposeEntry, Type: OrderTypeMarket, Side: "BUY", Quantity: 0.1, Leverage: 3, SlippageBps: 20},
+		{Purpose: OrderPurposeStopLoss, Type: OrderTypeStopMarket, Side: "SELL", Quantity: 0.1, Price: 2940, ReduceOnly: true},
+		{Purpose: OrderPurposeTakeProfit, Type: OrderTypeLimit, Side: "SELL", Quantity: 0.03, Price: 3150, ReduceOnly: true},
+		{Purpose: OrderPurposeTakeProfit, Type: OrderTypeLimit, Side: "SELL", Quantity: 0.03, Price: 3225, ReduceOnly: true},
+		{Purpose: OrderPurposeTakeProfit, Type: OrderTypeLimit, Side: "SELL", Quantity: 0.04, Price: 3300, ReduceOnly: true},
+		{Purpose: OrderPurposeTrailingStop, Type: OrderTypeStopMarket, Side: "SELL", Quantity: 0.1, ReduceOnly: true},
+	}
+	if len(intents) != len(want) {
+		t.Fatalf("订单数 = %d, want %d: %+v", len(intents), len(want), intents)
+	}
+	for i, w := range want {
+		got := intents[i]
+		if got.Purpose != w.Purpose || got.Type != w.Type || got.Side != w.Side || got.Price != w.Price ||
+			got.ReduceOnly != w.ReduceOnly || got.Leverage != w.Leverage || got.SlippageBps != w.SlippageBps ||
+			math.Abs(got.Quantity-w.Quantity) > 1e-9 || got.Symbol != "ETHUSDT" {
+			t.Errorf("订单 #%d = %+v, want %+v", i+1, got, w)
+		}
+	}
+	if len(intents[5].TrailBands) != len(DefaultTrailBands) {
+		t.Error("移动止损应带默认档位")
+	}
+}
+
+func TestToOrderIntentsLimitAndClose(t *testing.T) {
+	d := &Decision{Symbol: "SOLUSDT", Action: "open_short", Leverage: 3, PositionSizeUSD: 300,
+		OrderType: OrderTypeLimit, LimitPrice: 150, StopLoss: 153, TakeProfit: 135, SlippageBps: 20}
+	intents := d.ToOrderIntents(148)
+	if entry := intents[0]; entry.Type != OrderTypeLimit || entry.Price != 150 || entry.Side != "SELL" ||
+		entry.Quantity != 2 || entry.SlippageBps != 0 {
+		t.Errorf("限价开空入场单 = %+v", entry)
+	}
+	if tp := intents[2]; tp.Purpose != OrderPurposeTakeProfit || tp.Side != "BUY" || tp.Quantity != 2 {
+		t.Errorf("单一止盈应全部数量: %+v", tp)
+	}
+
+	closing := (&Decision{Symbol: "BTCUSDT", Action: "close_long"}).ToOrderIntents(0)
+	if len(closing) != 1 || closing[0].Side != "SELL" || !closing[0].ReduceOnly || closing[0].Quantity != 0 {
+		t.Errorf("平多应展开为只减仓的市价卖单: %+v", closing)
+	}
+	if got := (&Decision{Symbol: "BTCUSDT", Action: "hold"}).ToOrderIntents(100000); got != nil {
+		t.Errorf("hold 不需要下单: %+v", got)
+	}
+}
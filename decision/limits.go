@@ -0,0 +1,117 @@
+package decision
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ExchangeLimits 交易所对单个币种的实时交易限制
+type ExchangeLimits struct {
+	MaxLeverage int     // 最大杠杆倍数（0表示未知）
+	MaxNotional float64 // 最大仓位名义价值USD（0表示未知）
+	MinNotional float64 // 最小下单名义价值USD（0表示未知）
+}
+
+// LimitsProvider 获取币种实时交易限制（由交易所适配器实现）
+type LimitsProvider interface {
+	GetSymbolLimits(symbol string) (*ExchangeLimits, error)
+}
+
+// cachedLimitsProvider 按币种缓存交易限制（交易所限制变化不频繁）
+type cachedLimitsProvider struct {
+	provider LimitsProvider
+	ttl      time.Duration
+	mu       sync.Mutex
+	cache    map[string]cachedLimits
+}
+
+type cachedLimits struct {
+	limits    *ExchangeLimits
+	fetchedAt time.Time
+}
+
+// NewCachedLimitsProvider 创建带缓存的交易限制提供者
+func NewCachedLimitsProvider(provider LimitsProvider, ttl time.Duration) LimitsProvider {
+	return &cachedLimitsProvider{
+		provider: provider,
+		ttl:      ttl,
+		cache:    make(map[string]cachedLimits),
+	}
+}
+
+// GetSymbolLimits 获取币种交易限制（TTL内使用缓存）
+func (p *cachedLimitsProvider) GetSymbolLimits(symbol string) (*ExchangeLimits, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if entry, ok := p.cache[symbol]; ok && time.Since(entry.fetchedAt) < p.ttl {
+		return entry.limits, nil
+	}
+
+	limits, err := p.provider.GetSymbolLimits(symbol)
+	if err != nil {
+		return nil, err
+	}
+	p.cache[symbol] = cachedLimits{limits: limits, fetchedAt: time.Now()}
+	return limits, nil
+}
+
+// validateExchangeLimits 验证开仓决策不超过交易所对该币种的实时杠杆和仓位限制
+func validateExchangeLimits(d *Decision, ctx *Context) error {
+	if ctx.LimitsProvider == nil || !isOpenAction(d.Action) {
+		return nil
+	}
+
+	limits, err := ctx.LimitsProvider.GetSymbolLimits(d.Symbol)
+	if err != nil {
+		// 获取失败不阻断决策，仍由配置的杠杆上限兜底
+		log.Printf("⚠️  获取 %s 交易所实时限制失败，跳过检查: %v", d.Symbol, err)
+		return nil
+	}
+	if limits == nil {
+		return nil
+	}
+
+	if limits.MaxLeverage > 0 && d.Leverage > limits.MaxLeverage {
+		return fmt.Errorf("%s 杠杆%dx超过交易所实时上限%dx", d.Symbol, d.Leverage, limits.MaxLeverage)
+	}
+	if limits.MaxNotional > 0 && d.PositionSizeUSD > limits.MaxNotional {
+		return fmt.Errorf("%s 仓位价值%.0f USDT超过交易所实时上限%.0f USDT", d.Symbol, d.PositionSizeUSD, limits.MaxNotional)
+	}
+	return nil
+}
+
+// minNotionalFor 返回币种的最小下单名义价值（优先使用交易所实时限制，否则使用 RiskConfig.MinNotionalUSD，0表示不检查）
+func minNotionalFor(symbol string, ctx *Context) float64 {
+	if ctx.LimitsProvider != nil {
+		if limits, err := ctx.LimitsProvider.GetSymbolLimits(symbol); err == nil && limits != nil && limits.MinNotional > 0 {
+			return limits.MinNotional
+		}
+	}
+	return ctx.Risk.MinNotionalUSD
+}
+
+// validatePartialCloseRemainder 拒绝会留下碎仓的部分平仓：平仓后剩余仓位价值（按标记价）低于最小下单金额时，
+// 剩余部分之后无法单独平掉，应改为全部平仓
+func validatePartialCloseRemainder(d *Decision, ctx *Context) error {
+	if d.Action != "partial_close" || d.ClosePercentage >= 100 {
+		return nil
+	}
+	minNotional := minNotionalFor(d.Symbol, ctx)
+	if minNotional <= 0 {
+		return nil
+	}
+	for _, pos := range activePositions(ctx.Positions) {
+		if pos.Symbol != d.Symbol || pos.MarkPrice <= 0 {
+			continue
+		}
+		remaining := pos.Quantity * (1 - d.ClosePercentage/100) * pos.MarkPrice
+		if remaining < minNotional {
+			return fmt.Errorf("%s 部分平仓%.0f%%后剩余仓位价值%.2f USDT低于最小下单金额%.2f USDT，将留下无法平仓的碎仓，请改为全部平仓（close_%s）",
+				d.Symbol, d.ClosePercentage, remaining, minNotional, pos.Side)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package decision
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubLimitsProvider 按币种返回固定的交易所限制
+type stubLimitsProvider map[string]*ExchangeLimits
+
+func (p stubLimitsProvider) GetSymbolLimits(symbol string) (*ExchangeLimits, error) {
+	return p[symbol], nil
+}
+
+func TestValidateExchangeLimits(t *testing.T) {
+	ctx := testContext()
+	ctx.LimitsProvider = stubLimitsProvider{
+		"ETHUSDT": {MaxLeverage: 2},  // 低于配置的5x
+		"SOLUSDT": {MaxLeverage: 20}, // 高于配置的5x
+	}
+
+	err := validateDecisions(testOpens(), ctx)
+	var verrs *ValidationErrors
+	if !errors.As(err, &verrs) || len(verrs.Decisions) != 1 {
+		t.Fatalf("应只拒绝 ETHUSDT: %v", err)
+	}
+	if de := verrs.Decisions[0]; de.Symbol != "ETHUSDT" || !strings.Contains(de.Err.Error(), "交易所实时上限2x") {
+		t.Errorf("拒绝原因错误: %v", de)
+	}
+}
+
+func TestValidatePartialCloseRemainder(t *testing.T) {
+	ctx := testContext() // BTC多仓 0.01 × 101000 = 1010 USDT
+	ctx.Risk.MinNotionalUSD = 20
+	partial := func(pct float64) Decision {
+		return Decision{Symbol: "BTCUSDT", Action: "partial_close", ClosePercentage: pct, Reasoning: "锁定部分利润"}
+	}
+
+	err := validateDecisions([]Decision{partial(99)}, ctx)
+	if err == nil || !strings.Contains(err.Error(), "剩余仓位价值10.10 USDT低于最小下单金额20.00 USDT") ||
+		!strings.Contains(err.Error(), "close_long") {
+		t.Errorf("平仓99%%留下碎仓应拒绝并建议全部平仓: %v", err)
+	}
+	if err := validateDecisions([]Decision{partial(30)}, ctx); err != nil {
+		t.Errorf("平仓30%%应通过: %v", err)
+	}
+
+	// 交易所实时限制优先于配置
+	ctx.LimitsProvider = stubLimitsProvider{"BTCUSDT": {MinNotional: 5}}
+	if err := validateDecisions([]Decision{partial(99)}, ctx); err != nil {
+		t.Errorf("剩余价值高于交易所最小下单金额时应通过: %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package decision
+
+import (
+	"fmt"
+	"math"
+	"nofx/market"
+	"strings"
+	"unicode/utf8"
+)
+
+// 价格跳变检测的默认阈值（百分比）
+const (
+	defaultMaxPriceJumpPctMajor = 50.0
+	defaultMaxPriceJumpPctAlt   = 150.0
+)
+
+// marginMismatchTolerancePct 持仓保证金与计算值的允许偏差（%）
+const marginMismatchTolerancePct = 20.0
+
+// defaultBlessedClosePercentages 与分批止盈策略（30%/30%/40%）一致的常规部分平仓比例
+var defaultBlessedClosePercentages = []float64{30, 40, 50, 100}
+
+// 指标矛盾检测阈值（RSI7）
+const (
+	contradictionRSIOverbought = 80.0
+	contradictionRSIOversold   = 20.0
+)
+
+// lintDecisions 软性检查：不拒绝决策，只返回需要操作员关注的警告
+func lintDecisions(decisions []Decision, ctx *Context) []string {
+	var warnings []string
+	for i := range decisions {
+		d := &decisions[i]
+		if w := lintHighLeverage(d, ctx); w != "" {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := DataContradiction(d, ctx.MarketDataMap[d.Symbol]); w != "" && !ctx.Risk.RejectContradictions {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := lintSignalType(d, ctx); w != "" {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := lintClosePercentage(d, ctx); w != "" {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := lintRoundTakeProfits(d, ctx); w != "" {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := weakLadder(d, ctx); w != "" && !ctx.Risk.RejectWeakLadder {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := tightStop(d, ctx); w != "" && !ctx.Risk.RejectTightStop {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+		if w := lintOrphanHold(d, ctx); w != "" {
+			warnings = append(warnings, fmt.Sprintf("决策 #%d %s: %s", i+1, d.Symbol, w))
+		}
+	}
+	return warnings
+}
+
+// lintHighLeverage 开仓杠杆明显高于保守基准时提醒（硬上限由 validateDecision 负责）
+func lintHighLeverage(d *Decision, ctx *Context) string {
+	base := ctx.Risk.ConservativeLeverage
+	if base <= 0 || !isOpenAction(d.Action) {
+		return ""
+	}
+	multiplier := ctx.Risk.LeverageWarnMultiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	if threshold := float64(base) * multiplier; float64(d.Leverage) > threshold {
+		return fmt.Sprintf("高杠杆 %dx 超过保守基准%dx的%.1f倍（%.0fx），请关注", d.Leverage, base, multiplier, threshold)
+	}
+	return ""
+}
+
+// DataContradiction 检查开仓方向是否与指标明显矛盾（RSI极度超买且MACD看空时做多，或反之），返回矛盾描述
+func DataContradiction(d *Decision, data *market.Data) string {
+	if data == nil || !isOpenAction(d.Action) {
+		return ""
+	}
+	if d.Action == "open_long" && data.CurrentRSI7 >= contradictionRSIOverbought && data.CurrentMACD < 0 {
+		return fmt.Sprintf("指标矛盾: RSI7=%.1f极度超买且MACD=%.4f看空，仍然做多", data.CurrentRSI7, data.CurrentMACD)
+	}
+	if d.Action == "open_short" && data.CurrentRSI7 <= contradictionRSIOversold && data.CurrentMACD > 0 {
+		return fmt.Sprintf("指标矛盾: RSI7=%.1f极度超卖且MACD=%.4f看多，仍然做空", data.CurrentRSI7, data.CurrentMACD)
+	}
+	return ""
+}
+
+// lintSignalType 开仓给出了未知的信号类型时提醒（不拒绝，便于发现新的信号分类）
+func lintSignalType(d *Decision, ctx *Context) string {
+	if !isOpenAction(d.Action) || d.SignalType == "" {
+		return ""
+	}
+	for _, t := range signalTypes(ctx) {
+		if d.SignalType == t {
+			return ""
+		}
+	}
+	return fmt.Sprintf("未知的信号类型 %q，已知类型: %s", d.SignalType, strings.Join(signalTypes(ctx), ", "))
+}
+
+// lintClosePercentage 部分平仓比例不属于常规分批比例时提醒（如17%，可能是AI计算错误）
+func lintClosePercentage(d *Decision, ctx *Context) string {
+	if d.Action != "partial_close" || d.ClosePercentage <= 0 {
+		return ""
+	}
+	blessed := ctx.Risk.BlessedClosePercentages
+	if len(blessed) == 0 {
+		blessed = defaultBlessedClosePercentages
+	}
+	for _, pct := range blessed {
+		if math.Abs(d.ClosePercentage-pct) < 0.01 {
+			return ""
+		}
+	}
+	return fmt.Sprintf("部分平仓比例%.1f%%不是常规分批比例%v，请确认", d.ClosePercentage, blessed)
+}
+
+// weakLadder 检查分批止盈（至少3级）的最后一级目标是否达到最低风险回报比，返回问题描述
+// 风险回报比按入场价（有市场数据时为当前价）到止损的距离计算，不计手续费
+func weakLadder(d *Decision, ctx *Context) string {
+	floor := ctx.Risk.MinFinalTakeProfitRR
+	if floor <= 0 || !isOpenAction(d.Action) || len(d.TakeProfitLevels) < 3 || d.StopLoss <= 0 {
+		return ""
+	}
+	entry := decisionEntryPrice(d, ctx)
+	risk := math.Abs(entry - d.StopLoss)
+	if entry <= 0 || risk == 0 {
+		return ""
+	}
+	final := d.TakeProfitLevels[len(d.TakeProfitLevels)-1]
+	if rr := math.Abs(final-entry) / risk; rr < floor {
+		return fmt.Sprintf("最后一级止盈%.4f的风险回报比仅%.2f:1，低于%.1f:1，分批止盈缺少上行空间", final, rr, floor)
+	}
+	return ""
+}
+
+// tightStop 检查开仓止损距入场价是否至少 MinStopATRMultiple 倍ATR（4小时ATR14），返回问题描述
+func tightStop(d *Decision, ctx *Context) string {
+	k := ctx.Risk.MinStopATRMultiple
+	if k <= 0 || !isOpenAction(d.Action) || d.StopLoss <= 0 {
+		return ""
+	}
+	data, ok := ctx.MarketDataMap[d.Symbol]
+	if !ok || data == nil || data.LongerTermContext == nil || data.LongerTermContext.ATR14 <= 0 {
+		return ""
+	}
+	entry := decisionEntryPrice(d, ctx)
+	if entry <= 0 {
+		return ""
+	}
+	atr := data.LongerTermContext.ATR14
+	if distance := math.Abs(entry - d.StopLoss); distance < k*atr {
+		return fmt.Sprintf("止损距离%.4f仅%.2f倍ATR(%.4f)，低于%.2f倍，容易被正常波动扫损", distance, distance/atr, atr, k)
+	}
+	return ""
+}
+
+// lintOrphanHold 对没有持仓的币种给出 hold 决策时提醒（说明AI混淆了持仓状态；不带币种的 hold 表示整体持有，不检查）
+func lintOrphanHold(d *Decision, ctx *Context) string {
+	if d.Action != "hold" || d.Symbol == "" {
+		return ""
+	}
+	for _, pos := range activePositions(ctx.Positions) {
+		if pos.Symbol == d.Symbol {
+			return ""
+		}
+	}
+	return "对没有持仓的币种给出 hold，AI可能混淆了持仓状态（未持仓应使用 wait）"
+}
+
+// lintRoundTakeProfits 所有止盈目标都是整数关口时提醒（往往说明AI没有参考实际的支撑阻力位）
+// 整数单位按价格量级取：3857 → 100，0.5234 → 0.01；至少2个止盈目标才检查，避免单个目标的巧合
+func lintRoundTakeProfits(d *Decision, ctx *Context) string {
+	if !ctx.WarnRoundTakeProfits || !isOpenAction(d.Action) {
+		return ""
+	}
+	tps := takeProfitTargets(d)
+	price := decisionEntryPrice(d, ctx)
+	if len(tps) < 2 || price <= 0 {
+		return ""
+	}
+
+	unit := math.Pow(10, math.Floor(math.Log10(price))-1)
+	for _, tp := range tps {
+		steps := tp / unit
+		if math.Abs(steps-math.Round(steps)) > 1e-6 {
+			return ""
+		}
+	}
+	return fmt.Sprintf("止盈目标 %v 全部是%g的整数倍（当前价%.4f），可能未参考实际的支撑阻力位", tps, unit, price)
+}
+
+// lintCandidateCoverage 检查AI是否点评了每个已分析的候选币种（RequirePerCandidateReasoning模式）
+// 候选币种有决策、或思维链中有以该币种开头的点评行（SYMBOL: 结论）才算覆盖；
+// 只在回显的候选列表或其他币种的分析中顺带提到不算
+func lintCandidateCoverage(cotTrace string, decisions []Decision, ctx *Context) []string {
+	if !ctx.RequirePerCandidateReasoning {
+		return nil
+	}
+
+	covered := make(map[string]bool)
+	for _, d := range decisions {
+		covered[d.Symbol] = true
+	}
+	for _, line := range strings.Split(cotTrace, "\n") {
+		if symbol := reasoningLineSymbol(line); symbol != "" {
+			covered[symbol] = true
+		}
+	}
+
+	var missing []string
+	for _, coin := range renderedCandidates(ctx) {
+		if !covered[coin.Symbol] {
+			missing = append(missing, coin.Symbol)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("AI未点评以下候选币种: %s", strings.Join(missing, ", "))}
+}
+
+// reasoningLineSymbol 解析思维链中的单币种点评行（"SYMBOL: 结论"，允许列表符号、序号和加粗），不是点评行时返回空
+func reasoningLineSymbol(line string) string {
+	line = strings.TrimLeft(strings.TrimSpace(line), "-*•#>0123456789.)、 \t")
+	sep := strings.IndexAny(line, ":：")
+	if sep <= 0 {
+		return ""
+	}
+	symbol := strings.Trim(strings.TrimSpace(line[:sep]), "*`")
+	_, sepWidth := utf8.DecodeRuneInString(line[sep:])
+	if rest := strings.Trim(line[sep+sepWidth:], "*` \t"); rest == "" || symbol == "" || strings.ContainsAny(symbol, " \t") {
+		return ""
+	}
+	return strings.ToUpper(symbol)
+}
+
+// contextWarnings 汇总上下文中的数据异常（持仓数据等），随决策一起返回给操作员
+func contextWarnings(ctx *Context) []string {
+	warnings := append([]string(nil), ctx.reconcileNotes...)
+	if note := abnormalEquityChange(ctx); note != "" {
+		warnings = append(warnings, "🚨 "+note)
+	}
+	for _, pos := range ctx.Positions {
+		if pos.Quantity <= 0 {
+			warnings = append(warnings, fmt.Sprintf("持仓 %s %s: 数量无效(%.4f)，已从prompt中忽略", pos.Symbol, pos.Side, pos.Quantity))
+			continue
+		}
+		for _, anomaly := range positionAnomalies(pos, ctx) {
+			warnings = append(warnings, fmt.Sprintf("持仓 %s %s: %s", pos.Symbol, pos.Side, anomaly))
+		}
+	}
+	return warnings
+}
+
+// positionAnomalies 检查单个持仓的数据异常，返回异常描述（同时渲染到prompt中）
+func positionAnomalies(pos PositionInfo, ctx *Context) []string {
+	var anomalies []string
+	if note := positionPriceJump(pos, ctx.Risk); note != "" {
+		anomalies = append(anomalies, note)
+	}
+	if note := positionMarginMismatch(pos); note != "" {
+		anomalies = append(anomalies, note)
+	}
+	if !ctx.MarketDataFetchedAt.IsZero() && ctx.MarketDataMap[pos.Symbol] == nil {
+		anomalies = append(anomalies, fmt.Sprintf("%s 本周期未能获取市场数据，AI只能依据持仓信息判断，请人工关注该持仓", pos.Symbol))
+	}
+	return anomalies
+}
+
+// positionMarginMismatch 检查报告的保证金与 价格×数量÷杠杆 是否一致（入场价或标记价口径任一吻合即视为一致，不同交易所口径不同）
+func positionMarginMismatch(pos PositionInfo) string {
+	if pos.MarginUsed <= 0 || pos.Quantity <= 0 || pos.Leverage <= 0 || pos.EntryPrice <= 0 {
+		return ""
+	}
+	expected := pos.EntryPrice * pos.Quantity / float64(pos.Leverage)
+	candidates := []float64{expected}
+	if pos.MarkPrice > 0 {
+		candidates = append(candidates, pos.MarkPrice*pos.Quantity/float64(pos.Leverage))
+	}
+	for _, c := range candidates {
+		if math.Abs(pos.MarginUsed-c)/c*100 <= marginMismatchTolerancePct {
+			return ""
+		}
+	}
+	return fmt.Sprintf("数据不一致: 保证金%.2f与入场价×数量÷杠杆=%.2f相差超过%.0f%%，持仓数据可能有误", pos.MarginUsed, expected, marginMismatchTolerancePct)
+}
+
+// positionPriceJump 检查标记价相对入场价的偏离是否超出合理范围（通常意味着数据错误）
+func positionPriceJump(pos PositionInfo, cfg RiskConfig) string {
+	if pos.EntryPrice <= 0 || pos.MarkPrice <= 0 {
+		return ""
+	}
+
+	threshold := cfg.MaxPriceJumpPctAlt
+	if threshold <= 0 {
+		threshold = defaultMaxPriceJumpPctAlt
+	}
+	if isMajorSymbol(pos.Symbol) {
+		threshold = cfg.MaxPriceJumpPctMajor
+		if threshold <= 0 {
+			threshold = defaultMaxPriceJumpPctMajor
+		}
+	}
+
+	jumpPct := math.Abs(pos.MarkPrice-pos.EntryPrice) / pos.EntryPrice * 100
+	if jumpPct > threshold {
+		return fmt.Sprintf("数据异常: 当前价偏离入场价%.1f%%（阈值%.0f%%），价格数据可能有误，请谨慎决策", jumpPct, threshold)
+	}
+	return ""
+}
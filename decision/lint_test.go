@@ -0,0 +1,319 @@
+package decision
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintHighLeverage(t *testing.T) {
+	ctx := &Context{Risk: RiskConfig{ConservativeLeverage: 3}}
+	for _, tt := range []struct {
+		leverage int
+		warn     bool
+	}{
+		{3, false},
+		{6, false}, // 默认2倍即6x以内不警告
+		{10, true},
+	} {
+		d := &Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: tt.leverage}
+		if got := lintHighLeverage(d, ctx); (got != "") != tt.warn {
+			t.Errorf("杠杆%dx: warning = %q, want warn=%v", tt.leverage, got, tt.warn)
+		}
+	}
+
+	d := &Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 10}
+	if got := lintHighLeverage(d, &Context{}); got != "" {
+		t.Errorf("未配置保守杠杆时不应警告: %q", got)
+	}
+	ctx.Risk.LeverageWarnMultiplier = 4
+	if got := lintHighLeverage(d, ctx); got != "" {
+		t.Errorf("10x 在 3x×4 以内不应警告: %q", got)
+	}
+	if got := lintHighLeverage(&Decision{Symbol: "SOLUSDT", Action: "open_short", Leverage: 15}, ctx); !strings.Contains(got, "15x") {
+		t.Errorf("警告应包含杠杆倍数: %q", got)
+	}
+}
+
+func TestPositionPriceJump(t *testing.T) {
+	tests := []struct {
+		name string
+		pos  PositionInfo
+		flag bool
+	}{
+		{"BTC正常波动", PositionInfo{Symbol: "BTCUSDT", EntryPrice: 100000, MarkPrice: 105000}, false},
+		{"BTC价格翻倍", PositionInfo{Symbol: "BTCUSDT", EntryPrice: 100000, MarkPrice: 200000}, true},
+		{"山寨币大涨仍在阈值内", PositionInfo{Symbol: "SOLUSDT", EntryPrice: 100, MarkPrice: 200}, false},
+		{"山寨币不可能的跳变", PositionInfo{Symbol: "SOLUSDT", EntryPrice: 100, MarkPrice: 1000}, true},
+		{"标记价未知", PositionInfo{Symbol: "SOLUSDT", EntryPrice: 100}, false},
+	}
+	for _, tt := range tests {
+		if got := positionPriceJump(tt.pos, RiskConfig{}); (got != "") != tt.flag {
+			t.Errorf("%s: got %q, want flag=%v", tt.name, got, tt.flag)
+		}
+	}
+
+	// 自定义阈值
+	cfg := RiskConfig{MaxPriceJumpPctMajor: 10}
+	if got := positionPriceJump(PositionInfo{Symbol: "ETHUSDT", EntryPrice: 3000, MarkPrice: 3600}, cfg); got == "" {
+		t.Error("ETH偏离20%超过自定义阈值10%应标记")
+	}
+}
+
+func TestLintCandidateCoverage(t *testing.T) {
+	ctx := testContext()
+	ctx.RequirePerCandidateReasoning = true
+	decisions := []Decision{{Symbol: "ETHUSDT", Action: "wait", Reasoning: "量能不足"}}
+
+	warnings := lintCandidateCoverage("ETHUSDT 量能不足，继续观望", decisions, ctx)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "SOLUSDT") || strings.Contains(warnings[0], "ETHUSDT") {
+		t.Errorf("应只标记未点评的 SOLUSDT: %v", warnings)
+	}
+
+	for _, cot := range []string{"SOLUSDT: 结构不清晰，观望", "- **SOLUSDT**：结构不清晰", "2. SOLUSDT: 观望"} {
+		if warnings := lintCandidateCoverage(cot, decisions, ctx); len(warnings) != 0 {
+			t.Errorf("思维链 %q 中点评过的候选币种不应标记: %v", cot, warnings)
+		}
+	}
+
+	// 只在候选列表回显或其他币种的分析中提到，不算点评
+	for _, cot := range []string{"候选: ETHUSDT, SOLUSDT", "ETHUSDT: 比 SOLUSDT 强，观望", "SOLUSDT:"} {
+		if warnings := lintCandidateCoverage(cot, decisions, ctx); len(warnings) != 1 || !strings.Contains(warnings[0], "SOLUSDT") {
+			t.Errorf("思维链 %q 没有点评 SOLUSDT，应标记: %v", cot, warnings)
+		}
+	}
+
+	ctx.RequirePerCandidateReasoning = false
+	if warnings := lintCandidateCoverage("", nil, ctx); warnings != nil {
+		t.Errorf("未启用时不应检查: %v", warnings)
+	}
+}
+
+func TestDataContradiction(t *testing.T) {
+	ctx := testContext()
+	long := testOpens()[:1]
+
+	for _, w := range lintDecisions(long, ctx) {
+		if strings.Contains(w, "指标矛盾") {
+			t.Errorf("指标正常的做多不应警告: %s", w)
+		}
+	}
+
+	eth := ctx.MarketDataMap["ETHUSDT"]
+	eth.CurrentRSI7, eth.CurrentMACD = 85, -2
+	found := false
+	for _, w := range lintDecisions(long, ctx) {
+		found = found || strings.Contains(w, "指标矛盾")
+	}
+	if !found {
+		t.Error("RSI极度超买且MACD看空时做多应警告")
+	}
+	if err := validateDecisions(testOpens()[:1], ctx); err != nil {
+		t.Errorf("默认只警告不拒绝: %v", err)
+	}
+
+	ctx.Risk.RejectContradictions = true
+	if err := validateDecisions(testOpens()[:1], ctx); err == nil || !strings.Contains(err.Error(), "指标矛盾") {
+		t.Errorf("配置拒绝后应拒绝矛盾开仓: %v", err)
+	}
+}
+
+func TestLintRoundTakeProfits(t *testing.T) {
+	ctx := testContext()
+	ctx.WarnRoundTakeProfits = true
+
+	for _, tt := range []struct {
+		name string
+		tps  []float64
+		warn bool
+	}{
+		{"全部整数关口", []float64{3100, 3200, 3300}, true},
+		{"参考结构位", []float64{3087, 3165, 3290}, false},
+		{"部分整数关口", []float64{3100, 3165}, false},
+		{"单个目标", []float64{3100}, false},
+	} {
+		d := &Decision{Symbol: "ETHUSDT", Action: "open_long", StopLoss: 2940, TakeProfitLevels: tt.tps}
+		if got := lintRoundTakeProfits(d, ctx); (got != "") != tt.warn {
+			t.Errorf("%s: warning = %q, want warn=%v", tt.name, got, tt.warn)
+		}
+	}
+
+	ctx.WarnRoundTakeProfits = false
+	d := &Decision{Symbol: "ETHUSDT", Action: "open_long", StopLoss: 2940, TakeProfitLevels: []float64{3100, 3200}}
+	if got := lintRoundTakeProfits(d, ctx); got != "" {
+		t.Errorf("未启用时不应警告: %q", got)
+	}
+}
+
+func TestLintClosePercentage(t *testing.T) {
+	ctx := &Context{}
+	for _, tt := range []struct {
+		pct  float64
+		warn bool
+	}{
+		{30, false},
+		{100, false},
+		{17, true},
+	} {
+		d := &Decision{Symbol: "BTCUSDT", Action: "partial_close", ClosePercentage: tt.pct}
+		if got := lintClosePercentage(d, ctx); (got != "") != tt.warn {
+			t.Errorf("%.0f%%: warning = %q, want warn=%v", tt.pct, got, tt.warn)
+		}
+	}
+
+	ctx.Risk.BlessedClosePercentages = []float64{17, 83}
+	if got := lintClosePercentage(&Decision{Symbol: "BTCUSDT", Action: "partial_close", ClosePercentage: 17}, ctx); got != "" {
+		t.Errorf("配置的分批比例不应警告: %q", got)
+	}
+	if got := lintClosePercentage(&Decision{Symbol: "BTCUSDT", Action: "partial_close", ClosePercentage: 30}, ctx); got == "" {
+		t.Error("不在配置中的比例应警告")
+	}
+}
+
+func TestSignalType(t *testing.T) {
+	ctx := testContext()
+	ctx.RequireSignalType = true
+
+	tests := []struct {
+		signalType string
+		wantErr    bool
+		wantWarn   bool
+	}{
+		{"", true, false},
+		{"moon_shot", false, true},
+		{"breakout", false, false},
+	}
+	for _, tt := range tests {
+		d := testOpens()[0]
+		d.SignalType = tt.signalType
+		if err := validateDecisions([]Decision{d}, ctx); (err != nil) != tt.wantErr {
+			t.Errorf("signal_type=%q: error = %v, wantErr %v", tt.signalType, err, tt.wantErr)
+		}
+		if got := lintSignalType(&d, ctx); (got != "") != tt.wantWarn {
+			t.Errorf("signal_type=%q: warning = %q, wantWarn %v", tt.signalType, got, tt.wantWarn)
+		}
+	}
+
+	ctx.RequireSignalType = false
+	if err := validateDecisions(testOpens()[:1], ctx); err != nil {
+		t.Errorf("非严格模式下允许不填signal_type: %v", err)
+	}
+}
+
+func TestLintOrphanHold(t *testing.T) {
+	ctx := testContext()
+	for _, tt := range []struct {
+		symbol string
+		warn   bool
+	}{
+		{"ETHUSDT", true}, // 候选币种，没有持仓
+		{"BTCUSDT", false},
+		{"", false}, // 整体持有
+	} {
+		d := &Decision{Symbol: tt.symbol, Action: "hold", Reasoning: "持有"}
+		if got := lintOrphanHold(d, ctx); (got != "") != tt.warn {
+			t.Errorf("hold %q: warning = %q, want warn=%v", tt.symbol, got, tt.warn)
+		}
+	}
+
+	// 数量为0的持仓视为不存在
+	ctx.Positions[0].Quantity = 0
+	if got := lintOrphanHold(&Decision{Symbol: "BTCUSDT", Action: "hold"}, ctx); got == "" {
+		t.Error("数量为0的持仓上的 hold 应提醒")
+	}
+}
+
+func TestPositionMarginMismatch(t *testing.T) {
+	ctx := testContext() // BTC: 100000 × 0.01 ÷ 5 = 200，保证金200
+	if note := positionMarginMismatch(ctx.Positions[0]); note != "" {
+		t.Errorf("一致的持仓不应标记: %s", note)
+	}
+	for _, w := range contextWarnings(ctx) {
+		if strings.Contains(w, "数据不一致") {
+			t.Errorf("一致的持仓不应产生警告: %s", w)
+		}
+	}
+
+	ctx.Positions[0].MarginUsed = 500
+	if note := positionMarginMismatch(ctx.Positions[0]); !strings.Contains(note, "数据不一致: 保证金500.00与入场价×数量÷杠杆=200.00") {
+		t.Errorf("保证金不一致应标记: %q", note)
+	}
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "数据不一致") {
+		t.Error("不一致的持仓应在prompt中标注")
+	}
+	found := false
+	for _, w := range contextWarnings(ctx) {
+		found = found || strings.Contains(w, "持仓 BTCUSDT long: 数据不一致")
+	}
+	if !found {
+		t.Error("不一致的持仓应产生警告")
+	}
+}
+
+func TestWeakLadder(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MinFinalTakeProfitRR = 6
+
+	// ETH入场3000、止损2940，风险60
+	ladder := func(levels ...float64) Decision {
+		d := testOpens()[0]
+		d.TakeProfit, d.TakeProfitLevels = levels[0], levels
+		return d
+	}
+	strong := ladder(3180, 3300, 3360) // 最后一级6:1
+	weak := ladder(3180, 3240, 3300)   // 最后一级5:1
+
+	if w := weakLadder(&strong, ctx); w != "" {
+		t.Errorf("最后一级达到6:1不应警告: %s", w)
+	}
+	if w := weakLadder(&weak, ctx); !strings.Contains(w, "风险回报比仅5.00:1") {
+		t.Errorf("最后一级5:1应警告: %q", w)
+	}
+	if err := validateDecisions([]Decision{weak}, ctx); err != nil {
+		t.Errorf("默认只警告不拒绝: %v", err)
+	}
+
+	ctx.Risk.RejectWeakLadder = true
+	if err := validateDecisions([]Decision{weak}, ctx); err == nil {
+		t.Error("配置拒绝后应拒绝")
+	}
+	if err := validateDecisions([]Decision{strong}, ctx); err != nil {
+		t.Errorf("达标的阶梯应通过: %v", err)
+	}
+}
+
+func TestTightStop(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MinStopATRMultiple = 1
+
+	// ETH当前价3000，4小时ATR14为60
+	withStop := func(stop float64) Decision {
+		d := testOpens()[0]
+		d.StopLoss = stop
+		return d
+	}
+	tight := withStop(3000 - 0.3*60) // 0.3倍ATR
+	wide := withStop(3000 - 1.5*60)  // 1.5倍ATR
+
+	if w := tightStop(&tight, ctx); !strings.Contains(w, "仅0.30倍ATR(60.0000)，低于1.00倍") {
+		t.Errorf("0.3倍ATR的止损应警告: %q", w)
+	}
+	if w := tightStop(&wide, ctx); w != "" {
+		t.Errorf("1.5倍ATR的止损不应警告: %s", w)
+	}
+	if err := validateDecisions([]Decision{tight}, ctx); err != nil {
+		t.Errorf("默认只警告不拒绝: %v", err)
+	}
+
+	ctx.Risk.RejectTightStop = true
+	if err := validateDecisions([]Decision{tight}, ctx); err == nil {
+		t.Error("配置拒绝后0.3倍ATR的止损应拒绝")
+	}
+	if err := validateDecisions([]Decision{wide}, ctx); err != nil {
+		t.Errorf("1.5倍ATR的止损应通过: %v", err)
+	}
+
+	ctx.MarketDataMap["ETHUSDT"].LongerTermContext = nil
+	if w := tightStop(&tight, ctx); w != "" {
+		t.Errorf("没有ATR数据时应跳过: %s", w)
+	}
+}
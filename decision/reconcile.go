@@ -0,0 +1,51 @@
+package decision
+
+import (
+	"fmt"
+	"log"
+)
+
+// LivePositionsProvider 获取交易所实时持仓（由交易所适配器实现），用于核对 Context 中的持仓数据
+type LivePositionsProvider interface {
+	GetLivePositions() ([]PositionInfo, error)
+}
+
+// reconcilePositions 用交易所实时持仓核对 ctx.Positions，找出已不存在的持仓（被强平或在外部平仓），
+// ReconcileDropGhosts 为 true 时从上下文中移除，否则保留并提示；返回核对说明（获取实时持仓失败时跳过核对）
+func reconcilePositions(ctx *Context) []string {
+	if ctx.LivePositions == nil || len(ctx.Positions) == 0 {
+		return nil
+	}
+	live, err := ctx.LivePositions.GetLivePositions()
+	if err != nil {
+		log.Printf("⚠️  获取实时持仓失败，跳过持仓核对: %v", err)
+		return nil
+	}
+
+	liveKeys := make(map[string]bool, len(live))
+	for _, pos := range live {
+		if pos.Quantity > 0 {
+			liveKeys[venueKey(pos.Exchange, pos.Symbol, ctx)+"|"+pos.Side] = true
+		}
+	}
+
+	var notes []string
+	kept := ctx.Positions[:0:0]
+	for _, pos := range ctx.Positions {
+		if pos.Quantity <= 0 || liveKeys[venueKey(pos.Exchange, pos.Symbol, ctx)+"|"+pos.Side] {
+			kept = append(kept, pos)
+			continue
+		}
+		if ctx.ReconcileDropGhosts {
+			notes = append(notes, fmt.Sprintf("持仓 %s %s: 交易所实时持仓中不存在（可能已被强平或在外部平仓），已从上下文中移除", pos.Symbol, pos.Side))
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("持仓 %s %s: 交易所实时持仓中不存在（可能已被强平或在外部平仓），请勿据此决策", pos.Symbol, pos.Side))
+		kept = append(kept, pos)
+	}
+	ctx.Positions = kept
+	if ctx.ReconcileDropGhosts {
+		ctx.Account.PositionCount = len(activePositions(kept))
+	}
+	return notes
+}
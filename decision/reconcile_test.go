@@ -0,0 +1,52 @@
+package decision
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubLivePositions 测试用实时持仓来源
+type stubLivePositions struct {
+	positions []PositionInfo
+	err       error
+}
+
+func (s stubLivePositions) GetLivePositions() ([]PositionInfo, error) {
+	return s.positions, s.err
+}
+
+func TestReconcilePositions(t *testing.T) {
+	eth := PositionInfo{Symbol: "ETHUSDT", Side: "short", EntryPrice: 3100, MarkPrice: 3000, Quantity: 0.1, Leverage: 3, MarginUsed: 100}
+	live := stubLivePositions{positions: []PositionInfo{eth}} // BTC多仓已不存在
+
+	newCtx := func() *Context {
+		ctx := testContext()
+		ctx.Positions = append(ctx.Positions, eth)
+		ctx.Account.PositionCount = 2
+		ctx.LivePositions = live
+		return ctx
+	}
+
+	ctx := newCtx()
+	ctx.ReconcileDropGhosts = true
+	notes := reconcilePositions(ctx)
+	if len(ctx.Positions) != 1 || ctx.Positions[0].Symbol != "ETHUSDT" || ctx.Account.PositionCount != 1 {
+		t.Errorf("应移除幽灵持仓、保留实时持仓: %+v", ctx.Positions)
+	}
+	if len(notes) != 1 || !strings.Contains(notes[0], "BTCUSDT long") || !strings.Contains(notes[0], "已从上下文中移除") {
+		t.Errorf("应说明移除的持仓: %v", notes)
+	}
+
+	ctx = newCtx()
+	notes = reconcilePositions(ctx)
+	if len(ctx.Positions) != 2 || len(notes) != 1 || !strings.Contains(notes[0], "请勿据此决策") {
+		t.Errorf("未配置移除时应保留并提示: positions=%d notes=%v", len(ctx.Positions), notes)
+	}
+
+	ctx = newCtx()
+	ctx.LivePositions = stubLivePositions{err: errors.New("timeout")}
+	if notes := reconcilePositions(ctx); notes != nil || len(ctx.Positions) != 2 {
+		t.Errorf("获取实时持仓失败时应跳过核对: %v", notes)
+	}
+}
@@ -0,0 +1,94 @@
+package decision
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CycleRecord 单个决策周期的可回放记录（发送的prompt、AI原始响应和处理结果）
+type CycleRecord struct {
+	Timestamp     time.Time    `json:"timestamp"`
+	PromptVersion string       `json:"prompt_version,omitempty"`
+	MarketRegime  MarketRegime `json:"market_regime,omitempty"`
+	SystemPrompt  string       `json:"system_prompt"`
+	UserPrompt    string       `json:"user_prompt"`
+	RawResponse   string       `json:"raw_response"`
+	Decisions     []Decision   `json:"decisions"`
+	Warnings      []string     `json:"warnings,omitempty"`
+	Error         string       `json:"error,omitempty"` // 解析或验证失败原因（成功时为空）
+}
+
+// NewCycleRecord 根据 GetFullDecision 的返回值生成周期记录
+func NewCycleRecord(fd *FullDecision, err error) CycleRecord {
+	var record CycleRecord
+	if fd != nil {
+		record = CycleRecord{
+			Timestamp:     fd.Timestamp,
+			PromptVersion: fd.PromptVersion,
+			MarketRegime:  fd.MarketRegime,
+			SystemPrompt:  fd.SystemPrompt,
+			UserPrompt:    fd.UserPrompt,
+			RawResponse:   fd.RawResponse,
+			Decisions:     fd.Decisions,
+			Warnings:      fd.Warnings,
+		}
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// RenderCycleRecord 还原并格式化输出周期记录（完整prompt + 解析结果 + 验证结论），用于离线复盘
+func RenderCycleRecord(record CycleRecord) string {
+	var sb strings.Builder
+	divider := strings.Repeat("=", 70)
+
+	sb.WriteString(fmt.Sprintf("%s\n决策周期记录 %s\n%s\n\n", divider, record.Timestamp.Format("2006-01-02 15:04:05"), divider))
+
+	sb.WriteString("## System Prompt\n\n")
+	sb.WriteString(record.SystemPrompt)
+	sb.WriteString("\n\n## User Prompt\n\n")
+	sb.WriteString(record.UserPrompt)
+	sb.WriteString("\n\n## AI原始响应\n\n")
+	sb.WriteString(record.RawResponse)
+
+	sb.WriteString("\n\n## 解析结果\n\n")
+	if len(record.Decisions) > 0 {
+		decisionJSON, _ := json.MarshalIndent(record.Decisions, "", "  ")
+		sb.Write(decisionJSON)
+		sb.WriteString("\n")
+	} else {
+		sb.WriteString("（无决策）\n")
+	}
+
+	if len(record.Warnings) > 0 {
+		sb.WriteString("\n## 警告\n\n")
+		for _, w := range record.Warnings {
+			sb.WriteString("- " + w + "\n")
+		}
+	}
+
+	sb.WriteString("\n## 验证结论\n\n")
+	if record.Error != "" {
+		sb.WriteString("❌ " + record.Error + "\n")
+	} else {
+		sb.WriteString("✓ 全部通过\n")
+	}
+
+	return sb.String()
+}
+
+// ValidateSession 用当前代码离线重新处理一组周期记录的AI原始响应（提取、修复、解析和验证），返回与记录一一对应的结果（通过为nil）
+// ctx 提供验证所需的账户、杠杆和风控配置；可把生产环境的决策日志作为提取器/验证器的回归语料
+func ValidateSession(records []CycleRecord, ctx *Context) []error {
+	results := make([]error, len(records))
+	for i, record := range records {
+		if _, err := ProcessResponse(record.RawResponse, ctx); err != nil {
+			results[i] = fmt.Errorf("记录 #%d (%s): %w", i+1, record.Timestamp.Format("2006-01-02 15:04:05"), err)
+		}
+	}
+	return results
+}
@@ -0,0 +1,58 @@
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCycleRecordRoundTrip(t *testing.T) {
+	ctx := testContext()
+	fd := &FullDecision{
+		Timestamp:    time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC),
+		SystemPrompt: buildSystemPrompt(ctx, ""),
+		UserPrompt:   buildUserPrompt(ctx),
+		RawResponse:  "观望\n[]",
+		Decisions:    []Decision{{Symbol: "ETHUSDT", Action: "wait", Reasoning: "等待回调"}},
+	}
+
+	data, err := json.Marshal(NewCycleRecord(fd, errors.New("验证失败")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var record CycleRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.UserPrompt != buildUserPrompt(ctx) || record.SystemPrompt != buildSystemPrompt(ctx, "") {
+		t.Error("还原的prompt与原始prompt不一致")
+	}
+
+	rendered := RenderCycleRecord(record)
+	for _, want := range []string{fd.SystemPrompt, fd.UserPrompt, fd.RawResponse, `"symbol": "ETHUSDT"`, "❌ 验证失败", "2026-01-01 08:00:00"} {
+		if !strings.Contains(rendered, want) {
+			t.Errorf("渲染结果缺少 %q", want)
+		}
+	}
+}
+
+func TestValidateSession(t *testing.T) {
+	at := time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC)
+	records := []CycleRecord{
+		{Timestamp: at, RawResponse: "ETH突破。\n\n" + `[{"symbol": "ETHUSDT", "action": "open_long", "leverage": 3, "position_size_usd": 300, "stop_loss": 2940, "take_profit": 3300, "confidence": 80, "reasoning": "突破"}]`},
+		{Timestamp: at.Add(3 * time.Minute), RawResponse: "ETH突破。\n\n" + `[{"symbol": "ETHUSDT", "action": "open_long", "leverage": "三倍"}]`},
+	}
+
+	results := ValidateSession(records, testContext())
+	if len(results) != 2 {
+		t.Fatalf("结果应与记录一一对应, got %d", len(results))
+	}
+	if results[0] != nil {
+		t.Errorf("有效记录应通过: %v", results[0])
+	}
+	if results[1] == nil || !strings.Contains(results[1].Error(), "记录 #2 (2026-01-01 08:03:00)") {
+		t.Errorf("格式错误的记录应失败并标明记录: %v", results[1])
+	}
+}
@@ -0,0 +1,40 @@
+package decision
+
+import "nofx/market"
+
+// MarketRegime 市场状态（用于按市场状态统计策略表现）
+type MarketRegime string
+
+const (
+	RegimeTrendUp   MarketRegime = "trend_up"   // 上升趋势：价格 > EMA20 > EMA50（4小时）
+	RegimeTrendDown MarketRegime = "trend_down" // 下降趋势：价格 < EMA20 < EMA50（4小时）
+	RegimeRange     MarketRegime = "range"      // 震荡：均线纠缠或价格在均线之间
+	RegimeUnknown   MarketRegime = "unknown"    // 缺少BTC数据，无法判断
+)
+
+// regimeReferenceSymbol 判断市场状态使用的参考币种
+const regimeReferenceSymbol = "BTCUSDT"
+
+// ComputeMarketRegime 根据BTC的4小时均线排列判断当前市场状态
+func ComputeMarketRegime(ctx *Context) MarketRegime {
+	return regimeOf(ctx.MarketDataMap[regimeReferenceSymbol])
+}
+
+// regimeOf 根据单个币种的市场数据判断市场状态
+func regimeOf(data *market.Data) MarketRegime {
+	if data == nil || data.LongerTermContext == nil || data.CurrentPrice <= 0 {
+		return RegimeUnknown
+	}
+	ema20, ema50 := data.LongerTermContext.EMA20, data.LongerTermContext.EMA50
+	if ema20 <= 0 || ema50 <= 0 {
+		return RegimeUnknown
+	}
+	switch {
+	case data.CurrentPrice > ema20 && ema20 > ema50:
+		return RegimeTrendUp
+	case data.CurrentPrice < ema20 && ema20 < ema50:
+		return RegimeTrendDown
+	default:
+		return RegimeRange
+	}
+}
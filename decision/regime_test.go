@@ -0,0 +1,55 @@
+package decision
+
+import (
+	"testing"
+
+	"nofx/market"
+)
+
+// btcWithEMAs 构造BTC市场数据：当前价100000，4小时EMA20/EMA50为给定值
+func btcWithEMAs(ema20, ema50 float64) *market.Data {
+	data := testMarketData("BTCUSDT", 100000)
+	data.LongerTermContext.EMA20, data.LongerTermContext.EMA50 = ema20, ema50
+	return data
+}
+
+func TestComputeMarketRegime(t *testing.T) {
+	tests := []struct {
+		name string
+		data *market.Data
+		want MarketRegime
+	}{
+		{"上升趋势", btcWithEMAs(98000, 95000), RegimeTrendUp},
+		{"下降趋势", btcWithEMAs(102000, 105000), RegimeTrendDown},
+		{"价格在均线之间", btcWithEMAs(98000, 101000), RegimeRange},
+		{"缺少BTC数据", nil, RegimeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			ctx.MarketDataMap["BTCUSDT"] = tt.data
+			if tt.data == nil {
+				delete(ctx.MarketDataMap, "BTCUSDT")
+			}
+			if got := ComputeMarketRegime(ctx); got != tt.want {
+				t.Errorf("ComputeMarketRegime() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetFullDecisionStampsMarketRegime(t *testing.T) {
+	ctx := stubContext()
+	ctx.MarketData.(stubMarketData)["BTCUSDT"] = btcWithEMAs(102000, 105000)
+
+	fd, err := GetFullDecision(ctx, stubAIClient(t, aiResponse(t, testOpens()[:1])))
+	if err != nil {
+		t.Fatalf("GetFullDecision: %v", err)
+	}
+	if fd.MarketRegime != RegimeTrendDown || fd.MarketRegime != ComputeMarketRegime(ctx) {
+		t.Errorf("MarketRegime = %q, want %q", fd.MarketRegime, RegimeTrendDown)
+	}
+	if record := NewCycleRecord(fd, nil); record.MarketRegime != RegimeTrendDown {
+		t.Errorf("周期记录应保留市场状态: %q", record.MarketRegime)
+	}
+}
@@ -0,0 +1,787 @@
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"nofx/market"
+	"strings"
+	"time"
+)
+
+// RiskConfig 决策层风控配置（零值表示不启用对应检查，保持原有行为）
+type RiskConfig struct {
+	MaxTotalRiskPct   float64 `json:"max_total_risk_pct,omitempty"`  // 总风险预算：现有持仓+新开仓的止损风险总和占净值的百分比上限（0=不限制）
+	ScanDefensiveOnly bool    `json:"scan_defensive_only,omitempty"` // 扫描周期（CycleTypeScan）只允许持仓管理和防御性操作，拒绝新开仓
+
+	MinAvailableBalanceUSD float64 `json:"min_available_balance_usd,omitempty"` // 可用余额保留底线（USD），低于底线时拒绝开仓、只允许平仓（0=不限制）
+	MaxSameSidePositions   int     `json:"max_same_side_positions,omitempty"`   // 同方向（多或空）最多持仓数量（0=不限制），现有持仓+本批净开仓
+
+	// 夏普比率熔断：夏普比率低于阈值时暂停开仓，并在之后的若干周期内保持暂停
+	SharpeHaltThreshold float64 `json:"sharpe_halt_threshold,omitempty"` // 夏普比率阈值（如-0.5，0=不启用）
+	SharpeHaltCycles    int     `json:"sharpe_halt_cycles,omitempty"`    // 暂停的周期数（0时默认6个周期）
+
+	// 净值突变检测：相邻周期净值变化超过阈值（可能是强平或数据错误）时产生警告
+	MaxEquityChangePct    float64 `json:"max_equity_change_pct,omitempty"`   // 净值变化百分比阈值（如15，0=不检查）
+	EquityChangeDefensive bool    `json:"equity_change_defensive,omitempty"` // 净值突变时本周期只允许防御性操作（拒绝开仓）
+
+	// 低流动性时段（Context.LowLiquidityWindows）内的开仓要求
+	LowLiquidityMinChecklist int     `json:"low_liquidity_min_checklist,omitempty"` // 开仓至少通过的检查项数（ChecklistPassed，0=不要求）
+	LowLiquiditySizeFactor   float64 `json:"low_liquidity_size_factor,omitempty"`   // 单币种仓位上限的缩放比例（0时默认0.5，即减半）
+
+	MaxDailyLossPct float64 `json:"max_daily_loss_pct,omitempty"` // 日亏损熔断：当日已实现亏损占净值的百分比达到上限时暂停开仓（0=不启用，未实现浮亏不计入）
+
+	// 高杠杆提醒：杠杆超过 保守杠杆×倍数 时产生警告（仍在硬上限内，不拒绝）
+	ConservativeLeverage   int     `json:"conservative_leverage,omitempty"`    // 保守杠杆基准（0=不检查）
+	LeverageWarnMultiplier float64 `json:"leverage_warn_multiplier,omitempty"` // 警告倍数（0时默认2倍）
+
+	DefaultLeverage    int `json:"default_leverage,omitempty"`     // 开仓未给出杠杆时使用的默认杠杆（0=不补全，按无效杠杆拒绝）
+	DefaultSlippageBps int `json:"default_slippage_bps,omitempty"` // 开仓未给出滑点容忍度时使用的默认值（基点，0=不补全）
+
+	AllowedLeverages []int `json:"allowed_leverages,omitempty"` // 交易所允许的杠杆档位（如1,2,3,5,10），空表示不限制
+	SnapLeverage     bool  `json:"snap_leverage,omitempty"`     // 杠杆不在允许档位时调整到最近的档位（默认拒绝）
+
+	// 价格跳变检测：持仓标记价偏离入场价超过阈值视为数据异常（0时使用默认值）
+	MaxPriceJumpPctMajor float64 `json:"max_price_jump_pct_major,omitempty"` // BTC/ETH阈值（默认50%）
+	MaxPriceJumpPctAlt   float64 `json:"max_price_jump_pct_alt,omitempty"`   // 山寨币阈值（默认150%）
+
+	RejectContradictions bool `json:"reject_contradictions,omitempty"` // 开仓方向与指标明显矛盾（见 DataContradiction）时拒绝决策（默认只产生警告）
+
+	BlessedClosePercentages []float64 `json:"blessed_close_percentages,omitempty"` // 常规部分平仓比例（%），其他比例产生警告（空时默认30/40/50/100）
+
+	// 时间止损提示：持仓时长接近/超过上限时在持仓信息中标注紧迫程度
+	MaxHoldingDuration time.Duration `json:"max_holding_duration,omitempty"` // 持仓时长上限（0=不提示）
+	HoldingWarnPct     float64       `json:"holding_warn_pct,omitempty"`     // 达到上限的百分比时开始提示（0时默认80%）
+	MinHoldBeforeEval  time.Duration `json:"min_hold_before_eval,omitempty"` // 新仓位保护期：持仓时长短于该值时不提示时间止损，给交易留出空间（0=不保护）
+
+	// 手续费（百分比，如0.04表示0.04%），配置后风险回报比按扣除往返手续费后的实际收益和风险计算
+	TakerFeePct float64 `json:"taker_fee_pct,omitempty"` // 吃单费率（入场和止损出场）
+	MakerFeePct float64 `json:"maker_fee_pct,omitempty"` // 挂单费率（止盈出场，0时按吃单费率）
+
+	MinNotionalUSD float64 `json:"min_notional_usd,omitempty"` // 最小下单名义价值（USD，如5），部分平仓后剩余仓位低于该值时拒绝（0=不检查；交易所实时限制提供时以交易所为准）
+
+	MaxStopMarginLossPct float64 `json:"max_stop_margin_loss_pct,omitempty"` // 触发止损时保证金亏损比例上限（止损距离%×杠杆，0时默认50%，负数表示不检查）
+
+	// 最小止损距离：止损距入场价至少为K倍ATR（4小时ATR14），避免被正常波动扫损，与止损保证金亏损上限构成波动率区间
+	MinStopATRMultiple float64 `json:"min_stop_atr_multiple,omitempty"` // K（如0.5，0=不检查，无ATR数据时跳过）
+	RejectTightStop    bool    `json:"reject_tight_stop,omitempty"`     // 止损过近时拒绝决策（默认只产生警告）
+
+	MinFinalTakeProfitRR float64 `json:"min_final_take_profit_rr,omitempty"` // 分批止盈（至少3级）最后一级目标的最低风险回报比（如3.0，0=不检查），保证阶梯有真正的上行空间
+	RejectWeakLadder     bool    `json:"reject_weak_ladder,omitempty"`       // 最后一级止盈未达到 MinFinalTakeProfitRR 时拒绝决策（默认只产生警告）
+
+	RRAutoCorrectMax float64 `json:"rr_auto_correct_max,omitempty"` // 风险回报比低于硬约束的差距在该值以内时自动放宽第一止盈目标（如0.2，0=不修正，直接拒绝）
+
+	RRTolerance float64 `json:"rr_tolerance,omitempty"` // 风险回报比硬约束的容差，计算值在阈值下方容差内仍视为通过（0时默认0.02，负数表示不容差）
+}
+
+// riskConfigAlias 去掉 RiskConfig 的JSON方法，避免 MarshalJSON/UnmarshalJSON 递归调用
+type riskConfigAlias RiskConfig
+
+// riskConfigJSON RiskConfig 的JSON格式：时长字段使用 "4h"、"30m" 这样的字符串，而不是纳秒数
+type riskConfigJSON struct {
+	*riskConfigAlias
+	MaxHoldingDuration string `json:"max_holding_duration,omitempty"`
+	MinHoldBeforeEval  string `json:"min_hold_before_eval,omitempty"`
+}
+
+// MarshalJSON 时长字段输出为 time.Duration 字符串
+func (c RiskConfig) MarshalJSON() ([]byte, error) {
+	out := riskConfigJSON{riskConfigAlias: (*riskConfigAlias)(&c)}
+	if c.MaxHoldingDuration != 0 {
+		out.MaxHoldingDuration = c.MaxHoldingDuration.String()
+	}
+	if c.MinHoldBeforeEval != 0 {
+		out.MinHoldBeforeEval = c.MinHoldBeforeEval.String()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON 时长字段按 time.ParseDuration 解析（如 "4h"、"90m"）
+func (c *RiskConfig) UnmarshalJSON(data []byte) error {
+	in := riskConfigJSON{riskConfigAlias: (*riskConfigAlias)(c)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"max_holding_duration", in.MaxHoldingDuration, &c.MaxHoldingDuration},
+		{"min_hold_before_eval", in.MinHoldBeforeEval, &c.MinHoldBeforeEval},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil {
+			return fmt.Errorf("%s 必须是时长字符串（如\"4h\"、\"30m\"）: %w", f.name, err)
+		}
+		*f.dst = d
+	}
+	return nil
+}
+
+// maxConfigLeverage 杠杆配置的上限（主流交易所的最高杠杆）
+const maxConfigLeverage = 125
+
+// Validate 启动时检查杠杆档位和风控配置是否合理，一次性返回全部问题
+// 配置错误若留到决策阶段，每个开仓都会以"杠杆必须在1-0之间"之类难以理解的原因被拒绝
+func (c RiskConfig) Validate(btcEthLeverage, altcoinLeverage int) error {
+	var errs []error
+	checkTier := func(name string, leverage int) {
+		if leverage <= 0 || leverage > maxConfigLeverage {
+			errs = append(errs, fmt.Errorf("%s杠杆倍数必须在1-%d之间: %d", name, maxConfigLeverage, leverage))
+		}
+	}
+	checkTier("BTC/ETH", btcEthLeverage)
+	checkTier("山寨币", altcoinLeverage)
+
+	if c.DefaultLeverage < 0 {
+		errs = append(errs, fmt.Errorf("默认杠杆不能为负数: %d", c.DefaultLeverage))
+	}
+	if c.ConservativeLeverage < 0 {
+		errs = append(errs, fmt.Errorf("保守杠杆基准不能为负数: %d", c.ConservativeLeverage))
+	}
+	if c.MinStopATRMultiple < 0 {
+		errs = append(errs, fmt.Errorf("最小止损ATR倍数不能为负数: %.2f", c.MinStopATRMultiple))
+	}
+	for _, lev := range c.AllowedLeverages {
+		if lev <= 0 {
+			errs = append(errs, fmt.Errorf("允许的杠杆档位必须大于0: %v", c.AllowedLeverages))
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// roundTripFeePct 返回一次开平仓的手续费占仓位价值的百分比（profitExit 表示止盈出场）
+func (c RiskConfig) roundTripFeePct(profitExit bool) float64 {
+	exitFee := c.TakerFeePct
+	if profitExit && c.MakerFeePct > 0 {
+		exitFee = c.MakerFeePct
+	}
+	return c.TakerFeePct + exitFee
+}
+
+// defaultMaxStopMarginLossPct 触发止损时保证金亏损比例的默认上限
+const defaultMaxStopMarginLossPct = 50.0
+
+// maxStopMarginLossPct 返回止损保证金亏损上限（未配置时使用默认值，负数表示不检查）
+func (c RiskConfig) maxStopMarginLossPct() float64 {
+	if c.MaxStopMarginLossPct == 0 {
+		return defaultMaxStopMarginLossPct
+	}
+	return c.MaxStopMarginLossPct
+}
+
+// rrTolerance 返回风险回报比容差（未配置时使用默认值）
+func (c RiskConfig) rrTolerance() float64 {
+	switch {
+	case c.RRTolerance > 0:
+		return c.RRTolerance
+	case c.RRTolerance < 0:
+		return 0
+	}
+	return defaultRRTolerance
+}
+
+// defaultSharpeHaltCycles 夏普比率熔断的默认暂停周期数
+const defaultSharpeHaltCycles = 6
+
+// performanceSharpe 从历史表现分析中提取夏普比率（无数据时返回false）
+func performanceSharpe(ctx *Context) (float64, bool) {
+	if ctx.Performance == nil {
+		return 0, false
+	}
+	// 直接从interface{}中提取SharpeRatio
+	var perfData struct {
+		SharpeRatio float64 `json:"sharpe_ratio"`
+	}
+	jsonData, err := json.Marshal(ctx.Performance)
+	if err != nil {
+		return 0, false
+	}
+	if err := json.Unmarshal(jsonData, &perfData); err != nil {
+		return 0, false
+	}
+	return perfData.SharpeRatio, true
+}
+
+// updateSharpeHalt 夏普比率低于阈值时将本周期记为暂停起点
+func updateSharpeHalt(ctx *Context) {
+	if ctx.Risk.SharpeHaltThreshold == 0 {
+		return
+	}
+	if sharpe, ok := performanceSharpe(ctx); ok && sharpe < ctx.Risk.SharpeHaltThreshold {
+		ctx.SharpeHaltStartCycle = ctx.CallCount + 1 // +1：第0个周期触发时也能与"未触发"区分
+	}
+}
+
+// sharpeHalted 判断当前是否处于夏普比率熔断期，返回原因
+func sharpeHalted(ctx *Context) (bool, string) {
+	threshold := ctx.Risk.SharpeHaltThreshold
+	if threshold == 0 {
+		return false, ""
+	}
+	if sharpe, ok := performanceSharpe(ctx); ok && sharpe < threshold {
+		return true, fmt.Sprintf("夏普比率%.2f低于%.2f", sharpe, threshold)
+	}
+
+	cycles := ctx.Risk.SharpeHaltCycles
+	if cycles <= 0 {
+		cycles = defaultSharpeHaltCycles
+	}
+	if ctx.SharpeHaltStartCycle > 0 {
+		start := ctx.SharpeHaltStartCycle - 1
+		if remaining := start + cycles - ctx.CallCount; remaining > 0 {
+			return true, fmt.Sprintf("夏普比率熔断冷却中（周期#%d触发，剩余%d个周期）", start, remaining)
+		}
+	}
+	return false, ""
+}
+
+// abnormalEquityChange 检查相对上一周期的净值变化是否超过阈值，返回描述（未配置或无上一周期净值时返回空）
+func abnormalEquityChange(ctx *Context) string {
+	limit := ctx.Risk.MaxEquityChangePct
+	prev := ctx.PreviousEquity
+	if limit <= 0 || prev <= 0 || ctx.Account.TotalEquity <= 0 {
+		return ""
+	}
+	changePct := (ctx.Account.TotalEquity - prev) / prev * 100
+	if math.Abs(changePct) < limit {
+		return ""
+	}
+	return fmt.Sprintf("净值异常变化: %.2f → %.2f（%+.2f%%，阈值±%.0f%%），可能发生强平或数据错误", prev, ctx.Account.TotalEquity, changePct, limit)
+}
+
+// LiquidityWindow 低流动性时段（UTC小时区间 [StartHour, EndHour)，StartHour>EndHour 表示跨午夜）
+type LiquidityWindow struct {
+	Weekdays  []time.Weekday // 生效的星期（空表示每天）
+	StartHour int            // 开始小时（0-23）
+	EndHour   int            // 结束小时（0-24）
+}
+
+// Contains 判断时间是否落在该时段内（按UTC计算）
+func (w LiquidityWindow) Contains(t time.Time) bool {
+	t = t.UTC()
+	if len(w.Weekdays) > 0 {
+		matched := false
+		for _, day := range w.Weekdays {
+			if t.Weekday() == day {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	hour := t.Hour()
+	if w.StartHour <= w.EndHour {
+		return hour >= w.StartHour && hour < w.EndHour
+	}
+	return hour >= w.StartHour || hour < w.EndHour
+}
+
+// String 返回时段的可读描述（如"周六/周日 00:00-24:00 UTC"）
+func (w LiquidityWindow) String() string {
+	names := []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+	days := "每天"
+	if len(w.Weekdays) > 0 {
+		parts := make([]string, 0, len(w.Weekdays))
+		for _, day := range w.Weekdays {
+			parts = append(parts, names[day%7])
+		}
+		days = strings.Join(parts, "/")
+	}
+	return fmt.Sprintf("%s %02d:00-%02d:00 UTC", days, w.StartHour, w.EndHour)
+}
+
+// defaultLowLiquiditySizeFactor 低流动性时段单币种仓位上限的默认缩放比例
+const defaultLowLiquiditySizeFactor = 0.5
+
+// lowLiquiditySizeFactor 返回低流动性时段的仓位上限缩放比例
+func (c RiskConfig) lowLiquiditySizeFactor() float64 {
+	if c.LowLiquiditySizeFactor <= 0 {
+		return defaultLowLiquiditySizeFactor
+	}
+	return c.LowLiquiditySizeFactor
+}
+
+// activeLiquidityWindow 返回当前生效的低流动性时段
+func activeLiquidityWindow(ctx *Context, now time.Time) (LiquidityWindow, bool) {
+	for _, w := range ctx.LowLiquidityWindows {
+		if w.Contains(now) {
+			return w, true
+		}
+	}
+	return LiquidityWindow{}, false
+}
+
+// lowLiquidityRules 描述低流动性时段收紧后的开仓要求（渲染到prompt中）
+func lowLiquidityRules(cfg RiskConfig) string {
+	rules := fmt.Sprintf("单币种仓位上限降为常规的%.0f%%", cfg.lowLiquiditySizeFactor()*100)
+	if cfg.LowLiquidityMinChecklist > 0 {
+		rules += fmt.Sprintf("，开仓需至少通过%d项检查（checklist_passed）", cfg.LowLiquidityMinChecklist)
+	}
+	return rules
+}
+
+// validateLowLiquidity 低流动性时段内收紧开仓要求（不直接禁止开仓）：提高检查项通过数要求、缩小单币种仓位上限
+func validateLowLiquidity(d *Decision, ctx *Context, now time.Time) error {
+	if !increasesExposure(d.Action) {
+		return nil
+	}
+	w, ok := activeLiquidityWindow(ctx, now)
+	if !ok {
+		return nil
+	}
+
+	if required := ctx.Risk.LowLiquidityMinChecklist; required > 0 && d.ChecklistPassed < required {
+		return fmt.Errorf("低流动性时段（%s）开仓需至少通过%d项检查，实际: %d", w, required, d.ChecklistPassed)
+	}
+	factor := ctx.Risk.lowLiquiditySizeFactor()
+	if limit := maxPositionValueFor(d.Symbol, ctx) * factor; d.PositionSizeUSD > limit*1.01 {
+		return fmt.Errorf("低流动性时段（%s）单币种仓位价值不能超过%.0f USDT（常规上限的%.0f%%），实际: %.0f",
+			w, limit, factor*100, d.PositionSizeUSD)
+	}
+	return nil
+}
+
+// formatWindow 将统计窗口格式化为提示词中的时长（如"12小时"、"90分钟"）
+func formatWindow(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%d小时", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d分钟", int(d.Minutes()))
+}
+
+// dailyLossHalted 判断当日已实现亏损是否触发日亏损熔断，返回原因
+// 只看已实现盈亏：持仓浮亏还可能回撤，由持有/平仓决策处理，不应阻止开仓
+func dailyLossHalted(ctx *Context) (bool, string) {
+	limit := ctx.Risk.MaxDailyLossPct
+	if limit <= 0 || ctx.Account.TotalEquity <= 0 || ctx.Account.RealizedPnL >= 0 {
+		return false, ""
+	}
+	lossPct := -ctx.Account.RealizedPnL / ctx.Account.TotalEquity * 100
+	if lossPct < limit {
+		return false, ""
+	}
+	return true, fmt.Sprintf("当日已实现亏损%.2f USDT（%.2f%%）达到日亏损上限%.2f%%", -ctx.Account.RealizedPnL, lossPct, limit)
+}
+
+// 熔断级别
+const (
+	BreakerLevelNone      = 0 // 未熔断
+	BreakerLevelNoNewRisk = 1 // 禁止开仓/加仓，只允许持仓管理和防御性操作（平仓、部分平仓、调整止损）
+)
+
+// BreakerContext 决策验证时的熔断状态，记录在每个决策上，便于审计引擎是否遵守了熔断
+type BreakerContext struct {
+	Level     int    `json:"level"`     // 熔断级别（BreakerLevel*）
+	Breaker   string `json:"breaker"`   // 触发的熔断（sharpe/daily_loss/equity_change）
+	Reason    string `json:"reason"`    // 触发原因
+	Permitted bool   `json:"permitted"` // 该决策在熔断下是否被允许
+}
+
+// activeBreaker 返回当前生效的熔断（按夏普比率冷却、日亏损上限、净值突变的顺序取第一个），未熔断时返回nil
+func activeBreaker(ctx *Context) *BreakerContext {
+	if halted, reason := sharpeHalted(ctx); halted {
+		return &BreakerContext{Level: BreakerLevelNoNewRisk, Breaker: "sharpe", Reason: reason}
+	}
+	if halted, reason := dailyLossHalted(ctx); halted {
+		return &BreakerContext{Level: BreakerLevelNoNewRisk, Breaker: "daily_loss", Reason: reason}
+	}
+	if ctx.Risk.EquityChangeDefensive {
+		if note := abnormalEquityChange(ctx); note != "" {
+			return &BreakerContext{Level: BreakerLevelNoNewRisk, Breaker: "equity_change", Reason: note}
+		}
+	}
+	return nil
+}
+
+// stampBreakerContext 在熔断期间为每个决策记录熔断级别和是否被允许（增加敞口的动作不被允许）
+func stampBreakerContext(decisions []Decision, ctx *Context) {
+	active := activeBreaker(ctx)
+	for i := range decisions {
+		if active == nil {
+			decisions[i].Breaker = nil
+			continue
+		}
+		b := *active
+		b.Permitted = !increasesExposure(decisions[i].Action)
+		decisions[i].Breaker = &b
+	}
+}
+
+// defaultHoldingWarnPct 时间止损提示的默认起始比例
+const defaultHoldingWarnPct = 80.0
+
+// timeStopUrgency 根据持仓时长返回时间止损紧迫标记（未到提示阈值时返回空）
+func timeStopUrgency(pos PositionInfo, cfg RiskConfig, now time.Time) string {
+	if cfg.MaxHoldingDuration <= 0 || pos.UpdateTime <= 0 {
+		return ""
+	}
+	held := now.Sub(time.UnixMilli(pos.UpdateTime))
+	if held < cfg.MinHoldBeforeEval {
+		return ""
+	}
+	warnPct := cfg.HoldingWarnPct
+	if warnPct <= 0 {
+		warnPct = defaultHoldingWarnPct
+	}
+
+	switch {
+	case held >= cfg.MaxHoldingDuration:
+		return fmt.Sprintf("⏰⏰ 已超过时间止损（持仓%.1f小时 ≥ 上限%.1f小时），优先考虑平仓",
+			held.Hours(), cfg.MaxHoldingDuration.Hours())
+	case float64(held) >= float64(cfg.MaxHoldingDuration)*warnPct/100:
+		return fmt.Sprintf("⏰ 接近时间止损（持仓%.1f小时 / 上限%.1f小时）",
+			held.Hours(), cfg.MaxHoldingDuration.Hours())
+	}
+	return ""
+}
+
+// fundingImminentWindow 资金费结算前的紧迫提示窗口
+const fundingImminentWindow = 30 * time.Minute
+
+// fundingUrgency 渲染距下次资金费结算的时间和费率；持仓方向需要支付资金费（多头遇正费率、空头遇负费率）
+// 且结算在 fundingImminentWindow 内时升级为紧迫提示并估算费用；无结算时间数据时返回空
+func fundingUrgency(pos PositionInfo, data *market.Data, now time.Time) string {
+	if data == nil || data.NextFundingTime <= 0 {
+		return ""
+	}
+	until := time.UnixMilli(data.NextFundingTime).Sub(now)
+	if until < 0 {
+		return ""
+	}
+	minutes := int(until.Minutes())
+	line := fmt.Sprintf("距下次资金费%d分钟 (费率%.4f%%)", minutes, data.FundingRate*100)
+
+	unfavorable := (pos.Side == "long" && data.FundingRate > 0) || (pos.Side == "short" && data.FundingRate < 0)
+	if !unfavorable || until > fundingImminentWindow {
+		return "💸 " + line
+	}
+	side := "多"
+	if pos.Side == "short" {
+		side = "空"
+	}
+	cost := math.Abs(data.FundingRate) * pos.Quantity * pos.MarkPrice
+	return fmt.Sprintf("💸💸 %s，%s仓需支付资金费约%.2f USDT，如无持有理由可考虑在结算前平仓", line, side, cost)
+}
+
+// inHoldGracePeriod 判断持仓是否仍在新仓位保护期内
+func inHoldGracePeriod(pos PositionInfo, cfg RiskConfig, now time.Time) bool {
+	if cfg.MinHoldBeforeEval <= 0 || pos.UpdateTime <= 0 {
+		return false
+	}
+	return now.Sub(time.UnixMilli(pos.UpdateTime)) < cfg.MinHoldBeforeEval
+}
+
+// StopRiskUSD 计算触发止损时的美元亏损（仓位价值 × 止损距离比例）
+func StopRiskUSD(positionSizeUSD, entryPrice, stopLoss float64) float64 {
+	if positionSizeUSD <= 0 || entryPrice <= 0 || stopLoss <= 0 {
+		return 0
+	}
+	return positionSizeUSD * math.Abs(entryPrice-stopLoss) / entryPrice
+}
+
+// WorstCaseLoss 估算本批开仓全部同时触发止损时的总亏损（USD），即各开仓 StopRiskUSD 之和
+// 入场价优先取限价单挂单价，其次 marketPrices 中的当前价格，都没有时按止损止盈估算
+func WorstCaseLoss(decisions []Decision, marketPrices map[string]float64) float64 {
+	total := 0.0
+	for i := range decisions {
+		d := &decisions[i]
+		if !isOpenAction(d.Action) {
+			continue
+		}
+		entry := marketPrices[d.Symbol]
+		if isLimitOrder(d) || entry <= 0 {
+			entry = assumedEntryPrice(d)
+		}
+		total += StopRiskUSD(d.PositionSizeUSD, entry, d.StopLoss)
+	}
+	return total
+}
+
+// WorstCaseLossPct 最坏情况亏损（见 WorstCaseLoss）占账户净值的百分比，净值未知（≤0）时返回0
+func WorstCaseLossPct(decisions []Decision, marketPrices map[string]float64, equity float64) float64 {
+	if equity <= 0 {
+		return 0
+	}
+	return WorstCaseLoss(decisions, marketPrices) / equity * 100
+}
+
+// positionStopRiskUSD 计算现有持仓从当前价格到止损价的美元风险（止损未知时返回0）
+func positionStopRiskUSD(pos PositionInfo) float64 {
+	price := pos.MarkPrice
+	if price <= 0 {
+		price = pos.EntryPrice
+	}
+	return StopRiskUSD(pos.Quantity*price, price, pos.StopLoss)
+}
+
+// decisionEntryPrice 获取开仓决策的参考入场价（限价单为挂单价，否则优先使用市场数据，再按止损止盈估算）
+func decisionEntryPrice(d *Decision, ctx *Context) float64 {
+	if isLimitOrder(d) {
+		return d.LimitPrice
+	}
+	if data, ok := ctx.MarketDataMap[d.Symbol]; ok && data != nil && data.CurrentPrice > 0 {
+		return data.CurrentPrice
+	}
+	return assumedEntryPrice(d)
+}
+
+// 组合层面的默认硬约束（与 System Prompt 中的硬约束保持一致）
+const (
+	defaultMaxPositions = 3    // 最多持仓币种数（Context.MaxPositions 未配置时）
+	maxMarginUsagePct   = 90.0 // 保证金总使用率上限（%）
+)
+
+// maxPositions 返回最多持仓币种数（未配置时使用默认值）
+func (ctx *Context) maxPositions() int {
+	if ctx.MaxPositions <= 0 {
+		return defaultMaxPositions
+	}
+	return ctx.MaxPositions
+}
+
+// validatePositionLimit 检查现有持仓（扣除本批平仓的）加上本批开仓是否超过最多持仓数，错误中列出超出上限的开仓决策
+func validatePositionLimit(decisions []Decision, ctx *Context) error {
+	limit := ctx.maxPositions()
+	closing := make(map[string]bool)
+	for _, d := range decisions {
+		if d.Action == "close_long" || d.Action == "close_short" {
+			closing[venueKey(d.Exchange, d.Symbol, ctx)+"_"+positionSide(d.Action)] = true
+		}
+	}
+
+	count := 0
+	for _, pos := range activePositions(ctx.Positions) {
+		if !closing[venueKey(pos.Exchange, pos.Symbol, ctx)+"_"+pos.Side] {
+			count++
+		}
+	}
+	existing := count
+
+	var over []string
+	var indices []int
+	for i, d := range decisions {
+		if !isOpenAction(d.Action) {
+			continue
+		}
+		count++
+		if count > limit {
+			over = append(over, fmt.Sprintf("#%d %s %s", i+1, d.Symbol, d.Action))
+			indices = append(indices, i)
+		}
+	}
+	if len(over) > 0 {
+		return &BatchError{Indices: indices, Err: fmt.Errorf("持仓数量超过上限: 保留持仓%d个 + 开仓%d个 > 最多%d个，超出上限的决策: %s",
+			existing, count-existing, limit, strings.Join(over, ", "))}
+	}
+	return nil
+}
+
+// newOpensBlocked 判断当前是否无法开新仓（已达持仓上限或保证金使用率达到上限），返回原因
+func newOpensBlocked(ctx *Context) string {
+	if count := len(activePositions(ctx.Positions)); count >= ctx.maxPositions() {
+		return fmt.Sprintf("已持仓%d个，达到持仓上限%d", count, ctx.maxPositions())
+	}
+	if ctx.Account.TotalEquity > 0 && ctx.Account.MarginUsedPct >= maxMarginUsagePct {
+		return fmt.Sprintf("保证金使用率%.1f%%达到上限%.0f%%", ctx.Account.MarginUsedPct, maxMarginUsagePct)
+	}
+	return ""
+}
+
+// PortfolioProjection 执行一批决策后的组合预估状态
+type PortfolioProjection struct {
+	PositionCount int      `json:"position_count"`  // 持仓数量
+	LongCount     int      `json:"long_count"`      // 多头持仓数量
+	ShortCount    int      `json:"short_count"`     // 空头持仓数量
+	TotalExposure float64  `json:"total_exposure"`  // 总持仓名义价值（USD）
+	TotalRiskUSD  float64  `json:"total_risk_usd"`  // 全部止损风险（USD，止损未知的持仓不计入）
+	MarginUsed    float64  `json:"margin_used"`     // 占用保证金（USD）
+	MarginUsedPct float64  `json:"margin_used_pct"` // 保证金使用率（%）
+	Breaches      []string `json:"breaches"`        // 超出的限制
+}
+
+// ProjectPortfolio 预估执行完整决策后的组合状态（敞口、风险、保证金、持仓数及超限项）
+func ProjectPortfolio(ctx *Context, fd *FullDecision) PortfolioProjection {
+	if fd == nil {
+		return projectPortfolio(ctx, nil)
+	}
+	return projectPortfolio(ctx, fd.Decisions)
+}
+
+// projectPortfolio 按决策列表推演持仓变化：平仓移除、部分平仓按比例缩减、开仓新增
+func projectPortfolio(ctx *Context, decisions []Decision) PortfolioProjection {
+	closing := make(map[string]bool)        // venueKey_side -> 平仓
+	reduceRatio := make(map[string]float64) // venueKey -> 部分平仓后保留比例
+	for _, d := range decisions {
+		key := venueKey(d.Exchange, d.Symbol, ctx)
+		switch d.Action {
+		case "close_long":
+			closing[key+"_long"] = true
+		case "close_short":
+			closing[key+"_short"] = true
+		case "partial_close":
+			if d.ClosePercentage > 0 && d.ClosePercentage <= 100 {
+				reduceRatio[key] = 1 - d.ClosePercentage/100
+			}
+		}
+	}
+
+	var p PortfolioProjection
+	for _, pos := range activePositions(ctx.Positions) {
+		key := venueKey(pos.Exchange, pos.Symbol, ctx)
+		if closing[key+"_"+pos.Side] {
+			continue
+		}
+		ratio := 1.0
+		if r, ok := reduceRatio[key]; ok {
+			ratio = r
+		}
+		price := pos.MarkPrice
+		if price <= 0 {
+			price = pos.EntryPrice
+		}
+		margin := pos.MarginUsed
+		if margin <= 0 && pos.Leverage > 0 {
+			margin = pos.Quantity * price / float64(pos.Leverage)
+		}
+
+		if ratio > 0 {
+			p.PositionCount++
+			p.addSide(pos.Side)
+		}
+		p.TotalExposure += pos.Quantity * price * ratio
+		p.TotalRiskUSD += positionStopRiskUSD(pos) * ratio
+		p.MarginUsed += margin * ratio
+	}
+
+	for i := range decisions {
+		d := &decisions[i]
+		if isAddAction(d.Action) {
+			// 补仓不增加持仓数量，只增加已有持仓的敞口、风险和保证金
+			if pos := findPosition(ctx, d.Symbol, positionSide(d.Action)); pos != nil {
+				p.TotalExposure += d.PositionSizeUSD
+				stop := d.StopLoss
+				if stop <= 0 {
+					stop = pos.StopLoss
+				}
+				p.TotalRiskUSD += StopRiskUSD(d.PositionSizeUSD, decisionEntryPrice(d, ctx), stop)
+				if pos.Leverage > 0 {
+					p.MarginUsed += d.PositionSizeUSD / float64(pos.Leverage)
+				}
+			}
+			continue
+		}
+		if !isOpenAction(d.Action) {
+			continue
+		}
+		p.PositionCount++
+		p.addSide(positionSide(d.Action))
+		p.TotalExposure += d.PositionSizeUSD
+		p.TotalRiskUSD += StopRiskUSD(d.PositionSizeUSD, decisionEntryPrice(d, ctx), d.StopLoss)
+		if d.Leverage > 0 {
+			p.MarginUsed += d.PositionSizeUSD / float64(d.Leverage)
+		}
+	}
+
+	equity := ctx.Account.TotalEquity
+	if equity > 0 {
+		p.MarginUsedPct = p.MarginUsed / equity * 100
+	}
+
+	// 超限项
+	if p.PositionCount > ctx.maxPositions() {
+		p.Breaches = append(p.Breaches, fmt.Sprintf("持仓数量%d超过上限%d", p.PositionCount, ctx.maxPositions()))
+	}
+	if limit := ctx.Risk.MaxSameSidePositions; limit > 0 && (p.LongCount > limit || p.ShortCount > limit) {
+		p.Breaches = append(p.Breaches, fmt.Sprintf("同方向持仓过多（多%d 空%d），单方向上限%d", p.LongCount, p.ShortCount, limit))
+	}
+	if p.MarginUsedPct > maxMarginUsagePct {
+		p.Breaches = append(p.Breaches, fmt.Sprintf("保证金使用率%.1f%%超过上限%.0f%%", p.MarginUsedPct, maxMarginUsagePct))
+	}
+	if ctx.Risk.MaxTotalRiskPct > 0 && equity > 0 {
+		if budget := equity * ctx.Risk.MaxTotalRiskPct / 100; p.TotalRiskUSD > budget {
+			p.Breaches = append(p.Breaches, fmt.Sprintf("总止损风险%.2f USDT超过预算%.2f USDT", p.TotalRiskUSD, budget))
+		}
+	}
+
+	return p
+}
+
+// addSide 按方向计数
+func (p *PortfolioProjection) addSide(side string) {
+	if side == "short" {
+		p.ShortCount++
+	} else {
+		p.LongCount++
+	}
+}
+
+// validateSideBalance 验证整批决策执行后同方向持仓数量不超过上限（鼓励多空平衡）
+// 已有持仓本身超过上限时（如调低了配置）只禁止继续增加该方向的持仓数，不影响持有、平仓等操作
+func validateSideBalance(decisions []Decision, ctx *Context) error {
+	limit := ctx.Risk.MaxSameSidePositions
+	if limit <= 0 {
+		return nil
+	}
+	current := projectPortfolio(ctx, nil)
+	p := projectPortfolio(ctx, decisions)
+	if allowed := max(current.LongCount, limit); p.LongCount > allowed {
+		return &BatchError{Indices: lastOpens(decisions, "long", p.LongCount-allowed),
+			Err: fmt.Errorf("同方向持仓过多: 执行后将有%d个多头持仓，单方向上限%d个", p.LongCount, limit)}
+	}
+	if allowed := max(current.ShortCount, limit); p.ShortCount > allowed {
+		return &BatchError{Indices: lastOpens(decisions, "short", p.ShortCount-allowed),
+			Err: fmt.Errorf("同方向持仓过多: 执行后将有%d个空头持仓，单方向上限%d个", p.ShortCount, limit)}
+	}
+	return nil
+}
+
+// lastOpens 返回批次中最后 n 个指定方向开仓决策的下标（按批次顺序），不足 n 个时返回全部
+func lastOpens(decisions []Decision, side string, n int) []int {
+	var indices []int
+	for i := len(decisions) - 1; i >= 0 && len(indices) < n; i-- {
+		if isOpenAction(decisions[i].Action) && positionSide(decisions[i].Action) == side {
+			indices = append([]int{i}, indices...)
+		}
+	}
+	return indices
+}
+
+// validateRiskBudget 验证整批决策执行后的总止损风险不超过预算
+func validateRiskBudget(decisions []Decision, ctx *Context) error {
+	if ctx.Risk.MaxTotalRiskPct <= 0 || ctx.Account.TotalEquity <= 0 {
+		return nil
+	}
+
+	totalRisk := projectPortfolio(ctx, decisions).TotalRiskUSD
+	budget := ctx.Account.TotalEquity * ctx.Risk.MaxTotalRiskPct / 100
+	// 已有持仓的风险本身超出预算时，只要本批次不再增加风险就放行（部分平仓、收紧止损、平仓等降低风险的操作）
+	allowed := max(projectPortfolio(ctx, nil).TotalRiskUSD, budget)
+	if totalRisk <= allowed {
+		return nil
+	}
+
+	// 从批次末尾起依次去掉开仓/补仓，直到剩余决策的总风险回到允许范围内，去掉的决策即超出预算的部分
+	var indices []int
+	remaining := decisions
+	for i := len(decisions) - 1; i >= 0; i-- {
+		if !isOpenAction(decisions[i].Action) && !isAddAction(decisions[i].Action) {
+			continue
+		}
+		remaining = append(remaining[:i:i], remaining[i+1:]...)
+		indices = append([]int{i}, indices...)
+		if projectPortfolio(ctx, remaining).TotalRiskUSD <= allowed {
+			break
+		}
+	}
+	return &BatchError{Indices: indices, Err: fmt.Errorf("总风险超出预算: 全部止损风险%.2f USDT > 预算%.2f USDT（净值的%.1f%%）",
+		totalRisk, budget, ctx.Risk.MaxTotalRiskPct)}
+}
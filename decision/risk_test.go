@@ -0,0 +1,541 @@
+package decision
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"nofx/market"
+)
+
+func TestSharpeHaltFromFirstCycle(t *testing.T) {
+	ctx := &Context{
+		CallCount:   0,
+		Performance: map[string]interface{}{"sharpe_ratio": -1.0},
+		Risk:        RiskConfig{SharpeHaltThreshold: -0.5, SharpeHaltCycles: 3},
+	}
+	updateSharpeHalt(ctx)
+	if ctx.SharpeHaltStartCycle == 0 {
+		t.Fatal("第0个周期触发的熔断应被记录")
+	}
+
+	// 夏普比率恢复后仍保持冷却期
+	ctx.Performance = map[string]interface{}{"sharpe_ratio": 0.5}
+	for cycle, wantHalted := range []bool{true, true, true, false} {
+		ctx.CallCount = cycle
+		updateSharpeHalt(ctx)
+		halted, reason := sharpeHalted(ctx)
+		if halted != wantHalted {
+			t.Errorf("周期#%d: halted = %v, want %v (%s)", cycle, halted, wantHalted, reason)
+		}
+		if halted && !strings.Contains(reason, "周期#0触发") {
+			t.Errorf("周期#%d: 原因应指明第0个周期触发: %s", cycle, reason)
+		}
+	}
+}
+
+func TestValidateRiskBudget(t *testing.T) {
+	// testOpens 两个开仓的止损风险各6 USDT，合计12 USDT（BTC持仓未设止损，不计入）
+	tests := []struct {
+		name    string
+		pct     float64
+		wantErr bool
+	}{
+		{"超出预算", 1, true},  // 预算10 USDT
+		{"预算之内", 2, false}, // 预算20 USDT
+		{"未配置", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			ctx.Risk.MaxTotalRiskPct = tt.pct
+			err := validateRiskBudget(testOpens(), ctx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRiskBudget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRiskBudgetAlreadyOverBudget(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MaxTotalRiskPct = 1      // 预算10 USDT
+	ctx.Positions[0].StopLoss = 95000 // BTC持仓风险 1010×6000/101000 = 60 USDT，已超出预算
+
+	newStop := 99000.0
+	reducing := [][]Decision{
+		{{Symbol: "BTCUSDT", Action: "partial_close", ClosePercentage: 30, Reasoning: "降低风险"}},
+		{{Symbol: "BTCUSDT", Action: "update_stop", NewStopLoss: &newStop, Reasoning: "收紧止损"}},
+		{{Symbol: "BTCUSDT", Action: "hold", Reasoning: "趋势未变"}},
+	}
+	for _, batch := range reducing {
+		if err := validateRiskBudget(batch, ctx); err != nil {
+			t.Errorf("不增加风险的 %s 应通过: %v", batch[0].Action, err)
+		}
+		if err := validateDecisions(batch, ctx); err != nil {
+			t.Errorf("超出预算时应允许 %s: %v", batch[0].Action, err)
+		}
+	}
+
+	err := validateRiskBudget([]Decision{reducing[2][0], testOpens()[0]}, ctx)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Indices) != 1 || batchErr.Indices[0] != 1 {
+		t.Errorf("继续增加风险的开仓应被拒绝: %v", err)
+	}
+}
+
+func TestProjectPortfolio(t *testing.T) {
+	ctx := testContext()
+	ctx.Positions = []PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long", Quantity: 0.01, MarkPrice: 100000, Leverage: 5, MarginUsed: 200, StopLoss: 95000},
+		{Symbol: "XRPUSDT", Side: "short", Quantity: 1000, MarkPrice: 0.5, Leverage: 5, MarginUsed: 100, StopLoss: 0.55},
+	}
+	decisions := append(testOpens(), Decision{Symbol: "XRPUSDT", Action: "close_short"})
+
+	// 手工计算：
+	//   BTC 保留: 敞口 0.01×100000=1000，风险 1000×5000/100000=50，保证金200
+	//   XRP 平仓: 不计入
+	//   ETH 开多: 敞口300，风险 300×60/3000=6，保证金 300/3=100
+	//   SOL 开空: 敞口300，风险 300×3/150=6，保证金 300/3=100
+	want := PortfolioProjection{
+		PositionCount: 3,
+		LongCount:     2,
+		ShortCount:    1,
+		TotalExposure: 1600,
+		TotalRiskUSD:  62,
+		MarginUsed:    400,
+		MarginUsedPct: 40,
+	}
+	got := ProjectPortfolio(ctx, &FullDecision{Decisions: decisions})
+	if got.PositionCount != want.PositionCount || got.LongCount != want.LongCount || got.ShortCount != want.ShortCount {
+		t.Errorf("持仓数量 = %d (多%d 空%d), want %d (多%d 空%d)",
+			got.PositionCount, got.LongCount, got.ShortCount, want.PositionCount, want.LongCount, want.ShortCount)
+	}
+	for _, f := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"TotalExposure", got.TotalExposure, want.TotalExposure},
+		{"TotalRiskUSD", got.TotalRiskUSD, want.TotalRiskUSD},
+		{"MarginUsed", got.MarginUsed, want.MarginUsed},
+		{"MarginUsedPct", got.MarginUsedPct, want.MarginUsedPct},
+	} {
+		if math.Abs(f.got-f.want) > 1e-9 {
+			t.Errorf("%s = %.4f, want %.4f", f.name, f.got, f.want)
+		}
+	}
+	if len(got.Breaches) != 0 {
+		t.Errorf("不应有超限项: %v", got.Breaches)
+	}
+
+	ctx.MaxPositions = 2
+	if got := ProjectPortfolio(ctx, &FullDecision{Decisions: decisions}); len(got.Breaches) != 1 {
+		t.Errorf("持仓上限2时应报告超限: %v", got.Breaches)
+	}
+}
+
+func TestMinAvailableBalanceFloor(t *testing.T) {
+	ctx := testContext() // 可用余额800
+	ctx.Risk.MinAvailableBalanceUSD = 900
+	if err := validateDecisions(testOpens(), ctx); err == nil {
+		t.Error("可用余额低于底线时应拒绝开仓")
+	}
+	closing := []Decision{{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "释放保证金"}}
+	if err := validateDecisions(closing, ctx); err != nil {
+		t.Errorf("可用余额低于底线时仍应允许平仓: %v", err)
+	}
+
+	ctx.Risk.MinAvailableBalanceUSD = 500
+	if err := validateDecisions(testOpens(), ctx); err != nil {
+		t.Errorf("可用余额高于底线时应允许开仓: %v", err)
+	}
+}
+
+func TestSharpeHaltRejectsOpens(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk = RiskConfig{SharpeHaltThreshold: -0.5, SharpeHaltCycles: 2}
+	ctx.Performance = map[string]interface{}{"sharpe_ratio": -0.8}
+	updateSharpeHalt(ctx)
+
+	if err := validateDecisions(testOpens(), ctx); err == nil || !strings.Contains(err.Error(), "夏普") {
+		t.Errorf("低夏普比率时开仓应被拒绝: %v", err)
+	}
+	closeBTC := []Decision{{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈"}}
+	if err := validateDecisions(closeBTC, ctx); err != nil {
+		t.Errorf("熔断期间应允许平仓: %v", err)
+	}
+
+	// 夏普比率恢复且冷却期结束后允许开仓
+	ctx.Performance = map[string]interface{}{"sharpe_ratio": 0.8}
+	ctx.CallCount += 2
+	updateSharpeHalt(ctx)
+	if err := validateDecisions(testOpens(), ctx); err != nil {
+		t.Errorf("冷却期结束后应允许开仓: %v", err)
+	}
+}
+
+func TestTimeStopUrgency(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := RiskConfig{MaxHoldingDuration: 10 * time.Hour}
+	for _, tt := range []struct {
+		held time.Duration
+		want string
+	}{
+		{7 * time.Hour, ""},
+		{8 * time.Hour, "⏰ 接近时间止损"},
+		{11 * time.Hour, "⏰⏰ 已超过时间止损"},
+	} {
+		pos := PositionInfo{Symbol: "BTCUSDT", UpdateTime: now.Add(-tt.held).UnixMilli()}
+		got := timeStopUrgency(pos, cfg, now)
+		if (tt.want == "") != (got == "") || !strings.HasPrefix(got, tt.want) {
+			t.Errorf("持仓%v: urgency = %q, want prefix %q", tt.held, got, tt.want)
+		}
+	}
+
+	pos := PositionInfo{Symbol: "BTCUSDT", UpdateTime: now.Add(-6 * time.Hour).UnixMilli()}
+	if got := timeStopUrgency(pos, RiskConfig{MaxHoldingDuration: 10 * time.Hour, HoldingWarnPct: 50}, now); !strings.HasPrefix(got, "⏰ 接近") {
+		t.Errorf("自定义50%%阈值时6小时应提示: %q", got)
+	}
+	if got := timeStopUrgency(pos, RiskConfig{}, now); got != "" {
+		t.Errorf("未配置持仓时长上限时不应提示: %q", got)
+	}
+}
+
+func TestUserPromptTimeStopUrgency(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MaxHoldingDuration = 10 * time.Hour
+	ctx.Positions[0].UpdateTime = time.Now().Add(-9 * time.Hour).UnixMilli()
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "⏰ 接近时间止损") {
+		t.Errorf("持仓块应包含时间止损提示:\n%s", prompt)
+	}
+
+	ctx.Positions[0].UpdateTime = time.Now().Add(-time.Hour).UnixMilli()
+	if prompt := buildUserPrompt(ctx); strings.Contains(prompt, "⏰") {
+		t.Errorf("未到提示阈值时不应标注:\n%s", prompt)
+	}
+}
+
+func TestValidateSideBalance(t *testing.T) {
+	solLong := Decision{Symbol: "SOLUSDT", Action: "open_long", Leverage: 3, PositionSizeUSD: 300, StopLoss: 147, TakeProfit: 165, Confidence: 80, Reasoning: "突破"}
+	closeBTC := Decision{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈"}
+
+	tests := []struct {
+		name      string
+		decisions []Decision
+		wantErr   bool
+	}{
+		{"持仓+开仓共3个多头", []Decision{testOpens()[0], solLong}, true},
+		{"多空平衡", testOpens(), false},
+		{"平仓后净2个多头", []Decision{closeBTC, testOpens()[0], solLong}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testContext()
+			ctx.Risk.MaxSameSidePositions = 2
+			err := validateSideBalance(tt.decisions, ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateSideBalance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) || len(batchErr.Indices) != 1 || batchErr.Indices[0] != 1 {
+				t.Errorf("应归因于最后一个多头开仓: %v", err)
+			}
+		})
+	}
+
+	if err := validateDecisions([]Decision{testOpens()[0], solLong}, testContext()); err != nil {
+		t.Errorf("未配置上限时不限制: %v", err)
+	}
+}
+
+func TestValidateSideBalanceAlreadyOverLimit(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MaxSameSidePositions = 1 // 调低配置前已有3个多头持仓，平掉一个后仍超过上限
+	ctx.Positions = append(ctx.Positions,
+		PositionInfo{Symbol: "XRPUSDT", Side: "long", Quantity: 1000, MarkPrice: 0.5, Leverage: 5, MarginUsed: 100},
+		PositionInfo{Symbol: "DOGEUSDT", Side: "long", Quantity: 2000, MarkPrice: 0.2, Leverage: 5, MarginUsed: 80})
+
+	closeBTC := Decision{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止盈"}
+	holdBTC := Decision{Symbol: "BTCUSDT", Action: "hold", Reasoning: "趋势未变"}
+	for _, batch := range [][]Decision{{closeBTC}, {holdBTC}, {{Action: "wait", Reasoning: "观望"}}} {
+		if err := validateSideBalance(batch, ctx); err != nil {
+			t.Errorf("不增加多头持仓的 %s 应通过: %v", batch[0].Action, err)
+		}
+	}
+	if err := validateDecisions([]Decision{closeBTC}, ctx); err != nil {
+		t.Errorf("超过上限时应允许平仓: %v", err)
+	}
+
+	err := validateSideBalance([]Decision{holdBTC, testOpens()[0]}, ctx)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Indices) != 1 || batchErr.Indices[0] != 1 {
+		t.Errorf("继续增加多头持仓应只拒绝该开仓: %v", err)
+	}
+}
+
+func TestHoldGracePeriod(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// 上限很短，保护期外的持仓都会被标注
+	cfg := RiskConfig{MaxHoldingDuration: 10 * time.Minute, MinHoldBeforeEval: 30 * time.Minute}
+
+	fresh := PositionInfo{Symbol: "BTCUSDT", UpdateTime: now.Add(-10 * time.Minute).UnixMilli()}
+	if !inHoldGracePeriod(fresh, cfg, now) {
+		t.Error("10分钟的持仓应在30分钟保护期内")
+	}
+	if got := timeStopUrgency(fresh, cfg, now); got != "" {
+		t.Errorf("保护期内不应提示时间止损: %q", got)
+	}
+
+	old := PositionInfo{Symbol: "BTCUSDT", UpdateTime: now.Add(-2 * time.Hour).UnixMilli()}
+	if inHoldGracePeriod(old, cfg, now) {
+		t.Error("2小时的持仓不在保护期内")
+	}
+	if got := timeStopUrgency(old, cfg, now); !strings.HasPrefix(got, "⏰⏰") {
+		t.Errorf("保护期外超过上限应提示: %q", got)
+	}
+}
+
+func TestDailyLossKeysOnRealized(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MaxDailyLossPct = 3
+	ctx.Account.RealizedPnL = -12.5
+	ctx.Account.UnrealizedPnL = 8.25
+
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "(当日已实现-12.50 / 未实现+8.25)") {
+		t.Errorf("应分别显示已实现和未实现盈亏:\n%s", prompt)
+	}
+
+	// 浮亏再大也不触发熔断
+	ctx.Account.RealizedPnL, ctx.Account.UnrealizedPnL = -10, -200
+	if err := validateDecisions(testOpens()[:1], ctx); err != nil {
+		t.Errorf("已实现亏损1%%、浮亏20%%时不应熔断: %v", err)
+	}
+
+	// 已实现亏损3%触发熔断，只允许平仓
+	ctx.Account.RealizedPnL, ctx.Account.UnrealizedPnL = -30, 50
+	if err := validateDecisions(testOpens()[:1], ctx); err == nil || !strings.Contains(err.Error(), "日亏损上限") {
+		t.Errorf("已实现亏损达到上限应禁止开仓: %v", err)
+	}
+	if err := validateDecisions([]Decision{{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止损"}}, ctx); err != nil {
+		t.Errorf("熔断期间应允许平仓: %v", err)
+	}
+}
+
+func TestAbnormalEquityChange(t *testing.T) {
+	ctx := testContext() // 净值1000
+	ctx.Risk.MaxEquityChangePct = 15
+	ctx.Risk.EquityChangeDefensive = true
+
+	ctx.PreviousEquity = 1050
+	if note := abnormalEquityChange(ctx); note != "" {
+		t.Errorf("正常波动不应标记: %s", note)
+	}
+	if err := validateDecisions(testOpens()[:1], ctx); err != nil {
+		t.Errorf("正常波动时允许开仓: %v", err)
+	}
+
+	ctx.PreviousEquity = 1250 // 下跌20%
+	note := abnormalEquityChange(ctx)
+	if !strings.Contains(note, "-20.00%") {
+		t.Fatalf("下跌20%%应标记: %q", note)
+	}
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "🚨 "+note) {
+		t.Error("prompt中应醒目提示净值突变")
+	}
+	found := false
+	for _, w := range contextWarnings(ctx) {
+		found = found || w == "🚨 "+note
+	}
+	if !found {
+		t.Error("应产生净值突变警告")
+	}
+	if err := validateDecisions(testOpens()[:1], ctx); err == nil || !strings.Contains(err.Error(), "净值异常变化") {
+		t.Errorf("防御模式下应禁止开仓: %v", err)
+	}
+	if err := validateDecisions([]Decision{{Symbol: "BTCUSDT", Action: "close_long", Reasoning: "止损"}}, ctx); err != nil {
+		t.Errorf("防御模式下应允许平仓: %v", err)
+	}
+}
+
+func TestValidateLowLiquidity(t *testing.T) {
+	saturday := time.Date(2026, 1, 3, 12, 0, 0, 0, time.UTC)
+	wednesday := time.Date(2026, 1, 7, 12, 0, 0, 0, time.UTC)
+
+	ctx := testContext()
+	ctx.LowLiquidityWindows = []LiquidityWindow{{Weekdays: []time.Weekday{time.Saturday, time.Sunday}, StartHour: 0, EndHour: 24}}
+	ctx.Risk.LowLiquidityMinChecklist = 4
+
+	sized := func(size float64, checklist int) *Decision {
+		d := testOpens()[1] // SOL（山寨币仓位上限1.5倍净值=1500，时段内减半为750）
+		d.PositionSizeUSD, d.ChecklistPassed = size, checklist
+		return &d
+	}
+	tests := []struct {
+		name    string
+		d       *Decision
+		now     time.Time
+		wantErr bool
+	}{
+		{"时段内满足收紧要求", sized(700, 4), saturday, false},
+		{"时段内检查项不足", sized(700, 3), saturday, true},
+		{"时段内仓位超过减半上限", sized(1000, 4), saturday, true},
+		{"时段外常规要求", sized(1000, 3), wednesday, false},
+	}
+	for _, tt := range tests {
+		if err := validateLowLiquidity(tt.d, ctx, tt.now); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	// 跨午夜时段
+	overnight := LiquidityWindow{StartHour: 22, EndHour: 2}
+	for hour, want := range map[int]bool{23: true, 1: true, 2: false, 12: false} {
+		if got := overnight.Contains(time.Date(2026, 1, 7, hour, 0, 0, 0, time.UTC)); got != want {
+			t.Errorf("%02d:00 Contains = %v, want %v", hour, got, want)
+		}
+	}
+
+	ctx.LowLiquidityWindows = []LiquidityWindow{{StartHour: 0, EndHour: 24}}
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "🌙 当前处于低流动性时段（每天 00:00-24:00 UTC）") {
+		t.Errorf("时段内应在prompt中提示:\n%s", prompt)
+	}
+}
+
+func TestRiskConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     RiskConfig
+		btcEth  int
+		altcoin int
+		want    []string
+	}{
+		{"有效配置", RiskConfig{DefaultLeverage: 3, AllowedLeverages: []int{1, 2, 3, 5}}, 5, 3, nil},
+		{"杠杆为0", RiskConfig{}, 0, 3, []string{"BTC/ETH杠杆倍数必须在1-125之间: 0"}},
+		{"杠杆为负且超限", RiskConfig{}, 200, -1, []string{"BTC/ETH杠杆倍数必须在1-125之间: 200", "山寨币杠杆倍数必须在1-125之间: -1"}},
+		{"无效档位", RiskConfig{AllowedLeverages: []int{0, 5}}, 5, 3, []string{"允许的杠杆档位必须大于0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate(tt.btcEth, tt.altcoin)
+			if (err != nil) != (len(tt.want) > 0) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.want)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("错误缺少 %q: %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerContextStamp(t *testing.T) {
+	ctx := testContext()
+	ctx.Risk.MaxDailyLossPct = 3
+	ctx.Account.RealizedPnL = -30 // 已实现亏损3%，触发1级熔断
+
+	decisions := []Decision{testOpens()[0], {Symbol: "BTCUSDT", Action: "close_long", Reasoning: "熔断中减仓"}}
+	err := validateDecisions(decisions, ctx)
+	if err == nil || !strings.Contains(err.Error(), "禁止开仓: ETHUSDT open_long") {
+		t.Fatalf("1级熔断期间开仓应被拒绝: %v", err)
+	}
+
+	open, closing := decisions[0].Breaker, decisions[1].Breaker
+	if open == nil || open.Level != BreakerLevelNoNewRisk || open.Breaker != "daily_loss" || open.Permitted {
+		t.Errorf("被拒绝的开仓应记录熔断级别且不被允许: %+v", open)
+	}
+	if closing == nil || closing.Level != BreakerLevelNoNewRisk || !closing.Permitted {
+		t.Errorf("熔断期间平仓应记录为允许: %+v", closing)
+	}
+
+	// 未熔断时清除之前的记录
+	ctx.Account.RealizedPnL = 0
+	if err := validateDecisions(decisions[:1], ctx); err != nil {
+		t.Fatalf("未熔断时应通过: %v", err)
+	}
+	if decisions[0].Breaker != nil {
+		t.Errorf("未熔断时不应记录熔断状态: %+v", decisions[0].Breaker)
+	}
+}
+
+func TestFundingUrgency(t *testing.T) {
+	now := time.Date(2026, 1, 1, 7, 40, 0, 0, time.UTC)
+	long := PositionInfo{Symbol: "BTCUSDT", Side: "long", Quantity: 0.01, MarkPrice: 101000}
+	short := PositionInfo{Symbol: "BTCUSDT", Side: "short", Quantity: 0.01, MarkPrice: 101000}
+	funding := func(until time.Duration, rate float64) *market.Data {
+		return &market.Data{Symbol: "BTCUSDT", FundingRate: rate, NextFundingTime: now.Add(until).UnixMilli()}
+	}
+
+	tests := []struct {
+		name string
+		pos  PositionInfo
+		data *market.Data
+		want string
+	}{
+		{"多头不利且即将结算", long, funding(20*time.Minute, 0.0001),
+			"💸💸 距下次资金费20分钟 (费率0.0100%)，多仓需支付资金费约0.10 USDT，如无持有理由可考虑在结算前平仓"},
+		{"多头不利但结算较远", long, funding(3*time.Hour, 0.0001), "💸 距下次资金费180分钟 (费率0.0100%)"},
+		{"空头收取资金费", short, funding(20*time.Minute, 0.0001), "💸 距下次资金费20分钟 (费率0.0100%)"},
+		{"空头遇负费率", short, funding(10*time.Minute, -0.0002), "💸💸 距下次资金费10分钟 (费率-0.0200%)，空仓需支付资金费约0.20 USDT，如无持有理由可考虑在结算前平仓"},
+		{"无结算时间", long, &market.Data{FundingRate: 0.0001}, ""},
+		{"结算时间已过", long, funding(-time.Minute, 0.0001), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fundingUrgency(tt.pos, tt.data, now); got != tt.want {
+				t.Errorf("fundingUrgency() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserPromptFundingUrgency(t *testing.T) {
+	ctx := testContext()
+	btc := ctx.MarketDataMap["BTCUSDT"]
+	btc.FundingRate = 0.0004
+	btc.NextFundingTime = time.Now().Add(15*time.Minute + 30*time.Second).UnixMilli()
+
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "💸💸 距下次资金费15分钟 (费率0.0400%)，多仓需支付资金费约0.40 USDT") {
+		t.Errorf("持仓块应包含资金费紧迫提示:\n%s", prompt)
+	}
+}
+
+func TestRiskConfigJSON(t *testing.T) {
+	var cfg RiskConfig
+	data := `{"max_total_risk_pct": 5, "max_daily_loss_pct": 3, "allowed_leverages": [1, 2, 5],
+		"max_holding_duration": "4h", "min_hold_before_eval": "30m"}`
+	if err := json.Unmarshal([]byte(data), &cfg); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if cfg.MaxTotalRiskPct != 5 || cfg.MaxDailyLossPct != 3 || len(cfg.AllowedLeverages) != 3 ||
+		cfg.MaxHoldingDuration != 4*time.Hour || cfg.MinHoldBeforeEval != 30*time.Minute {
+		t.Errorf("解析结果 = %+v", cfg)
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, want := range []string{`"max_total_risk_pct":5`, `"max_holding_duration":"4h0m0s"`, `"min_hold_before_eval":"30m0s"`} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("序列化结果应包含 %s: %s", want, out)
+		}
+	}
+	var back RiskConfig
+	if err := json.Unmarshal(out, &back); err != nil || back.MaxHoldingDuration != cfg.MaxHoldingDuration || back.MaxTotalRiskPct != 5 {
+		t.Errorf("往返后不一致: %+v, err = %v", back, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"max_holding_duration": 14400000000000}`), &cfg); err == nil {
+		t.Error("纳秒数形式的时长应报错")
+	}
+	if err := json.Unmarshal([]byte(`{"min_hold_before_eval": "半小时"}`), &cfg); err == nil || !strings.Contains(err.Error(), "min_hold_before_eval") {
+		t.Errorf("无效时长应报错并指出字段: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package decision
+
+import "math"
+
+// OI信号强度参数
+const (
+	oiSignalFullDeltaPct   = 20.0   // OI变化达到20%视为满强度
+	oiSignalUnwindFactor   = 0.5    // OI减少（平仓驱动）时的强度折扣
+	oiSignalCrowdedFunding = 0.0005 // 资金费率达到±0.05%视为同方向拥挤
+	oiSignalCrowdedFactor  = 0.5    // 拥挤时的强度折扣
+)
+
+// OISignalStrength 根据OI变化、价格变化和资金费率计算OI信号强度（-1看空 ~ +1看多）
+// 方向取价格变化方向（OI增+价涨=新多头入场，OI增+价跌=新空头入场）；
+// 强度取OI变化幅度，OI减少时为平仓驱动、信号减半；资金费率与信号同向且过高时说明拥挤，信号减半
+func OISignalStrength(oi *OITopData, fundingRate float64) float64 {
+	if oi == nil || oi.PriceDeltaPercent == 0 || oi.OIDeltaPercent == 0 {
+		return 0
+	}
+
+	dir := 1.0
+	if oi.PriceDeltaPercent < 0 {
+		dir = -1.0
+	}
+
+	strength := math.Min(math.Abs(oi.OIDeltaPercent)/oiSignalFullDeltaPct, 1)
+	if oi.OIDeltaPercent < 0 {
+		strength *= oiSignalUnwindFactor
+	}
+	if fundingRate*dir >= oiSignalCrowdedFunding {
+		strength *= oiSignalCrowdedFactor
+	}
+	return dir * strength
+}
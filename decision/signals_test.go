@@ -0,0 +1,43 @@
+package decision
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestOISignalStrength(t *testing.T) {
+	tests := []struct {
+		name    string
+		oi      *OITopData
+		funding float64
+		want    float64
+	}{
+		{"OI增+价涨", &OITopData{OIDeltaPercent: 10, PriceDeltaPercent: 2}, 0.0001, 0.5},
+		{"OI增+价跌，满强度", &OITopData{OIDeltaPercent: 30, PriceDeltaPercent: -1}, 0, -1},
+		{"OI减少（平仓驱动）", &OITopData{OIDeltaPercent: -10, PriceDeltaPercent: 1}, 0, 0.25},
+		{"多头拥挤", &OITopData{OIDeltaPercent: 20, PriceDeltaPercent: 1}, 0.0005, 0.5},
+		{"资金费率与方向相反", &OITopData{OIDeltaPercent: 20, PriceDeltaPercent: -1}, 0.0005, -1},
+		{"价格未变", &OITopData{OIDeltaPercent: 20}, 0, 0},
+		{"无OI数据", nil, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OISignalStrength(tt.oi, tt.funding); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("OISignalStrength() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserPromptOISignalStrength(t *testing.T) {
+	ctx := testContext()
+	ctx.OITopDataMap = map[string]*OITopData{
+		"SOLUSDT": {Rank: 3, OIDeltaPercent: 10, PriceDeltaPercent: 2},
+	}
+	storeMarketData(ctx, "SOLUSDT", ctx.MarketDataMap["SOLUSDT"])
+
+	if prompt := buildUserPrompt(ctx); !strings.Contains(prompt, "OI信号强度: +0.50") {
+		t.Errorf("候选币种应渲染OI信号强度:\n%s", prompt)
+	}
+}
@@ -0,0 +1,83 @@
+package decision
+
+// 止损/止盈建议参数
+const (
+	suggestedStopATRMultiple = 1.5 // 止损距离 = 1.5倍ATR
+)
+
+// suggestedLadderSteps 分批止盈相对目标RR的递增步长（第一目标=目标RR，之后每级多1R）
+var suggestedLadderSteps = []float64{0, 1, 2}
+
+// SuggestStops 根据ATR给出止损和满足目标风险回报比的分批止盈建议，可作为prompt中的参考基准
+// side 为 "long" 或 "short"；rrTarget<=0 时使用硬约束的最低风险回报比；数据无效时返回 0, nil
+func SuggestStops(side string, entry, atr float64, rrTarget float64) (stop float64, tps []float64) {
+	if entry <= 0 || atr <= 0 {
+		return 0, nil
+	}
+	if rrTarget <= 0 {
+		rrTarget = minRiskRewardRatio
+	}
+
+	dir := 1.0
+	if side == "short" {
+		dir = -1.0
+	}
+
+	risk := atr * suggestedStopATRMultiple
+	stop = entry - dir*risk
+	if stop <= 0 {
+		return 0, nil
+	}
+
+	tps = make([]float64, 0, len(suggestedLadderSteps))
+	for _, step := range suggestedLadderSteps {
+		tp := entry + dir*risk*(rrTarget+step)
+		if tp <= 0 {
+			break
+		}
+		tps = append(tps, tp)
+	}
+	return stop, tps
+}
+
+// TrailBand 移动止损档位：浮盈达到 ProfitPct 后，止损跟随当前价回撤 TrailPct（TrailPct=0 表示移到保本价）
+type TrailBand struct {
+	ProfitPct float64 // 触发该档位的浮盈百分比（相对入场价，不含杠杆）
+	TrailPct  float64 // 止损距当前价的回撤百分比（0=保本）
+}
+
+// DefaultTrailBands 默认移动止损档位：浮盈3%移到保本，浮盈5%起按5%回撤跟踪，浮盈10%起按3%回撤收紧
+var DefaultTrailBands = []TrailBand{
+	{ProfitPct: 3, TrailPct: 0},
+	{ProfitPct: 5, TrailPct: 5},
+	{ProfitPct: 10, TrailPct: 3},
+}
+
+// TrailingStop 按移动止损档位计算建议止损价，可用于校验或生成止损调整决策
+// 已触发的所有档位中取对持仓最有利的止损（做多取最高、做空取最低）；未触发任何档位或数据无效时返回0
+func TrailingStop(side string, entry, currentPrice float64, bands []TrailBand) float64 {
+	if entry <= 0 || currentPrice <= 0 {
+		return 0
+	}
+
+	dir := 1.0
+	if side == "short" {
+		dir = -1.0
+	}
+	profitPct := (currentPrice - entry) / entry * 100 * dir
+
+	stop := 0.0
+	for _, band := range bands {
+		if profitPct < band.ProfitPct {
+			continue
+		}
+		candidate := entry
+		if band.TrailPct > 0 {
+			candidate = currentPrice * (1 - dir*band.TrailPct/100)
+		}
+		if stop == 0 || (candidate-stop)*dir > 0 {
+			stop = candidate
+		}
+	}
+	return stop
+}
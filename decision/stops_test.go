@@ -0,0 +1,63 @@
+package decision
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSuggestStopsPassValidation(t *testing.T) {
+	ctx := testContext()
+	entry := ctx.MarketDataMap["ETHUSDT"].CurrentPrice
+	for _, side := range []string{"long", "short"} {
+		stop, tps := SuggestStops(side, entry, entry*0.01, 0)
+		if stop == 0 || len(tps) != len(suggestedLadderSteps) {
+			t.Fatalf("%s: SuggestStops 返回无效结构: %v %v", side, stop, tps)
+		}
+		d := &Decision{
+			Symbol:           "ETHUSDT",
+			Action:           "open_" + side,
+			Leverage:         3,
+			PositionSizeUSD:  300,
+			StopLoss:         stop,
+			TakeProfit:       tps[len(tps)-1],
+			TakeProfitLevels: tps,
+			Reasoning:        "按ATR设置止损",
+		}
+		if err := validateDecision(d, ctx); err != nil {
+			t.Errorf("%s: 建议的止损止盈应通过验证: %v (stop=%.2f tps=%v)", side, err, stop, tps)
+		}
+	}
+
+	if stop, tps := SuggestStops("long", 100, 0, 0); stop != 0 || tps != nil {
+		t.Errorf("ATR无效时应返回 0, nil: %v %v", stop, tps)
+	}
+}
+
+func TestTrailingStop(t *testing.T) {
+	tests := []struct {
+		side  string
+		price float64
+		want  float64
+	}{
+		{"long", 102.9, 0},   // 未达3%
+		{"long", 103, 100},   // 保本
+		{"long", 105, 100},   // 105×0.95=99.75低于保本，保持保本
+		{"long", 108, 102.6}, // 108×0.95
+		{"long", 110, 106.7}, // 110×0.97
+		{"short", 97.1, 0},   // 未达3%
+		{"short", 97, 100},   // 保本
+		{"short", 95, 99.75}, // 95×1.05
+		{"short", 90, 92.7},  // 90×1.03
+		{"short", 104, 0},    // 亏损
+	}
+	for _, tt := range tests {
+		got := TrailingStop(tt.side, 100, tt.price, DefaultTrailBands)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("TrailingStop(%s, 100, %v) = %v, want %v", tt.side, tt.price, got, tt.want)
+		}
+	}
+
+	if got := TrailingStop("long", 0, 110, DefaultTrailBands); got != 0 {
+		t.Errorf("入场价无效时应返回0, got %v", got)
+	}
+}
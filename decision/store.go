@@ -0,0 +1,59 @@
+package decision
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// DecisionStore 决策归档存储（文件、数据库、S3等由使用方实现，引擎不关心具体后端）
+type DecisionStore interface {
+	Save(ctx context.Context, fd *FullDecision) error
+}
+
+// NopDecisionStore 不做任何持久化的存储
+type NopDecisionStore struct{}
+
+// Save 丢弃决策
+func (NopDecisionStore) Save(ctx context.Context, fd *FullDecision) error {
+	return nil
+}
+
+// JSONLDecisionStore 将每个完整决策追加为JSONL文件中的一行
+type JSONLDecisionStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewJSONLDecisionStore 创建JSONL文件存储（文件不存在时自动创建）
+func NewJSONLDecisionStore(path string) *JSONLDecisionStore {
+	return &JSONLDecisionStore{path: path}
+}
+
+// Save 追加写入一行决策记录
+func (s *JSONLDecisionStore) Save(ctx context.Context, fd *FullDecision) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(fd)
+	if err != nil {
+		return fmt.Errorf("序列化决策失败: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开决策归档文件失败: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入决策归档文件失败: %w", err)
+	}
+	return nil
+}
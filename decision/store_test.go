@@ -0,0 +1,195 @@
+package decision
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"nofx/market"
+	"nofx/mcp"
+)
+
+// stubMarketData 测试用市场数据来源
+type stubMarketData map[string]*market.Data
+
+func (s stubMarketData) GetMarketData(symbol string) (*market.Data, error) {
+	if data, ok := s[symbol]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("没有%s的市场数据", symbol)
+}
+
+// countingMarketData 记录每个币种被获取的次数（并发安全）
+type countingMarketData struct {
+	stubMarketData
+	mu      sync.Mutex
+	fetched map[string]int
+}
+
+func (c *countingMarketData) GetMarketData(symbol string) (*market.Data, error) {
+	c.mu.Lock()
+	if c.fetched == nil {
+		c.fetched = make(map[string]int)
+	}
+	c.fetched[symbol]++
+	c.mu.Unlock()
+	return c.stubMarketData.GetMarketData(symbol)
+}
+
+// stubAIClient 返回一个依次回复 responses 的AI客户端（OpenAI响应格式，超出后重复最后一个）
+func stubAIClient(t *testing.T, responses ...string) *mcp.Client {
+	t.Helper()
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		i := calls
+		calls++
+		mu.Unlock()
+		if i >= len(responses) {
+			i = len(responses) - 1
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": responses[i]}},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	client := mcp.New()
+	client.SetCustomAPI(srv.URL, "test-key", "test-model")
+	return client
+}
+
+// aiResponse 构造"思维链 + JSON决策数组"格式的AI回复
+func aiResponse(t *testing.T, decisions []Decision) string {
+	t.Helper()
+	data, err := json.Marshal(decisions)
+	if err != nil {
+		t.Fatalf("序列化决策失败: %v", err)
+	}
+	return "分析完成，给出决策。\n\n" + string(data)
+}
+
+// stubContext 返回通过桩获取市场数据的上下文（数据与 testContext 相同）
+func stubContext() *Context {
+	ctx := testContext()
+	ctx.MarketData = stubMarketData(ctx.MarketDataMap)
+	ctx.MarketDataMap = nil
+	return ctx
+}
+
+// recordingStore 记录所有保存过的决策及保存时使用的context
+type recordingStore struct {
+	saved []*FullDecision
+	ctx   context.Context
+}
+
+func (s *recordingStore) Save(ctx context.Context, fd *FullDecision) error {
+	s.saved = append(s.saved, fd)
+	s.ctx = ctx
+	return nil
+}
+
+func TestDecisionStoreSavesAcceptedAndRejected(t *testing.T) {
+	accepted := testOpens()[:1]
+	rejected := testOpens()[:1]
+	rejected[0].Leverage = 20 // 超过山寨币杠杆上限5x
+
+	for _, tt := range []struct {
+		name      string
+		decisions []Decision
+		wantErr   bool
+	}{
+		{"通过验证", accepted, false},
+		{"验证失败", rejected, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordingStore{}
+			ctx := stubContext()
+			ctx.Store = store
+
+			fd, err := GetFullDecision(ctx, stubAIClient(t, aiResponse(t, tt.decisions)))
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("GetFullDecision() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrValidationFailed) {
+				t.Fatalf("应为验证失败: %v", err)
+			}
+			if len(store.saved) != 1 || store.saved[0] != fd {
+				t.Fatalf("决策应保存一次, saved = %d", len(store.saved))
+			}
+			if fd.UserPrompt == "" || fd.RawResponse == "" {
+				t.Error("归档的决策应包含prompt和原始响应")
+			}
+			if tt.wantErr != (fd.Error != "") {
+				t.Errorf("失败的周期应在归档中标记原因, Error = %q", fd.Error)
+			}
+		})
+	}
+}
+
+func TestDecisionStoreMarksExtractionFailure(t *testing.T) {
+	type ctxKey struct{}
+	reqCtx := context.WithValue(context.Background(), ctxKey{}, "cycle-1")
+	store := &recordingStore{}
+	ctx := stubContext()
+	ctx.Store = store
+
+	_, err := GetFullDecisionCtx(reqCtx, ctx, stubAIClient(t, "市场不明朗，没有给出JSON。"))
+	if err == nil {
+		t.Fatal("没有JSON决策时应返回错误")
+	}
+	if len(store.saved) != 1 || !strings.Contains(store.saved[0].Error, "提取决策失败") {
+		t.Fatalf("提取失败的周期应标记失败原因后归档: %+v", store.saved)
+	}
+	if store.ctx == nil || store.ctx.Value(ctxKey{}) != "cycle-1" {
+		t.Error("归档应使用请求的context，以便随请求取消")
+	}
+}
+
+func TestJSONLDecisionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	store := NewJSONLDecisionStore(path)
+
+	for _, d := range testOpens() {
+		if err := store.Save(context.Background(), &FullDecision{Decisions: []Decision{d}}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var symbols []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var fd FullDecision
+		if err := json.Unmarshal(scanner.Bytes(), &fd); err != nil {
+			t.Fatalf("第%d行不是有效的JSON: %v", len(symbols)+1, err)
+		}
+		symbols = append(symbols, fd.Decisions[0].Symbol)
+	}
+	if len(symbols) != 2 || symbols[0] != "ETHUSDT" || symbols[1] != "SOLUSDT" {
+		t.Errorf("应按保存顺序每行一个决策, got %v", symbols)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := store.Save(ctx, &FullDecision{}); err == nil {
+		t.Error("已取消的context应返回错误")
+	}
+}
@@ -0,0 +1,51 @@
+package decision
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Summarize 生成决策的一行摘要（各动作数量、开仓总价值和最坏情况亏损），用于日志和通知
+// ctx 提供当前价格和账户净值，为nil时按止损止盈估算入场价、不计算亏损占净值比例
+func (fd *FullDecision) Summarize(ctx *Context) string {
+	if fd == nil || len(fd.Decisions) == 0 {
+		return "无决策"
+	}
+
+	counts := make(map[string]int)
+	var order []string
+	openValue := 0.0
+	for _, d := range fd.Decisions {
+		if counts[d.Action] == 0 {
+			order = append(order, d.Action)
+		}
+		counts[d.Action]++
+		if isOpenAction(d.Action) {
+			openValue += d.PositionSizeUSD
+		}
+	}
+	parts := make([]string, 0, len(order))
+	for _, action := range order {
+		parts = append(parts, fmt.Sprintf("%s×%d", action, counts[action]))
+	}
+	summary := fmt.Sprintf("%d个决策 [%s]", len(fd.Decisions), strings.Join(parts, " "))
+	if openValue == 0 {
+		return summary
+	}
+
+	prices := make(map[string]float64)
+	equity := 0.0
+	if ctx != nil {
+		for symbol, data := range ctx.MarketDataMap {
+			if data != nil {
+				prices[symbol] = data.CurrentPrice
+			}
+		}
+		equity = ctx.Account.TotalEquity
+	}
+	summary += fmt.Sprintf(" | 开仓总价值%.2f USDT | 全部止损最坏亏损%.2f USDT", openValue, WorstCaseLoss(fd.Decisions, prices))
+	if equity > 0 {
+		summary += fmt.Sprintf("（净值的%.2f%%）", WorstCaseLossPct(fd.Decisions, prices, equity))
+	}
+	return summary
+}
@@ -0,0 +1,63 @@
+package decision
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"nofx/market"
+)
+
+// worstCaseBatch 多个开仓的批次，手工计算的最坏亏损：
+//
+//	AAA 做多 1000 USDT @100 止损95:  1000 × 5/100  = 50
+//	BBB 做空 500 USDT @200 止损220:  500 × 20/200  = 50
+//	CCC 限价做多 400 USDT @50 止损48: 400 × 2/50   = 16（入场价取挂单价，不取当前价）
+//	DDD 平仓不计入
+//
+// 合计 116 USDT，净值 1000 时为 11.6%
+func worstCaseBatch() []Decision {
+	return []Decision{
+		{Symbol: "AAAUSDT", Action: "open_long", PositionSizeUSD: 1000, StopLoss: 95, TakeProfit: 120},
+		{Symbol: "BBBUSDT", Action: "open_short", PositionSizeUSD: 500, StopLoss: 220, TakeProfit: 150},
+		{Symbol: "CCCUSDT", Action: "open_long", PositionSizeUSD: 400, StopLoss: 48, TakeProfit: 60, OrderType: "limit", LimitPrice: 50},
+		{Symbol: "DDDUSDT", Action: "close_long"},
+	}
+}
+
+var worstCasePrices = map[string]float64{"AAAUSDT": 100, "BBBUSDT": 200, "CCCUSDT": 52}
+
+func TestWorstCaseLoss(t *testing.T) {
+	if got := WorstCaseLoss(worstCaseBatch(), worstCasePrices); math.Abs(got-116) > 1e-9 {
+		t.Errorf("WorstCaseLoss = %.4f, want 116", got)
+	}
+	if got := WorstCaseLossPct(worstCaseBatch(), worstCasePrices, 1000); math.Abs(got-11.6) > 1e-9 {
+		t.Errorf("WorstCaseLossPct = %.4f, want 11.6", got)
+	}
+	if got := WorstCaseLossPct(worstCaseBatch(), worstCasePrices, 0); got != 0 {
+		t.Errorf("净值未知时应返回0, got %.4f", got)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	ctx := &Context{
+		Account:       AccountInfo{TotalEquity: 1000},
+		MarketDataMap: make(map[string]*market.Data),
+	}
+	for symbol, price := range worstCasePrices {
+		ctx.MarketDataMap[symbol] = &market.Data{Symbol: symbol, CurrentPrice: price}
+	}
+
+	got := (&FullDecision{Decisions: worstCaseBatch()}).Summarize(ctx)
+	want := "4个决策 [open_long×2 open_short×1 close_long×1] | 开仓总价值1900.00 USDT | 全部止损最坏亏损116.00 USDT（净值的11.60%）"
+	if got != want {
+		t.Errorf("Summarize =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := (&FullDecision{}).Summarize(ctx); got != "无决策" {
+		t.Errorf("空决策摘要 = %q", got)
+	}
+	if got := (&FullDecision{Decisions: []Decision{{Symbol: "AAAUSDT", Action: "hold"}}}).Summarize(nil); strings.Contains(got, "亏损") {
+		t.Errorf("没有开仓时不应计算亏损: %q", got)
+	}
+}
@@ -0,0 +1,38 @@
+package decision
+
+import "fmt"
+
+// SynthesizeFlatten 为所有持仓生成全部平仓决策（操作员一键清仓）
+func SynthesizeFlatten(positions []PositionInfo) []Decision {
+	decisions := make([]Decision, 0, len(positions))
+	for _, pos := range positions {
+		decisions = append(decisions, Decision{
+			Symbol:    pos.Symbol,
+			Action:    "close_" + pos.Side,
+			Reasoning: "操作员指令: 全部平仓",
+		})
+	}
+	return decisions
+}
+
+// SynthesizePartialClose 为所有持仓生成相同比例的部分平仓决策（温和降低风险）
+// pct 必须在 1-99 之间（否则返回错误），全部平仓请使用 SynthesizeFlatten
+func SynthesizePartialClose(positions []PositionInfo, pct int) ([]Decision, error) {
+	if pct < 1 || pct > 99 {
+		return nil, fmt.Errorf("部分平仓比例必须在1-99之间: %d（全部平仓请使用 SynthesizeFlatten）", pct)
+	}
+
+	decisions := make([]Decision, 0, len(positions))
+	for _, pos := range positions {
+		if pos.Quantity <= 0 {
+			continue
+		}
+		decisions = append(decisions, Decision{
+			Symbol:          pos.Symbol,
+			Action:          "partial_close",
+			ClosePercentage: float64(pct),
+			Reasoning:       fmt.Sprintf("操作员指令: 所有持仓减仓%d%%", pct),
+		})
+	}
+	return decisions, nil
+}
@@ -0,0 +1,36 @@
+package decision
+
+import "testing"
+
+func TestSynthesizePartialClose(t *testing.T) {
+	positions := []PositionInfo{
+		{Symbol: "BTCUSDT", Side: "long", Quantity: 0.01},
+		{Symbol: "ETHUSDT", Side: "short", Quantity: 0.5},
+		{Symbol: "SOLUSDT", Side: "long", Quantity: 0}, // 已平仓，跳过
+	}
+
+	decisions, err := SynthesizePartialClose(positions, 30)
+	if err != nil {
+		t.Fatalf("SynthesizePartialClose: %v", err)
+	}
+	if len(decisions) != 2 {
+		t.Fatalf("应为2个有效持仓生成决策, got %d", len(decisions))
+	}
+	for i, want := range []string{"BTCUSDT", "ETHUSDT"} {
+		d := decisions[i]
+		if d.Symbol != want || d.Action != "partial_close" || d.ClosePercentage != 30 || d.Reasoning == "" {
+			t.Errorf("决策 #%d = %+v", i+1, d)
+		}
+	}
+
+	for _, pct := range []int{0, 100} {
+		if got, err := SynthesizePartialClose(positions, pct); err == nil || got != nil {
+			t.Errorf("比例%d应返回错误, got %+v, err = %v", pct, got, err)
+		}
+	}
+
+	// 没有持仓时不是错误，只是没有决策
+	if got, err := SynthesizePartialClose(nil, 30); err != nil || len(got) != 0 {
+		t.Errorf("没有持仓时应返回空决策且无错误, got %+v, err = %v", got, err)
+	}
+}
@@ -315,6 +315,11 @@ type SymbolPerformance struct {
 
 // AnalyzePerformance 分析最近N个周期的交易表现
 func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAnalysis, error) {
+	return l.AnalyzePerformanceWindow(lookbackCycles, 0)
+}
+
+// AnalyzePerformanceWindow 分析最近N个周期的交易表现，夏普比率只使用最新记录之前 sharpeWindow 内的记录（0=使用全部N个周期）
+func (l *DecisionLogger) AnalyzePerformanceWindow(lookbackCycles int, sharpeWindow time.Duration) (*PerformanceAnalysis, error) {
 	records, err := l.GetLatestRecords(lookbackCycles)
 	if err != nil {
 		return nil, fmt.Errorf("读取历史记录失败: %w", err)
@@ -538,11 +543,25 @@ func (l *DecisionLogger) AnalyzePerformance(lookbackCycles int) (*PerformanceAna
 	}
 
 	// 计算夏普比率（需要至少2个数据点）
-	analysis.SharpeRatio = l.calculateSharpeRatio(records)
+	analysis.SharpeRatio = l.calculateSharpeRatio(recordsWithin(records, sharpeWindow))
 
 	return analysis, nil
 }
 
+// recordsWithin 返回最新记录之前 window 时间内的记录（records 按时间从旧到新排列，window≤0 时原样返回）
+func recordsWithin(records []*DecisionRecord, window time.Duration) []*DecisionRecord {
+	if window <= 0 || len(records) == 0 {
+		return records
+	}
+	cutoff := records[len(records)-1].Timestamp.Add(-window)
+	for i, record := range records {
+		if !record.Timestamp.Before(cutoff) {
+			return records[i:]
+		}
+	}
+	return nil
+}
+
 // calculateSharpeRatio 计算夏普比率
 // 基于账户净值的变化计算风险调整后收益
 func (l *DecisionLogger) calculateSharpeRatio(records []*DecisionRecord) float64 {
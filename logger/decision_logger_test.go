@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+// hourlyRecords 构造按小时排列的记录（从旧到新），净值依次取 equities
+func hourlyRecords(start time.Time, equities []float64) []*DecisionRecord {
+	records := make([]*DecisionRecord, len(equities))
+	for i, equity := range equities {
+		records[i] = &DecisionRecord{
+			Timestamp:    start.Add(time.Duration(i) * time.Hour),
+			AccountState: AccountSnapshot{TotalBalance: equity},
+		}
+	}
+	return records
+}
+
+func TestRecordsWithinSharpeWindow(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 前12小时大幅亏损，后13个点稳步上涨
+	equities := []float64{1000, 950, 900, 850, 800, 780, 760, 740, 720, 700, 690, 680}
+	for i := 0; i < 13; i++ {
+		equities = append(equities, 680+float64(i)*5+float64(i%2))
+	}
+	records := hourlyRecords(start, equities)
+
+	within := recordsWithin(records, 12*time.Hour)
+	if len(within) != 13 {
+		t.Fatalf("12小时窗口应包含13条记录（含边界），got %d", len(within))
+	}
+	if !within[0].Timestamp.Equal(records[len(records)-1].Timestamp.Add(-12 * time.Hour)) {
+		t.Errorf("窗口起点错误: %v", within[0].Timestamp)
+	}
+
+	l := &DecisionLogger{}
+	windowed := l.calculateSharpeRatio(within)
+	full := l.calculateSharpeRatio(records)
+	if windowed <= 0 {
+		t.Errorf("12小时窗口内净值上涨，夏普比率应为正，got %.4f", windowed)
+	}
+	if full >= windowed {
+		t.Errorf("包含前期亏损的全量夏普比率 (%.4f) 应低于窗口内的 (%.4f)", full, windowed)
+	}
+
+	if got := recordsWithin(records, 0); len(got) != len(records) {
+		t.Errorf("窗口为0时应返回全部记录，got %d", len(got))
+	}
+}
@@ -25,19 +25,22 @@ type LeverageConfig struct {
 
 // ConfigFile 配置文件结构，只包含需要同步到数据库的字段
 type ConfigFile struct {
-	AdminMode          bool           `json:"admin_mode"`
-	BetaMode           bool           `json:"beta_mode"`
-	APIServerPort      int            `json:"api_server_port"`
-	UseDefaultCoins    bool           `json:"use_default_coins"`
-	DefaultCoins       []string       `json:"default_coins"`
-	CoinPoolAPIURL     string         `json:"coin_pool_api_url"`
-	OITopAPIURL        string         `json:"oi_top_api_url"`
-	MaxDailyLoss       float64        `json:"max_daily_loss"`
-	MaxDrawdown        float64        `json:"max_drawdown"`
-	StopTradingMinutes int            `json:"stop_trading_minutes"`
-	Leverage           LeverageConfig `json:"leverage"`
-	JWTSecret          string         `json:"jwt_secret"`
-	DataKLineTime      string         `json:"data_k_line_time"`
+	AdminMode           bool            `json:"admin_mode"`
+	BetaMode            bool            `json:"beta_mode"`
+	APIServerPort       int             `json:"api_server_port"`
+	UseDefaultCoins     bool            `json:"use_default_coins"`
+	DefaultCoins        []string        `json:"default_coins"`
+	CoinPoolAPIURL      string          `json:"coin_pool_api_url"`
+	OITopAPIURL         string          `json:"oi_top_api_url"`
+	MaxDailyLoss        float64         `json:"max_daily_loss"`
+	MaxDrawdown         float64         `json:"max_drawdown"`
+	StopTradingMinutes  int             `json:"stop_trading_minutes"`
+	Leverage            LeverageConfig  `json:"leverage"`
+	JWTSecret           string          `json:"jwt_secret"`
+	DataKLineTime       string          `json:"data_k_line_time"`
+	MaxPositions        int             `json:"max_positions"`         // 最多持仓币种数（0=默认3个）
+	SharpeWindowMinutes int             `json:"sharpe_window_minutes"` // 夏普比率的滚动统计窗口（分钟，0=使用最近100个周期全部记录）
+	DecisionRisk        json.RawMessage `json:"decision_risk"`         // 决策层风控配置（decision.RiskConfig，snake_case 字段名，时长使用 "4h"、"30m" 格式）
 }
 
 // syncConfigToDatabase 从config.json读取配置并同步到数据库
@@ -91,6 +94,17 @@ func syncConfigToDatabase(database *config.Database) error {
 		configs["altcoin_leverage"] = strconv.Itoa(configFile.Leverage.AltcoinLeverage)
 	}
 
+	// 同步决策层配置
+	if configFile.MaxPositions > 0 {
+		configs["max_positions"] = strconv.Itoa(configFile.MaxPositions)
+	}
+	if configFile.SharpeWindowMinutes > 0 {
+		configs["sharpe_window_minutes"] = strconv.Itoa(configFile.SharpeWindowMinutes)
+	}
+	if len(configFile.DecisionRisk) > 0 {
+		configs["decision_risk"] = string(configFile.DecisionRisk)
+	}
+
 	// 如果JWT密钥不为空，也同步
 	if configFile.JWTSecret != "" {
 		configs["jwt_secret"] = configFile.JWTSecret
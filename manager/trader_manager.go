@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"nofx/config"
+	"nofx/decision"
 	"nofx/trader"
 	"sort"
 	"strconv"
@@ -96,6 +97,9 @@ func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) erro
 		}
 	}
 
+	// 决策层配置（持仓上限、夏普窗口、风控）
+	settings := loadDecisionSettings(database)
+
 	// 为每个交易员获取AI模型和交易所配置
 	for _, traderCfg := range allTraders {
 		// 获取AI模型配置（使用交易员所属的用户ID）
@@ -170,7 +174,7 @@ func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) erro
 		}
 
 		// 添加到TraderManager
-		err = tm.addTraderFromDB(traderCfg, aiModelCfg, exchangeCfg, coinPoolURL, oiTopURL, maxDailyLoss, maxDrawdown, stopTradingMinutes, defaultCoins)
+		err = tm.addTraderFromDB(traderCfg, aiModelCfg, exchangeCfg, coinPoolURL, oiTopURL, maxDailyLoss, maxDrawdown, stopTradingMinutes, defaultCoins, settings)
 		if err != nil {
 			log.Printf("❌ 添加交易员 %s 失败: %v", traderCfg.Name, err)
 			continue
@@ -182,7 +186,7 @@ func (tm *TraderManager) LoadTradersFromDatabase(database *config.Database) erro
 }
 
 // addTraderFromConfig 内部方法：从配置添加交易员（不加锁，因为调用方已加锁）
-func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string) error {
+func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, settings DecisionSettings) error {
 	if _, exists := tm.traders[traderCfg.ID]; exists {
 		return fmt.Errorf("trader ID '%s' 已存在", traderCfg.ID)
 	}
@@ -238,6 +242,9 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		IsCrossMargin:         traderCfg.IsCrossMargin,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
+		MaxPositions:          settings.MaxPositions,
+		SharpeWindow:          settings.SharpeWindow,
+		Risk:                  settings.Risk,
 		SystemPromptTemplate:  traderCfg.SystemPromptTemplate, // 系统提示词模板
 	}
 
@@ -286,7 +293,7 @@ func (tm *TraderManager) addTraderFromDB(traderCfg *config.TraderRecord, aiModel
 // AddTrader 从数据库配置添加trader (移除旧版兼容性)
 
 // AddTraderFromDB 从数据库配置添加trader
-func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string) error {
+func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, settings DecisionSettings) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -345,6 +352,9 @@ func (tm *TraderManager) AddTraderFromDB(traderCfg *config.TraderRecord, aiModel
 		IsCrossMargin:         traderCfg.IsCrossMargin,
 		DefaultCoins:          defaultCoins,
 		TradingCoins:          tradingCoins,
+		MaxPositions:          settings.MaxPositions,
+		SharpeWindow:          settings.SharpeWindow,
+		Risk:                  settings.Risk,
 	}
 
 	// 根据交易所类型设置API密钥
@@ -762,6 +772,9 @@ func (tm *TraderManager) LoadUserTraders(database *config.Database, userID strin
 		}
 	}
 
+	// 决策层配置（持仓上限、夏普窗口、风控）
+	settings := loadDecisionSettings(database)
+
 	// 为每个交易员获取AI模型和交易所配置
 	for _, traderCfg := range traders {
 		// 检查是否已经加载过这个交易员
@@ -832,7 +845,7 @@ func (tm *TraderManager) LoadUserTraders(database *config.Database, userID strin
 		}
 
 		// 使用现有的方法加载交易员
-		err = tm.loadSingleTrader(traderCfg, aiModelCfg, exchangeCfg, coinPoolURL, oiTopURL, maxDailyLoss, maxDrawdown, stopTradingMinutes, defaultCoins)
+		err = tm.loadSingleTrader(traderCfg, aiModelCfg, exchangeCfg, coinPoolURL, oiTopURL, maxDailyLoss, maxDrawdown, stopTradingMinutes, defaultCoins, settings)
 		if err != nil {
 			log.Printf("⚠️ 加载交易员 %s 失败: %v", traderCfg.Name, err)
 		}
@@ -842,7 +855,7 @@ func (tm *TraderManager) LoadUserTraders(database *config.Database, userID strin
 }
 
 // loadSingleTrader 加载单个交易员（从现有代码提取的公共逻辑）
-func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string) error {
+func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiModelCfg *config.AIModelConfig, exchangeCfg *config.ExchangeConfig, coinPoolURL, oiTopURL string, maxDailyLoss, maxDrawdown float64, stopTradingMinutes int, defaultCoins []string, settings DecisionSettings) error {
 	// 处理交易币种列表
 	var tradingCoins []string
 	if traderCfg.TradingSymbols != "" {
@@ -888,6 +901,9 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 		IsCrossMargin:        traderCfg.IsCrossMargin,
 		DefaultCoins:         defaultCoins,
 		TradingCoins:         tradingCoins,
+		MaxPositions:         settings.MaxPositions,
+		SharpeWindow:         settings.SharpeWindow,
+		Risk:                 settings.Risk,
 		SystemPromptTemplate: traderCfg.SystemPromptTemplate, // 系统提示词模板
 	}
 
@@ -932,3 +948,40 @@ func (tm *TraderManager) loadSingleTrader(traderCfg *config.TraderRecord, aiMode
 	log.Printf("✓ Trader '%s' (%s + %s) 已为用户加载到内存", traderCfg.Name, aiModelCfg.Provider, exchangeCfg.ID)
 	return nil
 }
+
+// DecisionSettings 决策层配置（从系统配置读取，所有交易员共用）
+type DecisionSettings struct {
+	MaxPositions int                 // 最多持仓币种数（0=默认3个）
+	SharpeWindow time.Duration       // 夏普比率的滚动统计窗口（0=使用最近100个周期全部记录）
+	Risk         decision.RiskConfig // 决策层风控配置（由 NewAutoTrader 验证）
+}
+
+// loadDecisionSettings 从系统配置读取决策层配置，未配置或无法解析时使用零值（即决策层默认值）
+func loadDecisionSettings(database *config.Database) DecisionSettings {
+	var settings DecisionSettings
+
+	if str, _ := database.GetSystemConfig("max_positions"); str != "" {
+		if val, err := strconv.Atoi(str); err == nil && val >= 0 {
+			settings.MaxPositions = val
+		} else {
+			log.Printf("⚠️ 解析持仓上限配置失败: %q，使用默认值", str)
+		}
+	}
+
+	if str, _ := database.GetSystemConfig("sharpe_window_minutes"); str != "" {
+		if val, err := strconv.Atoi(str); err == nil && val >= 0 {
+			settings.SharpeWindow = time.Duration(val) * time.Minute
+		} else {
+			log.Printf("⚠️ 解析夏普比率窗口配置失败: %q，使用默认值", str)
+		}
+	}
+
+	if str, _ := database.GetSystemConfig("decision_risk"); str != "" {
+		if err := json.Unmarshal([]byte(str), &settings.Risk); err != nil {
+			log.Printf("⚠️ 解析决策风控配置失败: %v，使用默认值", err)
+			settings.Risk = decision.RiskConfig{}
+		}
+	}
+
+	return settings
+}
@@ -61,7 +61,16 @@ func Get(symbol string) (*Data, error) {
 	}
 
 	// 获取Funding Rate
-	fundingRate, _ := getFundingRate(symbol)
+	fundingRate, nextFundingTime, _ := getFundingRate(symbol)
+
+	// 获取最近几期资金费率（用于判断趋势，失败不影响整体）
+	fundingHistory, _ := getFundingRateHistory(symbol, fundingHistoryLimit)
+
+	// 最近24小时成交额
+	quoteVolume24h := 0.0
+	for i := len(klines4h) - 1; i >= 0 && i >= len(klines4h)-6; i-- {
+		quoteVolume24h += klines4h[i].QuoteVolume
+	}
 
 	// 计算日内系列数据
 	intradayData := calculateIntradaySeries(klines3m)
@@ -79,6 +88,9 @@ func Get(symbol string) (*Data, error) {
 		CurrentRSI7:       currentRSI7,
 		OpenInterest:      oiData,
 		FundingRate:       fundingRate,
+		FundingHistory:    fundingHistory,
+		NextFundingTime:   nextFundingTime,
+		QuoteVolume24h:    quoteVolume24h,
 		IntradaySeries:    intradayData,
 		LongerTermContext: longerTermData,
 	}, nil
@@ -322,19 +334,19 @@ func getOpenInterestData(symbol string) (*OIData, error) {
 	}, nil
 }
 
-// getFundingRate 获取资金费率
-func getFundingRate(symbol string) (float64, error) {
+// getFundingRate 获取资金费率及下次结算时间（毫秒时间戳）
+func getFundingRate(symbol string) (float64, int64, error) {
 	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/premiumIndex?symbol=%s", symbol)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	var result struct {
@@ -348,72 +360,207 @@ func getFundingRate(symbol string) (float64, error) {
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	rate, _ := strconv.ParseFloat(result.LastFundingRate, 64)
-	return rate, nil
+	return rate, result.NextFundingTime, nil
+}
+
+// fundingHistoryLimit 资金费率历史期数
+const fundingHistoryLimit = 3
+
+// getFundingRateHistory 获取最近limit期已结算的资金费率（旧 → 新）
+func getFundingRateHistory(symbol string, limit int) ([]float64, error) {
+	url := fmt.Sprintf("https://fapi.binance.com/fapi/v1/fundingRate?symbol=%s&limit=%d", symbol, limit)
+
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []struct {
+		Symbol      string `json:"symbol"`
+		FundingRate string `json:"fundingRate"`
+		FundingTime int64  `json:"fundingTime"`
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+
+	// 接口按时间升序返回
+	rates := make([]float64, 0, len(result))
+	for _, r := range result {
+		rate, err := strconv.ParseFloat(r.FundingRate, 64)
+		if err != nil {
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// FundingTrend 判断资金费率趋势（"rising" / "falling" / "flat"），数据不足返回空字符串
+func FundingTrend(history []float64) string {
+	if len(history) < 2 {
+		return ""
+	}
+	first, last := history[0], history[len(history)-1]
+	switch {
+	case last > first:
+		return "rising"
+	case last < first:
+		return "falling"
+	default:
+		return "flat"
+	}
 }
 
 // Format 格式化输出市场数据
 func Format(data *Data) string {
+	return formatSummary(FormatStruct(data), DepthStandard)
+}
+
+// FormatWithDepth 按指定详细程度格式化输出市场数据（用token换细节）
+func FormatWithDepth(data *Data, depth Depth) string {
+	return formatSummary(FormatStruct(data), depth)
+}
+
+// FormatStruct 返回 Format 所渲染指标的结构化视图（避免下游代码用正则解析文本）
+func FormatStruct(data *Data) MarketSummary {
+	s := MarketSummary{
+		Symbol:         data.Symbol,
+		CurrentPrice:   data.CurrentPrice,
+		CurrentEMA20:   data.CurrentEMA20,
+		CurrentMACD:    data.CurrentMACD,
+		CurrentRSI7:    data.CurrentRSI7,
+		PriceChange1h:  data.PriceChange1h,
+		PriceChange4h:  data.PriceChange4h,
+		FundingRate:    data.FundingRate,
+		FundingHistory: data.FundingHistory,
+		FundingTrend:   FundingTrend(data.FundingHistory),
+	}
+
+	if data.OpenInterest != nil {
+		s.HasOpenInterest = true
+		s.OILatest = data.OpenInterest.Latest
+		s.OIAverage = data.OpenInterest.Average
+	}
+
+	if data.IntradaySeries != nil {
+		s.HasIntraday = true
+		s.IntradayMidPrices = data.IntradaySeries.MidPrices
+		s.IntradayEMA20 = data.IntradaySeries.EMA20Values
+		s.IntradayMACD = data.IntradaySeries.MACDValues
+		s.IntradayRSI7 = data.IntradaySeries.RSI7Values
+		s.IntradayRSI14 = data.IntradaySeries.RSI14Values
+	}
+
+	if data.LongerTermContext != nil {
+		s.HasLongerTerm = true
+		s.LongerTermEMA20 = data.LongerTermContext.EMA20
+		s.LongerTermEMA50 = data.LongerTermContext.EMA50
+		s.LongerTermATR3 = data.LongerTermContext.ATR3
+		s.LongerTermATR14 = data.LongerTermContext.ATR14
+		s.CurrentVolume = data.LongerTermContext.CurrentVolume
+		s.AverageVolume = data.LongerTermContext.AverageVolume
+		s.LongerTermMACD = data.LongerTermContext.MACDValues
+		s.LongerTermRSI14 = data.LongerTermContext.RSI14Values
+	}
+
+	return s
+}
+
+// formatSummary 将结构化视图按详细程度渲染为给AI阅读的文本
+func formatSummary(s MarketSummary, depth Depth) string {
 	var sb strings.Builder
+	terse := depth == DepthTerse
 
 	sb.WriteString(fmt.Sprintf("current_price = %.2f, current_ema20 = %.3f, current_macd = %.3f, current_rsi (7 period) = %.3f\n\n",
-		data.CurrentPrice, data.CurrentEMA20, data.CurrentMACD, data.CurrentRSI7))
+		s.CurrentPrice, s.CurrentEMA20, s.CurrentMACD, s.CurrentRSI7))
+
+	if depth == DepthVerbose {
+		sb.WriteString(fmt.Sprintf("Price change: 1h %+.2f%%, 4h %+.2f%%\n\n", s.PriceChange1h, s.PriceChange4h))
+	}
+
+	if terse {
+		sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", s.FundingRate))
+		if s.HasIntraday {
+			sb.WriteString("Intraday series (3‑minute intervals, oldest → latest):\n\n")
+			if len(s.IntradayMidPrices) > 0 {
+				sb.WriteString(fmt.Sprintf("Mid prices: %s\n\n", formatFloatSlice(s.IntradayMidPrices)))
+			}
+			if len(s.IntradayRSI7) > 0 {
+				sb.WriteString(fmt.Sprintf("RSI indicators (7‑Period): %s\n\n", formatFloatSlice(s.IntradayRSI7)))
+			}
+		}
+		return sb.String()
+	}
 
 	sb.WriteString(fmt.Sprintf("In addition, here is the latest %s open interest and funding rate for perps:\n\n",
-		data.Symbol))
+		s.Symbol))
 
-	if data.OpenInterest != nil {
+	if s.HasOpenInterest {
 		sb.WriteString(fmt.Sprintf("Open Interest: Latest: %.2f Average: %.2f\n\n",
-			data.OpenInterest.Latest, data.OpenInterest.Average))
+			s.OILatest, s.OIAverage))
 	}
 
-	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", data.FundingRate))
+	sb.WriteString(fmt.Sprintf("Funding Rate: %.2e\n\n", s.FundingRate))
 
-	if data.IntradaySeries != nil {
+	if s.FundingTrend != "" {
+		sb.WriteString(fmt.Sprintf("Funding Rate History (oldest → latest): %s (%s)\n\n",
+			formatRateSlice(s.FundingHistory), s.FundingTrend))
+	}
+
+	if s.HasIntraday {
 		sb.WriteString("Intraday series (3‑minute intervals, oldest → latest):\n\n")
 
-		if len(data.IntradaySeries.MidPrices) > 0 {
-			sb.WriteString(fmt.Sprintf("Mid prices: %s\n\n", formatFloatSlice(data.IntradaySeries.MidPrices)))
+		if len(s.IntradayMidPrices) > 0 {
+			sb.WriteString(fmt.Sprintf("Mid prices: %s\n\n", formatFloatSlice(s.IntradayMidPrices)))
 		}
 
-		if len(data.IntradaySeries.EMA20Values) > 0 {
-			sb.WriteString(fmt.Sprintf("EMA indicators (20‑period): %s\n\n", formatFloatSlice(data.IntradaySeries.EMA20Values)))
+		if len(s.IntradayEMA20) > 0 {
+			sb.WriteString(fmt.Sprintf("EMA indicators (20‑period): %s\n\n", formatFloatSlice(s.IntradayEMA20)))
 		}
 
-		if len(data.IntradaySeries.MACDValues) > 0 {
-			sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", formatFloatSlice(data.IntradaySeries.MACDValues)))
+		if len(s.IntradayMACD) > 0 {
+			sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", formatFloatSlice(s.IntradayMACD)))
 		}
 
-		if len(data.IntradaySeries.RSI7Values) > 0 {
-			sb.WriteString(fmt.Sprintf("RSI indicators (7‑Period): %s\n\n", formatFloatSlice(data.IntradaySeries.RSI7Values)))
+		if len(s.IntradayRSI7) > 0 {
+			sb.WriteString(fmt.Sprintf("RSI indicators (7‑Period): %s\n\n", formatFloatSlice(s.IntradayRSI7)))
 		}
 
-		if len(data.IntradaySeries.RSI14Values) > 0 {
-			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", formatFloatSlice(data.IntradaySeries.RSI14Values)))
+		if len(s.IntradayRSI14) > 0 {
+			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", formatFloatSlice(s.IntradayRSI14)))
 		}
 	}
 
-	if data.LongerTermContext != nil {
+	if s.HasLongerTerm {
 		sb.WriteString("Longer‑term context (4‑hour timeframe):\n\n")
 
 		sb.WriteString(fmt.Sprintf("20‑Period EMA: %.3f vs. 50‑Period EMA: %.3f\n\n",
-			data.LongerTermContext.EMA20, data.LongerTermContext.EMA50))
+			s.LongerTermEMA20, s.LongerTermEMA50))
 
 		sb.WriteString(fmt.Sprintf("3‑Period ATR: %.3f vs. 14‑Period ATR: %.3f\n\n",
-			data.LongerTermContext.ATR3, data.LongerTermContext.ATR14))
+			s.LongerTermATR3, s.LongerTermATR14))
 
 		sb.WriteString(fmt.Sprintf("Current Volume: %.3f vs. Average Volume: %.3f\n\n",
-			data.LongerTermContext.CurrentVolume, data.LongerTermContext.AverageVolume))
+			s.CurrentVolume, s.AverageVolume))
 
-		if len(data.LongerTermContext.MACDValues) > 0 {
-			sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", formatFloatSlice(data.LongerTermContext.MACDValues)))
+		if len(s.LongerTermMACD) > 0 {
+			sb.WriteString(fmt.Sprintf("MACD indicators: %s\n\n", formatFloatSlice(s.LongerTermMACD)))
 		}
 
-		if len(data.LongerTermContext.RSI14Values) > 0 {
-			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", formatFloatSlice(data.LongerTermContext.RSI14Values)))
+		if len(s.LongerTermRSI14) > 0 {
+			sb.WriteString(fmt.Sprintf("RSI indicators (14‑Period): %s\n\n", formatFloatSlice(s.LongerTermRSI14)))
 		}
 	}
 
@@ -429,6 +576,15 @@ func formatFloatSlice(values []float64) string {
 	return "[" + strings.Join(strValues, ", ") + "]"
 }
 
+// formatRateSlice 格式化费率切片（科学计数法）
+func formatRateSlice(values []float64) string {
+	strValues := make([]string, len(values))
+	for i, v := range values {
+		strValues[i] = fmt.Sprintf("%.2e", v)
+	}
+	return "[" + strings.Join(strValues, ", ") + "]"
+}
+
 // Normalize 标准化symbol,确保是USDT交易对
 func Normalize(symbol string) string {
 	symbol = strings.ToUpper(symbol)
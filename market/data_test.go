@@ -0,0 +1,117 @@
+package market
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormatFundingTrend(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []float64
+		want    string
+	}{
+		{"上升", []float64{0.0001, 0.0002, 0.0003}, "Funding Rate History (oldest → latest): [1.00e-04, 2.00e-04, 3.00e-04] (rising)"},
+		{"下降", []float64{0.0003, 0.0001, -0.0001}, "Funding Rate History (oldest → latest): [3.00e-04, 1.00e-04, -1.00e-04] (falling)"},
+		{"持平", []float64{0.0001, 0.0002, 0.0001}, "(flat)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Format(&Data{Symbol: "BTCUSDT", FundingRate: tt.history[len(tt.history)-1], FundingHistory: tt.history})
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("Format() 缺少 %q:\n%s", tt.want, got)
+			}
+		})
+	}
+
+	if got := Format(&Data{Symbol: "BTCUSDT", FundingHistory: []float64{0.0001}}); strings.Contains(got, "Funding Rate History") {
+		t.Errorf("历史不足两期时不应渲染趋势:\n%s", got)
+	}
+}
+
+// sampleData 带全部指标的市场数据
+func sampleData() *Data {
+	return &Data{
+		Symbol:        "ETHUSDT",
+		CurrentPrice:  3012.5,
+		PriceChange1h: 0.8,
+		PriceChange4h: -2.1,
+		CurrentEMA20:  3001.234,
+		CurrentMACD:   4.567,
+		CurrentRSI7:   61.5,
+		OpenInterest:  &OIData{Latest: 123456.78, Average: 120000.5},
+		FundingRate:   0.0001,
+		IntradaySeries: &IntradayData{
+			MidPrices:   []float64{3000, 3012.5},
+			EMA20Values: []float64{2999, 3001.234},
+			MACDValues:  []float64{4.1, 4.567},
+			RSI7Values:  []float64{58, 61.5},
+			RSI14Values: []float64{55, 57},
+		},
+		LongerTermContext: &LongerTermData{
+			EMA20:         2950.5,
+			EMA50:         2900.25,
+			ATR3:          30.5,
+			ATR14:         45.75,
+			CurrentVolume: 1000,
+			AverageVolume: 900,
+			MACDValues:    []float64{10, 12},
+			RSI14Values:   []float64{52, 54},
+		},
+	}
+}
+
+func TestFormatStructMatchesProse(t *testing.T) {
+	data := sampleData()
+	s := FormatStruct(data)
+	prose := Format(data)
+
+	for _, want := range []string{
+		fmt.Sprintf("current_price = %.2f", s.CurrentPrice),
+		fmt.Sprintf("current_ema20 = %.3f", s.CurrentEMA20),
+		fmt.Sprintf("current_macd = %.3f", s.CurrentMACD),
+		fmt.Sprintf("current_rsi (7 period) = %.3f", s.CurrentRSI7),
+		fmt.Sprintf("Open Interest: Latest: %.2f Average: %.2f", s.OILatest, s.OIAverage),
+		fmt.Sprintf("Funding Rate: %.2e", s.FundingRate),
+		fmt.Sprintf("20‑Period EMA: %.3f vs. 50‑Period EMA: %.3f", s.LongerTermEMA20, s.LongerTermEMA50),
+		fmt.Sprintf("3‑Period ATR: %.3f vs. 14‑Period ATR: %.3f", s.LongerTermATR3, s.LongerTermATR14),
+		fmt.Sprintf("Current Volume: %.3f vs. Average Volume: %.3f", s.CurrentVolume, s.AverageVolume),
+	} {
+		if !strings.Contains(prose, want) {
+			t.Errorf("Format() 缺少结构化视图中的 %q", want)
+		}
+	}
+	if s.CurrentPrice != data.CurrentPrice || s.LongerTermATR14 != data.LongerTermContext.ATR14 || !s.HasIntraday || !s.HasLongerTerm || !s.HasOpenInterest {
+		t.Errorf("结构化视图与原始数据不一致: %+v", s)
+	}
+}
+
+func TestFormatWithDepth(t *testing.T) {
+	data := sampleData()
+	tests := []struct {
+		depth   Depth
+		present []string
+		absent  []string
+	}{
+		{DepthTerse, []string{"current_price", "Funding Rate", "Mid prices", "RSI indicators (7‑Period)"},
+			[]string{"Open Interest", "Longer‑term context", "EMA indicators", "Price change"}},
+		{DepthStandard, []string{"current_price", "Open Interest", "Longer‑term context", "EMA indicators"},
+			[]string{"Price change"}},
+		{DepthVerbose, []string{"current_price", "Open Interest", "Longer‑term context", "Price change: 1h +0.80%, 4h -2.10%"},
+			nil},
+	}
+	for _, tt := range tests {
+		got := FormatWithDepth(data, tt.depth)
+		for _, want := range tt.present {
+			if !strings.Contains(got, want) {
+				t.Errorf("depth %d 缺少 %q", tt.depth, want)
+			}
+		}
+		for _, unwanted := range tt.absent {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("depth %d 不应包含 %q", tt.depth, unwanted)
+			}
+		}
+	}
+}
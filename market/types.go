@@ -13,6 +13,9 @@ type Data struct {
 	CurrentRSI7       float64
 	OpenInterest      *OIData
 	FundingRate       float64
+	FundingHistory    []float64 // 最近几期已结算资金费率（旧 → 新）
+	NextFundingTime   int64     // 下次资金费结算时间（毫秒时间戳，0表示未知）
+	QuoteVolume24h    float64   // 最近24小时成交额（USDT，最近6根4小时K线合计）
 	IntradaySeries    *IntradayData
 	LongerTermContext *LongerTermData
 }
@@ -44,6 +47,52 @@ type LongerTermData struct {
 	RSI14Values   []float64
 }
 
+// Depth 市场数据渲染的详细程度
+type Depth int
+
+const (
+	DepthStandard Depth = iota // 标准：完整指标（默认）
+	DepthTerse                 // 精简：只保留当前快照、资金费率和日内价格/RSI7序列，去掉OI和4小时数据
+	DepthVerbose               // 详细：标准内容 + 1h/4h价格变化
+)
+
+// MarketSummary Format 渲染内容的结构化视图（字段与 Format 输出一一对应，供工具和程序读取）
+type MarketSummary struct {
+	Symbol       string  `json:"symbol"`
+	CurrentPrice float64 `json:"current_price"`
+	CurrentEMA20 float64 `json:"current_ema20"`
+	CurrentMACD  float64 `json:"current_macd"`
+	CurrentRSI7  float64 `json:"current_rsi7"`
+
+	PriceChange1h float64 `json:"price_change_1h"` // 1小时价格变化百分比（仅 DepthVerbose 渲染）
+	PriceChange4h float64 `json:"price_change_4h"` // 4小时价格变化百分比（仅 DepthVerbose 渲染）
+
+	HasOpenInterest bool    `json:"has_open_interest"`
+	OILatest        float64 `json:"oi_latest"`
+	OIAverage       float64 `json:"oi_average"`
+
+	FundingRate    float64   `json:"funding_rate"`
+	FundingHistory []float64 `json:"funding_history,omitempty"`
+	FundingTrend   string    `json:"funding_trend,omitempty"` // 空表示历史不足，不渲染
+
+	HasIntraday       bool      `json:"has_intraday"`
+	IntradayMidPrices []float64 `json:"intraday_mid_prices,omitempty"`
+	IntradayEMA20     []float64 `json:"intraday_ema20,omitempty"`
+	IntradayMACD      []float64 `json:"intraday_macd,omitempty"`
+	IntradayRSI7      []float64 `json:"intraday_rsi7,omitempty"`
+	IntradayRSI14     []float64 `json:"intraday_rsi14,omitempty"`
+
+	HasLongerTerm   bool      `json:"has_longer_term"`
+	LongerTermEMA20 float64   `json:"longer_term_ema20"`
+	LongerTermEMA50 float64   `json:"longer_term_ema50"`
+	LongerTermATR3  float64   `json:"longer_term_atr3"`
+	LongerTermATR14 float64   `json:"longer_term_atr14"`
+	CurrentVolume   float64   `json:"current_volume"`
+	AverageVolume   float64   `json:"average_volume"`
+	LongerTermMACD  []float64 `json:"longer_term_macd,omitempty"`
+	LongerTermRSI14 []float64 `json:"longer_term_rsi14,omitempty"`
+}
+
 // Binance API 响应结构
 type ExchangeInfo struct {
 	Symbols []SymbolInfo `json:"symbols"`
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -118,6 +119,11 @@ func (client *Client) SetClient(Client Client) {
 
 // CallWithMessages 使用 system + user prompt 调用AI API（推荐）
 func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string, error) {
+	return client.CallWithMessagesCtx(context.Background(), systemPrompt, userPrompt)
+}
+
+// CallWithMessagesCtx 同 CallWithMessages，ctx 取消或超时时中止请求和重试等待，返回 ctx.Err()
+func (client *Client) CallWithMessagesCtx(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
 	if client.APIKey == "" {
 		return "", fmt.Errorf("AI API密钥未设置，请先调用 SetDeepSeekAPIKey() 或 SetQwenAPIKey()")
 	}
@@ -131,7 +137,10 @@ func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string,
 			fmt.Printf("⚠️  AI API调用失败，正在重试 (%d/%d)...\n", attempt, maxRetries)
 		}
 
-		result, err := client.callOnce(systemPrompt, userPrompt)
+		result, err := client.callOnce(ctx, systemPrompt, userPrompt)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
 		if err == nil {
 			if attempt > 1 {
 				fmt.Printf("✓ AI API重试成功\n")
@@ -149,7 +158,11 @@ func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string,
 		if attempt < maxRetries {
 			waitTime := time.Duration(attempt) * 2 * time.Second
 			fmt.Printf("⏳ 等待%v后重试...\n", waitTime)
-			time.Sleep(waitTime)
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(waitTime):
+			}
 		}
 	}
 
@@ -157,7 +170,7 @@ func (client *Client) CallWithMessages(systemPrompt, userPrompt string) (string,
 }
 
 // callOnce 单次调用AI API（内部使用）
-func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error) {
+func (client *Client) callOnce(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
 	// 打印当前 AI 配置
 	log.Printf("📡 [MCP] AI 请求配置:")
 	log.Printf("   Provider: %s", client.Provider)
@@ -212,7 +225,7 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 	}
 	log.Printf("📡 [MCP] 请求 URL: %s", url)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("创建请求失败: %w", err)
 	}
@@ -249,24 +262,133 @@ func (client *Client) callOnce(systemPrompt, userPrompt string) (string, error)
 		return "", fmt.Errorf("API返回错误 (status %d): %s", resp.StatusCode, string(body))
 	}
 
-	// 解析响应
-	var result struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
+	// 解析响应（兼容不同服务商/网关的响应包装格式）
+	return extractContent(body)
+}
 
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("解析响应失败: %w", err)
+// maxEnvelopeDepth 响应内容最多解包的层数（部分网关会多包一层）
+const maxEnvelopeDepth = 3
+
+// extractContent 从常见的服务商响应格式中提取助手回复内容
+// 支持 OpenAI（choices[].message.content）、Anthropic（content[].text）和通用格式（output/text/response 等），
+// 非JSON响应按纯文本原样返回；若内容本身又是一层响应包装，则继续解包
+func extractContent(body []byte) (string, error) {
+	var envelope interface{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		text := strings.TrimSpace(string(body))
+		if text == "" {
+			return "", fmt.Errorf("API返回空响应")
+		}
+		return text, nil
 	}
 
-	if len(result.Choices) == 0 {
+	content, ok := unwrapEnvelope(envelope)
+	if !ok {
+		return "", fmt.Errorf("解析响应失败: 无法识别的响应格式: %s", truncate(string(body), 200))
+	}
+	if content == "" {
 		return "", fmt.Errorf("API返回空响应")
 	}
 
-	return result.Choices[0].Message.Content, nil
+	// 内容本身可能又是一层JSON包装（网关转发时常见）
+	for depth := 1; depth < maxEnvelopeDepth; depth++ {
+		trimmed := strings.TrimSpace(content)
+		if !strings.HasPrefix(trimmed, "{") {
+			break
+		}
+		var inner interface{}
+		if err := json.Unmarshal([]byte(trimmed), &inner); err != nil {
+			break
+		}
+		innerContent, ok := unwrapEnvelope(inner)
+		if !ok || innerContent == "" {
+			break
+		}
+		content = innerContent
+	}
+
+	return content, nil
+}
+
+// unwrapEnvelope 从已解析的JSON中查找助手回复文本
+func unwrapEnvelope(v interface{}) (string, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	// OpenAI 兼容格式: {"choices":[{"message":{"content":"..."}}]} 或 {"choices":[{"text":"..."}]}
+	if choices, ok := obj["choices"].([]interface{}); ok {
+		if len(choices) == 0 {
+			return "", true
+		}
+		choice, _ := choices[0].(map[string]interface{})
+		if message, ok := choice["message"].(map[string]interface{}); ok {
+			return contentText(message["content"])
+		}
+		if text, ok := choice["text"].(string); ok {
+			return text, true
+		}
+		return "", false
+	}
+
+	// Anthropic 格式: {"content":[{"type":"text","text":"..."}]}，或直接 {"content":"..."}
+	if content, ok := obj["content"]; ok {
+		if text, ok := contentText(content); ok {
+			return text, true
+		}
+	}
+
+	// 通用格式: 常见的纯文本字段
+	for _, key := range []string{"output", "text", "response", "result", "completion"} {
+		if text, ok := obj[key].(string); ok {
+			return text, true
+		}
+	}
+
+	// 嵌套包装: {"data":{...}} / {"message":{...}}
+	for _, key := range []string{"data", "message", "output"} {
+		if inner, ok := obj[key].(map[string]interface{}); ok {
+			if text, ok := unwrapEnvelope(inner); ok {
+				return text, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// contentText 提取消息内容（字符串，或由文本片段组成的数组）
+func contentText(content interface{}) (string, bool) {
+	switch c := content.(type) {
+	case string:
+		return c, true
+	case []interface{}:
+		var sb strings.Builder
+		found := false
+		for _, part := range c {
+			switch p := part.(type) {
+			case string:
+				sb.WriteString(p)
+				found = true
+			case map[string]interface{}:
+				if text, ok := p["text"].(string); ok {
+					sb.WriteString(text)
+					found = true
+				}
+			}
+		}
+		return sb.String(), found
+	}
+	return "", false
+}
+
+// truncate 截断过长的字符串（用于错误信息）
+func truncate(s string, maxLen int) string {
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
 }
 
 // isRetryableError 判断错误是否可重试
@@ -0,0 +1,37 @@
+package mcp
+
+import "testing"
+
+func TestExtractContent(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"OpenAI", `{"choices":[{"message":{"role":"assistant","content":"决策"}}]}`, "决策"},
+		{"OpenAI text补全", `{"choices":[{"text":"决策"}]}`, "决策"},
+		{"Anthropic", `{"content":[{"type":"text","text":"决"},{"type":"text","text":"策"}]}`, "决策"},
+		{"通用output", `{"output":"决策"}`, "决策"},
+		{"嵌套data", `{"data":{"response":"决策"}}`, "决策"},
+		{"内容又包一层", `{"choices":[{"message":{"content":"{\"output\":\"决策\"}"}}]}`, "决策"},
+		{"纯文本", "  决策文本\n", "决策文本"},
+		{"内容是JSON决策数组", `{"output":"[{\"symbol\":\"BTCUSDT\"}]"}`, `[{"symbol":"BTCUSDT"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractContent([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("extractContent() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("extractContent() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, body := range []string{`{"choices":[]}`, `{"unknown":1}`, "   "} {
+		if _, err := extractContent([]byte(body)); err == nil {
+			t.Errorf("extractContent(%q) 应返回错误", body)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -412,14 +413,53 @@ var oiTopConfig = struct {
 	APIURL   string
 	Timeout  time.Duration
 	CacheDir string
+	CacheTTL time.Duration // 内存缓存有效期（OI排名按小时更新，无需每个周期都请求）
 }{
 	APIURL:   "",
 	Timeout:  30 * time.Second,
 	CacheDir: "coin_pool_cache",
+	CacheTTL: 5 * time.Minute,
 }
 
-// GetOITopPositions 获取持仓量增长Top20数据（带重试和缓存）
+// oiTopMemCache OI Top内存缓存（互斥锁保证并发周期只有一个在请求数据源）
+var oiTopMemCache struct {
+	mu        sync.Mutex
+	positions []OIPosition
+	fetchedAt time.Time
+}
+
+// SetOITopCacheTTL 设置OI Top内存缓存有效期（<=0 表示禁用缓存）
+func SetOITopCacheTTL(ttl time.Duration) {
+	oiTopMemCache.mu.Lock()
+	defer oiTopMemCache.mu.Unlock()
+	oiTopConfig.CacheTTL = ttl
+}
+
+// GetOITopPositions 获取持仓量增长Top20数据（TTL内复用内存缓存）
 func GetOITopPositions() ([]OIPosition, error) {
+	oiTopMemCache.mu.Lock()
+	defer oiTopMemCache.mu.Unlock()
+
+	ttl := oiTopConfig.CacheTTL
+	if ttl > 0 && len(oiTopMemCache.positions) > 0 && time.Since(oiTopMemCache.fetchedAt) < ttl {
+		return oiTopMemCache.positions, nil
+	}
+
+	positions, err := loadOITopPositions()
+	if err != nil {
+		return nil, err
+	}
+
+	// 只缓存非空结果，空结果下个周期重新请求
+	if len(positions) > 0 {
+		oiTopMemCache.positions = positions
+		oiTopMemCache.fetchedAt = time.Now()
+	}
+	return positions, nil
+}
+
+// loadOITopPositions 从API获取OI Top数据（带重试和文件缓存）
+func loadOITopPositions() ([]OIPosition, error) {
 	// 检查API URL是否配置
 	if strings.TrimSpace(oiTopConfig.APIURL) == "" {
 		log.Printf("⚠️  未配置OI Top API URL，跳过OI Top数据获取")
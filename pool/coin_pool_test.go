@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOITopMemoryCacheTTL(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		fmt.Fprint(w, `{"success":true,"data":{"positions":[{"symbol":"SOLUSDT","rank":1}],"time_range":"1h"}}`)
+	}))
+	defer server.Close()
+
+	origURL, origDir, origTTL := oiTopConfig.APIURL, oiTopConfig.CacheDir, oiTopConfig.CacheTTL
+	defer func() {
+		oiTopConfig.APIURL, oiTopConfig.CacheDir = origURL, origDir
+		SetOITopCacheTTL(origTTL)
+		oiTopMemCache.positions = nil
+	}()
+	SetOITopAPI(server.URL)
+	oiTopConfig.CacheDir = t.TempDir()
+	SetOITopCacheTTL(100 * time.Millisecond)
+	oiTopMemCache.positions = nil
+
+	for i := 0; i < 2; i++ {
+		positions, err := GetOITopPositions()
+		if err != nil || len(positions) != 1 || positions[0].Symbol != "SOLUSDT" {
+			t.Fatalf("GetOITopPositions() = %v, %v", positions, err)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("TTL内第二次调用应命中缓存，实际请求%d次", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := GetOITopPositions(); err != nil {
+		t.Fatal(err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("TTL过期后应重新请求，实际请求%d次", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"nofx/decision"
 	"nofx/logger"
 	"nofx/market"
@@ -63,6 +64,13 @@ type AutoTraderConfig struct {
 	MaxDailyLoss    float64       // 最大日亏损百分比（提示）
 	MaxDrawdown     float64       // 最大回撤百分比（提示）
 	StopTradingTime time.Duration // 触发风控后暂停时长
+	MaxPositions    int           // 最多持仓币种数（0=默认3个）
+
+	// 夏普比率滚动窗口（同时用于计算夏普比率和提示词中的窗口说明，0=使用最近100个周期全部记录）
+	SharpeWindow time.Duration
+
+	// 决策层风控（在AI决策验证阶段强制执行）
+	Risk decision.RiskConfig
 
 	// 仓位模式
 	IsCrossMargin bool // true=全仓模式, false=逐仓模式
@@ -87,6 +95,7 @@ type AutoTrader struct {
 	decisionLogger        *logger.DecisionLogger // 决策日志记录器
 	initialBalance        float64
 	dailyPnL              float64
+	dayStartWallet        float64  // 当日起始钱包余额（用于计算当日已实现盈亏，0表示尚未记录）
 	customPrompt          string   // 自定义交易策略prompt
 	overrideBasePrompt    bool     // 是否覆盖基础prompt
 	systemPromptTemplate  string   // 系统提示词模板名称
@@ -97,6 +106,8 @@ type AutoTrader struct {
 	isRunning             bool
 	startTime             time.Time        // 系统启动时间
 	callCount             int              // AI调用次数
+	sharpeHaltStartCycle  int              // 夏普比率熔断触发的周期（0=未触发）
+	lastEquity            float64          // 上一周期的账户净值（用于净值突变检测）
 	positionFirstSeenTime map[string]int64 // 持仓首次出现时间 (symbol_side -> timestamp毫秒)
 }
 
@@ -188,6 +199,11 @@ func NewAutoTrader(config AutoTraderConfig) (*AutoTrader, error) {
 		return nil, fmt.Errorf("初始金额必须大于0，请在配置中设置InitialBalance")
 	}
 
+	// 验证杠杆和风控配置（配置错误时启动失败，而不是每个开仓决策都被拒绝）
+	if err := config.Risk.Validate(config.BTCETHLeverage, config.AltcoinLeverage); err != nil {
+		return nil, fmt.Errorf("风控配置无效: %w", err)
+	}
+
 	// 初始化决策日志记录器（使用trader ID创建独立目录）
 	logDir := fmt.Sprintf("decision_logs/%s", config.ID)
 	decisionLogger := logger.NewDecisionLogger(logDir)
@@ -280,6 +296,7 @@ func (at *AutoTrader) runCycle() error {
 	// 2. 重置日盈亏（每天重置）
 	if time.Since(at.lastResetTime) > 24*time.Hour {
 		at.dailyPnL = 0
+		at.dayStartWallet = 0
 		at.lastResetTime = time.Now()
 		log.Println("📅 日盈亏已重置")
 	}
@@ -327,6 +344,8 @@ func (at *AutoTrader) runCycle() error {
 	// 4. 调用AI获取完整决策
 	log.Printf("🤖 正在请求AI分析并决策... [模板: %s]", at.systemPromptTemplate)
 	decision, err := decision.GetFullDecisionWithCustomPrompt(ctx, at.mcpClient, at.customPrompt, at.overrideBasePrompt, at.systemPromptTemplate)
+	at.sharpeHaltStartCycle = ctx.SharpeHaltStartCycle
+	at.lastEquity = ctx.Account.TotalEquity
 
 	// 即使有错误，也保存思维链、决策和输入prompt（用于debug）
 	if decision != nil {
@@ -539,6 +558,11 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 	// 4. 计算总盈亏
 	totalPnL := totalEquity - at.initialBalance
+	// 钱包余额只随平仓（及手续费/资金费）变化，当日变化即当日已实现盈亏
+	if at.dayStartWallet == 0 {
+		at.dayStartWallet = totalWalletBalance
+	}
+	at.dailyPnL = totalWalletBalance - at.dayStartWallet
 	totalPnLPct := 0.0
 	if at.initialBalance > 0 {
 		totalPnLPct = (totalPnL / at.initialBalance) * 100
@@ -551,7 +575,7 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 	// 5. 分析历史表现（最近100个周期，避免长期持仓的交易记录丢失）
 	// 假设每3分钟一个周期，100个周期 = 5小时，足够覆盖大部分交易
-	performance, err := at.decisionLogger.AnalyzePerformance(100)
+	performance, err := at.decisionLogger.AnalyzePerformanceWindow(100, at.config.SharpeWindow)
 	if err != nil {
 		log.Printf("⚠️  分析历史表现失败: %v", err)
 		// 不影响主流程，继续执行（但设置performance为nil以避免传递错误数据）
@@ -565,11 +589,16 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		CallCount:       at.callCount,
 		BTCETHLeverage:  at.config.BTCETHLeverage,  // 使用配置的杠杆倍数
 		AltcoinLeverage: at.config.AltcoinLeverage, // 使用配置的杠杆倍数
+		Risk:            at.config.Risk,
+		PrimaryExchange: at.exchange,
+		MaxPositions:    at.config.MaxPositions,
 		Account: decision.AccountInfo{
 			TotalEquity:      totalEquity,
 			AvailableBalance: availableBalance,
 			TotalPnL:         totalPnL,
 			TotalPnLPct:      totalPnLPct,
+			RealizedPnL:      at.dailyPnL,
+			UnrealizedPnL:    totalUnrealizedProfit,
 			MarginUsed:       totalMarginUsed,
 			MarginUsedPct:    marginUsedPct,
 			PositionCount:    len(positionInfos),
@@ -577,6 +606,10 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 		Positions:      positionInfos,
 		CandidateCoins: candidateCoins,
 		Performance:    performance, // 添加历史表现分析
+
+		PreviousEquity:       at.lastEquity,
+		SharpeWindow:         at.config.SharpeWindow,
+		SharpeHaltStartCycle: at.sharpeHaltStartCycle,
 	}
 
 	return ctx, nil
@@ -584,6 +617,11 @@ func (at *AutoTrader) buildTradingContext() (*decision.Context, error) {
 
 // executeDecisionWithRecord 执行AI决策并记录详细信息
 func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	// 只执行本交易所的决策（多交易所场景下由对应的Trader执行）
+	if decision.Exchange != "" && decision.Exchange != at.exchange {
+		return fmt.Errorf("决策目标交易所 %s 与当前交易所 %s 不一致，跳过执行", decision.Exchange, at.exchange)
+	}
+
 	switch decision.Action {
 	case "open_long":
 		return at.executeOpenLongWithRecord(decision, actionRecord)
@@ -593,6 +631,8 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 		return at.executeCloseLongWithRecord(decision, actionRecord)
 	case "close_short":
 		return at.executeCloseShortWithRecord(decision, actionRecord)
+	case "add_long", "add_short":
+		return at.executeAddWithRecord(decision, actionRecord)
 	case "hold", "wait":
 		// 无需执行，仅记录
 		return nil
@@ -601,6 +641,115 @@ func (at *AutoTrader) executeDecisionWithRecord(decision *decision.Decision, act
 	}
 }
 
+// findLivePosition 查找币种的当前持仓，返回方向（long/short）和数量
+func (at *AutoTrader) findLivePosition(symbol string) (string, float64, error) {
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return "", 0, err
+	}
+	for _, pos := range positions {
+		if pos["symbol"] != symbol {
+			continue
+		}
+		side, _ := pos["side"].(string)
+		quantity, _ := pos["positionAmt"].(float64)
+		if quantity < 0 {
+			quantity = -quantity
+		}
+		if quantity > 0 {
+			return side, quantity, nil
+		}
+	}
+	return "", 0, fmt.Errorf("❌ %s 没有持仓", symbol)
+}
+
+// executeAddWithRecord 补足部分成交的持仓并记录详细信息（沿用持仓原有杠杆）
+func (at *AutoTrader) executeAddWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
+	side := "long"
+	if decision.Action == "add_short" {
+		side = "short"
+	}
+	log.Printf("  ➕ 补仓(%s): %s", side, decision.Symbol)
+
+	// 补仓必须已有同方向持仓，沿用其杠杆
+	leverage := 0
+	existingQuantity := 0.0
+	positions, err := at.trader.GetPositions()
+	if err != nil {
+		return err
+	}
+	for _, pos := range positions {
+		if pos["symbol"] == decision.Symbol && pos["side"] == side {
+			if lev, ok := pos["leverage"].(float64); ok {
+				leverage = int(lev)
+			}
+			if amt, ok := pos["positionAmt"].(float64); ok {
+				existingQuantity = math.Abs(amt)
+			}
+			break
+		}
+	}
+	if leverage <= 0 {
+		return fmt.Errorf("❌ %s 没有%s持仓，无法补仓", decision.Symbol, side)
+	}
+
+	marketData, err := market.Get(decision.Symbol)
+	if err != nil {
+		return err
+	}
+	quantity := decision.PositionSizeUSD / marketData.CurrentPrice
+	actionRecord.Quantity = quantity
+	actionRecord.Price = marketData.CurrentPrice
+
+	var order map[string]interface{}
+	if side == "long" {
+		order, err = at.trader.OpenLong(decision.Symbol, quantity, leverage)
+	} else {
+		order, err = at.trader.OpenShort(decision.Symbol, quantity, leverage)
+	}
+	if err != nil {
+		return err
+	}
+	if orderID, ok := order["orderId"].(int64); ok {
+		actionRecord.OrderID = orderID
+	}
+
+	log.Printf("  ✓ 补仓成功，订单ID: %v, 数量: %.4f", order["orderId"], quantity)
+
+	// 补仓下单时已撤销该币种的全部挂单（含原有止损止盈），按补仓后的总数量重新挂单
+	totalQuantity := existingQuantity + quantity
+	if _, liveQuantity, err := at.findLivePosition(decision.Symbol); err == nil {
+		totalQuantity = liveQuantity
+	} else {
+		log.Printf("  ⚠ 获取补仓后持仓失败: %v，按计算数量%.4f重新挂止损止盈", err, totalQuantity)
+	}
+	at.placeProtectiveOrders(decision, totalQuantity, marketData.CurrentPrice)
+	return nil
+}
+
+// placeProtectiveOrders 按持仓总数量挂止损和分批止盈（数量按 ToOrderIntents 的阶梯比例拆分）
+func (at *AutoTrader) placeProtectiveOrders(d *decision.Decision, quantity, price float64) {
+	positionSide := "LONG"
+	if strings.HasSuffix(d.Action, "_short") {
+		positionSide = "SHORT"
+	}
+	protective := *d
+	protective.OrderType = ""
+	protective.PositionSizeUSD = quantity * price
+	for _, intent := range protective.ToOrderIntents(price) {
+		switch intent.Purpose {
+		case decision.OrderPurposeStopLoss:
+			if err := at.trader.SetStopLoss(d.Symbol, positionSide, intent.Quantity, intent.Price); err != nil {
+				log.Printf("  ⚠ 设置止损失败: %v", err)
+			}
+		case decision.OrderPurposeTakeProfit:
+			if err := at.trader.SetTakeProfit(d.Symbol, positionSide, intent.Quantity, intent.Price); err != nil {
+				log.Printf("  ⚠ 设置止盈失败: %v", err)
+			}
+		}
+	}
+}
+
 // executeOpenLongWithRecord 执行开多仓并记录详细信息
 func (at *AutoTrader) executeOpenLongWithRecord(decision *decision.Decision, actionRecord *logger.DecisionAction) error {
 	log.Printf("  📈 开多仓: %s", decision.Symbol)
@@ -986,8 +1135,8 @@ func sortDecisionsByPriority(decisions []decision.Decision) []decision.Decision
 		switch action {
 		case "close_long", "close_short":
 			return 1 // 最高优先级：先平仓
-		case "open_long", "open_short":
-			return 2 // 次优先级：后开仓
+		case "open_long", "open_short", "add_long", "add_short":
+			return 2 // 次优先级：后开仓/补仓
 		case "hold", "wait":
 			return 3 // 最低优先级：观望
 		default: